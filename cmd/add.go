@@ -1,56 +1,363 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
+	"github.com/subcode-labs/dots/internal/block"
 	"github.com/subcode-labs/dots/internal/config"
 	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/hook"
+	"github.com/subcode-labs/dots/internal/layer"
+	"github.com/subcode-labs/dots/internal/policy"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/secrets"
+	"github.com/subcode-labs/dots/internal/structured"
+)
+
+var (
+	addAs           string
+	addTarget       string
+	addFollow       bool
+	addForce        bool
+	addMaxSize      string
+	addAllowSecrets bool
+	addEncrypt      bool
+	addFilter       string
+	addTemplate     bool
+	addLocal        bool
+	addBlock        string
+	addMerge        bool
+	addArrays       string
 )
 
 var addCmd = &cobra.Command{
-	Use:   "add <file>",
-	Short: "Add a file to dots management",
-	Args:  cobra.ExactArgs(1),
+	Use:   "add <file>...",
+	Short: "Add files to dots management",
+	Long: "Add files to dots management. Arguments may be shell-style globs (including **),\n" +
+		"and '-' reads newline-separated paths from standard input.",
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		home, err := dotfile.HomeDir()
 		if err != nil {
 			return err
 		}
-		sourcePath, err := filepath.Abs(args[0])
-		if err != nil {
-			return fmt.Errorf("resolve path: %w", err)
-		}
 		if err := ensureManifestExists(home); err != nil {
 			return err
 		}
+		paths, err := expandAddArgs(args, cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("no files to add")
+		}
+		if (addAs != "" || addTarget != "") && len(paths) != 1 {
+			return fmt.Errorf("--as and --target require exactly one file")
+		}
 		manifest, err := config.Load(home)
 		if err != nil {
 			return err
 		}
+		maxSize, err := addSizeLimit(manifest)
+		if err != nil {
+			return err
+		}
+		scanner, err := secrets.New(home, manifest.Secrets)
+		if err != nil {
+			return err
+		}
+		stack, err := layer.Resolve(home, manifest)
+		if err != nil {
+			return err
+		}
+		rules := policy.Collect(stack)
+		pipeline := render.New(home, manifest)
 
-		destination, err := dotfile.CopyIntoDots(home, sourcePath)
+		var added []config.FileEntry
+		failed := 0
+		for _, path := range paths {
+			entry, skip, err := addFile(pipeline, scanner, rules, path, maxSize)
+			switch {
+			case err != nil:
+				var preflightErr *dotfile.PreflightError
+				var secretErr *secrets.FoundError
+				switch {
+				case errors.As(err, &preflightErr) && preflightErr.Forceable():
+					err = fmt.Errorf("%w (use --force to add anyway)", err)
+				case errors.As(err, &secretErr):
+					err = fmt.Errorf("%w (use --allow-secrets to add anyway)", err)
+				}
+				color.New(color.FgRed).Printf("Failed  %s: %v\n", path, err)
+				failed++
+			case skip != "":
+				color.New(color.FgYellow).Printf("Skipped %s (%s)\n", path, skip)
+			default:
+				config.UpsertEntry(manifest, entry)
+				added = append(added, entry)
+			}
+		}
+
+		if len(added) > 0 {
+			if err := config.Save(home, manifest); err != nil {
+				return err
+			}
+		}
+		runner, err := newHookRunner(home, manifest)
 		if err != nil {
 			return err
 		}
-		entry := config.FileEntry{
-			Source: destination,
-			Target: sourcePath,
+		targets := make([]string, len(added))
+		for i, entry := range added {
+			targets[i] = entry.Target
 		}
-		config.UpsertEntry(manifest, entry)
-		if err := config.Save(home, manifest); err != nil {
+		if err := runner.Global(hook.PreAdd, targets); err != nil {
 			return err
 		}
-		if err := dotfile.EnsureSymlink(sourcePath, destination); err != nil {
+		for _, entry := range added {
+			if err := runner.Entry(hook.PreAdd, entry, "added"); err != nil {
+				failed++
+				continue
+			}
+			if err := pipeline.Apply(entry); err != nil {
+				color.New(color.FgRed).Printf("Failed  %s: %v\n", entry.Target, err)
+				failed++
+				continue
+			}
+			color.New(color.FgGreen).Printf("Tracked %s -> %s\n", entry.Target, entry.Source)
+			if err := runner.Entry(hook.PostAdd, entry, "added"); err == nil {
+				runner.Entry(hook.OnChange, entry, "added")
+			}
+		}
+		if err := runner.Global(hook.PostAdd, targets); err == nil {
+			runner.Global(hook.OnChange, targets)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d files could not be added", failed, len(paths))
+		}
+		return runner.Err()
+	},
+}
+
+func init() {
+	addCmd.Flags().StringVar(&addAs, "as", "", "name of the stored file inside the dots directory")
+	addCmd.Flags().StringVar(&addTarget, "target", "", "path the stored file is linked to instead of the source path")
+	addCmd.Flags().BoolVar(&addFollow, "follow", false, "track the file a symlink points to instead of rejecting it")
+	addCmd.Flags().BoolVar(&addForce, "force", false, "add files that fail the size, binary or ownership checks")
+	addCmd.Flags().StringVar(&addFilter, "filter", "", "name of a manifest filter that redacts values before they are stored")
+	addCmd.Flags().StringVar(&addBlock, "block", "", "manage only the region between '# BEGIN dots:<name>' and '# END dots:<name>' markers in the file")
+	addCmd.Flags().BoolVar(&addMerge, "merge", false, "deep-merge the stored JSON, YAML or TOML keys into the file instead of replacing it")
+	addCmd.Flags().StringVar(&addArrays, "arrays", "", "with --merge, how stored arrays combine with the file's: replace or union")
+	addCmd.Flags().BoolVar(&addLocal, "local", false, "keep the entry in dots.local.yaml and out of git")
+	addCmd.Flags().BoolVar(&addTemplate, "template", false, "materialise the file as a copy with {{ secret }} and {{ value }} references filled in")
+	addCmd.Flags().BoolVar(&addEncrypt, "encrypt", false, "store the file encrypted for the manifest recipients and materialise it as a copy")
+	addCmd.Flags().BoolVar(&addAllowSecrets, "allow-secrets", false, "add files even if the secret scanner flags them")
+	addCmd.Flags().StringVar(&addMaxSize, "max-size", "", "largest file size to accept, e.g. 512K or 4M (overrides settings.max_file_size)")
+}
+
+func addSizeLimit(manifest *config.Manifest) (int64, error) {
+	value := manifest.Settings.MaxFileSize
+	if addMaxSize != "" {
+		value = addMaxSize
+	}
+	return config.ParseSize(value)
+}
+
+func expandAddArgs(args []string, stdin io.Reader) ([]string, error) {
+	var raw []string
+	for _, arg := range args {
+		if arg != "-" {
+			raw = append(raw, arg)
+			continue
+		}
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				raw = append(raw, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read paths from stdin: %w", err)
+		}
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, arg := range raw {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("resolve path: %w", err)
+		}
+		candidates := []string{path}
+		if dotfile.HasMeta(path) {
+			matches, err := dotfile.Glob(path)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			candidates = candidates[:0]
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.IsDir() {
+					continue
+				}
+				candidates = append(candidates, match)
+			}
+		}
+		for _, candidate := range candidates {
+			if !seen[candidate] {
+				seen[candidate] = true
+				paths = append(paths, candidate)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func addFile(pipeline *render.Pipeline, scanner *secrets.Scanner, rules *policy.Set, sourcePath string, maxSize int64) (config.FileEntry, string, error) {
+	home, manifest := pipeline.Home, pipeline.Manifest
+	info, err := os.Lstat(sourcePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return config.FileEntry{}, "", fmt.Errorf("file not found")
+		}
+		return config.FileEntry{}, "", fmt.Errorf("inspect source: %w", err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if linked, found := trackedBySymlink(manifest, sourcePath); found {
+			return config.FileEntry{}, fmt.Sprintf("already tracked as %s", linked.Target), nil
+		}
+		if !addFollow {
+			return config.FileEntry{}, "", fmt.Errorf("source is a symlink, use --follow to track the file it points to")
+		}
+		resolved, err := filepath.EvalSymlinks(sourcePath)
+		if err != nil {
+			return config.FileEntry{}, "", fmt.Errorf("follow symlink: %w", err)
+		}
+		sourcePath = resolved
+	}
+
+	target := sourcePath
+	if addTarget != "" {
+		if target, err = filepath.Abs(addTarget); err != nil {
+			return config.FileEntry{}, "", fmt.Errorf("resolve target: %w", err)
+		}
+		if err := checkTargetFree(sourcePath, target); err != nil {
+			return config.FileEntry{}, "", err
+		}
+	}
+	if _, found := config.FindEntry(manifest, target); found {
+		return config.FileEntry{}, "already tracked", nil
+	}
+	if err := rules.CheckAdd(target); err != nil {
+		return config.FileEntry{}, "", err
+	}
+	entry := config.FileEntry{Target: target, Encrypted: addEncrypt, Filter: addFilter, Template: addTemplate, Block: addBlock, Local: addLocal}
+	entry.Merge, entry.Arrays = addMerge, addArrays
+	if err := checkPartial(entry); err != nil {
+		return config.FileEntry{}, "", err
+	}
+	scan := !addAllowSecrets && !entry.Encrypted && !entry.Local
+	var inspect func(string) error
+	var encode func([]byte) ([]byte, error)
+	if scan && !entry.IsCopy() {
+		inspect = func(path string) error {
+			return checkSecrets(scanner, path, target)
+		}
+	}
+	if entry.IsCopy() {
+		encode = func(content []byte) ([]byte, error) {
+			if entry.Block != "" {
+				region, _, err := block.Extract(content, entry.Block)
+				if err != nil {
+					return nil, err
+				}
+				content = region
+			}
+			if scan {
+				if err := checkCleanedSecrets(pipeline, scanner, entry, content); err != nil {
+					return nil, err
+				}
+			}
+			return pipeline.Capture(entry, content)
+		}
+	}
+
+	destination, err := dotfile.CopyIntoDotsWithOptions(home, sourcePath, dotfile.CopyOptions{
+		Name:     addAs,
+		Target:   target,
+		Manifest: manifest,
+		MaxSize:  maxSize,
+		Force:    addForce,
+		Inspect:  inspect,
+		Encode:   encode,
+	})
+	if err != nil {
+		return config.FileEntry{}, "", err
+	}
+	entry.Source = destination
+	return entry, "", nil
+}
+
+func checkPartial(entry config.FileEntry) error {
+	switch {
+	case entry.Block != "" && entry.Merge:
+		return fmt.Errorf("--block and --merge cannot be combined")
+	case entry.Arrays != "" && !entry.Merge:
+		return fmt.Errorf("--arrays requires --merge")
+	case entry.Block != "":
+		return block.ValidName(entry.Block)
+	case entry.Merge:
+		if _, err := structured.FormatFor(entry.Target); err != nil {
 			return err
 		}
-		color.New(color.FgGreen).Printf("Tracked %s -> %s\n", sourcePath, destination)
+		_, err := structured.ParseArrays(entry.Arrays)
+		return err
+	}
+	return nil
+}
+
+func trackedBySymlink(manifest *config.Manifest, path string) (config.FileEntry, bool) {
+	link, err := os.Readlink(path)
+	if err != nil {
+		return config.FileEntry{}, false
+	}
+	for _, entry := range manifest.Files {
+		if entry.Source == link {
+			return entry, true
+		}
+	}
+	return config.FileEntry{}, false
+}
+
+func checkTargetFree(sourcePath, target string) error {
+	if target == sourcePath {
 		return nil
-	},
+	}
+	if _, err := os.Lstat(target); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("stat target: %w", err)
+	}
+	same, err := dotfile.SameContent(sourcePath, target)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("target %s already exists with different content", target)
+	}
+	return nil
 }
 
 func ensureManifestExists(home string) error {
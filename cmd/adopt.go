@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/secrets"
+)
+
+var (
+	adoptAll          bool
+	adoptAllowSecrets bool
+)
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt [file...]",
+	Short: "Copy edited targets back into the dots directory",
+	Long: "Copy the content of targets that were replaced by regular files back into the dots\n" +
+		"directory and link them again. Adopted content is scanned for secrets first.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		entries, err := selectEntries(manifest, args, adoptAll)
+		if err != nil {
+			return err
+		}
+		scanner, err := secrets.New(home, manifest.Secrets)
+		if err != nil {
+			return err
+		}
+
+		pipeline := render.New(home, manifest)
+		adopted, failed := 0, 0
+		for _, entry := range entries {
+			ok, err := adoptable(pipeline, entry)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if !adoptAllowSecrets && !entry.Encrypted {
+				live, err := os.ReadFile(entry.Target)
+				if err != nil {
+					return fmt.Errorf("read target: %w", err)
+				}
+				if err := checkCleanedSecrets(pipeline, scanner, entry, live); err != nil {
+					var secretErr *secrets.FoundError
+					if errors.As(err, &secretErr) {
+						err = fmt.Errorf("%w (use --allow-secrets to adopt anyway)", err)
+					}
+					color.New(color.FgRed).Printf("Failed  %s: %v\n", entry.Target, err)
+					failed++
+					continue
+				}
+			}
+			if err := pipeline.Adopt(entry); err != nil {
+				return err
+			}
+			if err := pipeline.Apply(entry); err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Adopted %s -> %s\n", entry.Target, entry.Source)
+			adopted++
+		}
+		if adopted == 0 && failed == 0 {
+			color.New(color.FgYellow).Println("Nothing to adopt.")
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d files could not be adopted", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	adoptCmd.Flags().BoolVar(&adoptAll, "all", false, "adopt every tracked file that is no longer a symlink")
+	adoptCmd.Flags().BoolVar(&adoptAllowSecrets, "allow-secrets", false, "adopt files even if the secret scanner flags them")
+}
+
+func adoptable(pipeline *render.Pipeline, entry config.FileEntry) (bool, error) {
+	if entry.IsCopy() {
+		status, err := pipeline.Status(entry)
+		return err == nil && status.Status == dotfile.StatusDiverged, err
+	}
+	status, err := dotfile.LinkStatus(entry)
+	return err == nil && status.Status == dotfile.StatusConflicts && status.Info == "not a symlink", err
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/state"
+)
+
+func recordApplied(home string, pipeline *render.Pipeline, previous []config.FileEntry, previousRevision string) error {
+	recorded, err := state.LoadApplied(home)
+	if err != nil {
+		return err
+	}
+	repo := gitrepo.Open(config.DotsDir(home))
+	revision := ""
+	if repo.Exists() {
+		if revision, err = repo.Head(); err != nil {
+			return err
+		}
+	}
+	for _, entry := range previous {
+		if _, ok := recorded[entry.Target]; !ok {
+			recorded[entry.Target] = appliedRecord(entry, "", previousRevision)
+		}
+	}
+
+	current := map[string]state.Applied{}
+	for _, entry := range pipeline.Manifest.Files {
+		hash := ""
+		if _, err := os.Stat(entry.Source); err == nil {
+			content, err := appliedContent(pipeline, entry)
+			if err != nil {
+				return err
+			}
+			hash = state.Hash(content)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("stat stored file: %w", err)
+		}
+		current[entry.Target] = appliedRecord(entry, hash, revision)
+	}
+
+	for target, entry := range recorded {
+		if _, ok := current[target]; ok {
+			continue
+		}
+		result, err := state.Prune(entry, func() ([]byte, bool) {
+			return lastContent(repo, entry)
+		})
+		if err != nil {
+			return err
+		}
+		switch result {
+		case state.PruneRestored:
+			color.New(color.FgYellow).Printf("Dropped %s (no longer tracked, restored its last content)\n", target)
+		case state.PruneUnlinked:
+			color.New(color.FgYellow).Printf("Dropped %s (no longer tracked, removed its stale link)\n", target)
+		case state.PruneRemoved:
+			color.New(color.FgYellow).Printf("Dropped %s (no longer tracked, removed the unchanged copy)\n", target)
+		case state.PruneDetached:
+			color.New(color.FgYellow).Printf("Dropped %s (no longer tracked, removed the managed part)\n", target)
+		default:
+			color.New(color.FgYellow).Printf("Dropped %s (no longer tracked, left in place)\n", target)
+		}
+	}
+	return state.SaveApplied(home, current)
+}
+
+func appliedRecord(entry config.FileEntry, hash, revision string) state.Applied {
+	mode := state.ModeLink
+	if entry.IsCopy() {
+		mode = state.ModeCopy
+	}
+	return state.Applied{
+		Target:    entry.Target,
+		Source:    entry.Source,
+		Mode:      mode,
+		Block:     entry.Block,
+		Merge:     entry.Merge,
+		Arrays:    entry.Arrays,
+		Hash:      hash,
+		Revision:  revision,
+		AppliedAt: time.Now().UTC(),
+	}
+}
+
+func appliedContent(pipeline *render.Pipeline, entry config.FileEntry) ([]byte, error) {
+	if entry.IsPartial() {
+		return pipeline.Managed(entry)
+	}
+	if entry.IsCopy() {
+		return pipeline.Render(entry)
+	}
+	return pipeline.Plain(entry)
+}
+
+func lastContent(repo *gitrepo.Repo, entry state.Applied) ([]byte, bool) {
+	if data, err := os.ReadFile(entry.Source); err == nil {
+		return data, true
+	}
+	if !repo.Exists() {
+		return nil, false
+	}
+	rel, err := filepath.Rel(repo.Dir, entry.Source)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, false
+	}
+	data, err := repo.LastContent(filepath.ToSlash(rel))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
@@ -5,31 +5,73 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/subcode-labs/dots/internal/config"
-	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/hook"
+	"github.com/subcode-labs/dots/internal/render"
 )
 
+var applySkipScripts bool
+
 var applyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Create symlinks for all tracked dotfiles",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		home, err := dotfile.HomeDir()
+		home, stack, err := loadStack()
 		if err != nil {
 			return err
 		}
-		manifest, err := config.Load(home)
+		manifest := stack.Merged
+		if len(manifest.Files) == 0 {
+			color.New(color.FgYellow).Println("No tracked dotfiles.")
+		}
+		if err := requireSignature(stack); err != nil {
+			return err
+		}
+		if err := enforcePolicy(stack); err != nil {
+			return err
+		}
+		if err := config.ValidateScripts(manifest.Scripts); err != nil {
+			return err
+		}
+		pipeline := render.New(home, manifest)
+		if err := autoSnapshot(home, pipeline, "apply"); err != nil {
+			return err
+		}
+		runner, err := newHookRunner(home, manifest)
 		if err != nil {
 			return err
 		}
-		if len(manifest.Files) == 0 {
-			color.New(color.FgYellow).Println("No tracked dotfiles.")
-			return nil
+		changed := pendingChanges(pipeline)
+		targets := changedTargets(manifest.Files, changed)
+		if err := runner.Global(hook.PreApply, targets); err != nil {
+			return err
 		}
 		for _, entry := range manifest.Files {
-			if err := dotfile.EnsureSymlink(entry.Target, entry.Source); err != nil {
+			err := applyWithHooks(runner, pipeline, entry, changed, func() {
+				if entry.IsCopy() {
+					color.New(color.FgGreen).Printf("Wrote  %s from %s\n", entry.Target, entry.Source)
+					return
+				}
+				color.New(color.FgGreen).Printf("Linked %s -> %s\n", entry.Target, entry.Source)
+			})
+			if err != nil {
 				return err
 			}
-			color.New(color.FgGreen).Printf("Linked %s -> %s\n", entry.Target, entry.Source)
 		}
-		return nil
+		if err := runner.Global(hook.PostApply, targets); err == nil {
+			runner.Global(hook.OnChange, targets)
+		}
+		if err := recordApplied(home, pipeline, nil, ""); err != nil {
+			return err
+		}
+		if !applySkipScripts {
+			if err := runScripts(home, manifest); err != nil {
+				return err
+			}
+		}
+		return runner.Err()
 	},
 }
+
+func init() {
+	applyCmd.Flags().BoolVar(&applySkipScripts, "skip-scripts", false, "link files without running the manifest scripts")
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -13,12 +14,17 @@ import (
 
 	"github.com/subcode-labs/dots/internal/config"
 	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/render"
 )
 
+var diffSince string
+
 var diffCmd = &cobra.Command{
 	Use:   "diff [file]",
 	Short: "Show diffs between tracked files and originals",
-	Args:  cobra.MaximumNArgs(1),
+	Long: "Show diffs between tracked files and originals. With --since, show how the stored\n" +
+		"file changed since a revision or date instead.",
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		home, err := dotfile.HomeDir()
 		if err != nil {
@@ -27,33 +33,70 @@ var diffCmd = &cobra.Command{
 		if err := ensureManifestExists(home); err != nil {
 			return err
 		}
-		manifest, err := config.Load(home)
+		_, stack, err := loadStack()
 		if err != nil {
 			return err
 		}
+		manifest := stack.Merged
 		if len(manifest.Files) == 0 {
 			color.New(color.FgYellow).Println("No tracked dotfiles.")
 			return nil
 		}
 
+		if diffSince != "" {
+			if len(args) != 1 {
+				return fmt.Errorf("--since needs exactly one file")
+			}
+			return diffHistory(args[0], diffSince)
+		}
+		pipeline := render.New(home, manifest)
 		if len(args) == 1 {
-			return diffSingle(manifest, args[0])
+			return diffSingle(pipeline, args[0])
 		}
 
-		return diffAll(manifest)
+		return diffAll(pipeline)
 	},
 }
 
-func diffSingle(manifest *config.Manifest, target string) error {
+func init() {
+	diffCmd.Flags().StringVar(&diffSince, "since", "", "revision or date to compare the stored file against")
+}
+
+func diffHistory(target, since string) error {
+	history, err := loadHistory(target)
+	if err != nil {
+		return err
+	}
+	old, hash, err := history.at(since)
+	if err != nil {
+		return err
+	}
+	current, err := history.pipeline.Plain(history.entry)
+	if err != nil {
+		return err
+	}
+	output, err := diffContent(old, current, history.entry.Target+"@"+shortHash(hash), history.entry.Target)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(output) == "" {
+		color.New(color.FgYellow).Printf("No changes to %s since %s\n", history.entry.Target, shortHash(hash))
+		return nil
+	}
+	printDiff(output)
+	return nil
+}
+
+func diffSingle(pipeline *render.Pipeline, target string) error {
 	resolvedTarget, err := filepath.Abs(target)
 	if err != nil {
 		return fmt.Errorf("resolve path: %w", err)
 	}
-	entry, found := config.FindEntry(manifest, resolvedTarget)
+	entry, found := config.FindEntry(pipeline.Manifest, resolvedTarget)
 	if !found {
 		return fmt.Errorf("file not tracked: %s", resolvedTarget)
 	}
-	output, err := runDiff(entry)
+	output, err := runDiff(pipeline, entry)
 	if err != nil {
 		return err
 	}
@@ -65,17 +108,17 @@ func diffSingle(manifest *config.Manifest, target string) error {
 	return nil
 }
 
-func diffAll(manifest *config.Manifest) error {
+func diffAll(pipeline *render.Pipeline) error {
 	var outputs []string
-	for _, entry := range manifest.Files {
-		status, err := dotfile.ContentStatus(entry)
+	for _, entry := range pipeline.Manifest.Files {
+		status, err := pipeline.Status(entry)
 		if err != nil {
 			return err
 		}
 		if status.Status != dotfile.StatusDiverged {
 			continue
 		}
-		output, err := runDiff(entry)
+		output, err := runDiff(pipeline, entry)
 		if err != nil {
 			return err
 		}
@@ -99,8 +142,35 @@ func diffAll(manifest *config.Manifest) error {
 	return nil
 }
 
-func runDiff(entry config.FileEntry) (string, error) {
-	cmd := exec.Command("diff", "-u", entry.Target, entry.Source)
+func runDiff(pipeline *render.Pipeline, entry config.FileEntry) (string, error) {
+	if !entry.IsCopy() {
+		return diffFiles(entry.Target, entry.Source, entry.Target, entry.Source)
+	}
+	have, want, err := pipeline.Compare(entry)
+	if err != nil {
+		return "", err
+	}
+	return diffContent(have, want, entry.Target, entry.Source)
+}
+
+func diffContent(have, want []byte, fromLabel, toLabel string) (string, error) {
+	dir, err := os.MkdirTemp("", "dots-diff-*")
+	if err != nil {
+		return "", fmt.Errorf("create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	from, to := filepath.Join(dir, "target"), filepath.Join(dir, "stored")
+	if err := os.WriteFile(from, have, 0o600); err != nil {
+		return "", fmt.Errorf("write temporary file: %w", err)
+	}
+	if err := os.WriteFile(to, want, 0o600); err != nil {
+		return "", fmt.Errorf("write temporary file: %w", err)
+	}
+	return diffFiles(from, to, fromLabel, toLabel)
+}
+
+func diffFiles(from, to, fromLabel, toLabel string) (string, error) {
+	cmd := exec.Command("diff", "-u", "--label", fromLabel, "--label", toLabel, from, to)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		var exitErr *exec.ExitError
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit <file>",
+	Short: "Edit a tracked file in $EDITOR",
+	Long: "Open the stored copy of a tracked file in $VISUAL or $EDITOR. Encrypted entries are\n" +
+		"decrypted to a private temporary file and re-encrypted when the editor exits.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		resolvedTarget, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+		entry, found := config.FindEntry(manifest, resolvedTarget)
+		if !found {
+			return fmt.Errorf("file not tracked: %s", resolvedTarget)
+		}
+		if !entry.IsCopy() {
+			return runEditor(entry.Source)
+		}
+
+		pipeline := render.New(home, manifest)
+		original, err := pipeline.Render(entry)
+		if err != nil {
+			return err
+		}
+		dir, err := os.MkdirTemp("", "dots-edit-*")
+		if err != nil {
+			return fmt.Errorf("create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		scratch := filepath.Join(dir, filepath.Base(entry.Target))
+		if err := dotfile.WriteCopy(scratch, original, 0o600); err != nil {
+			return err
+		}
+		if err := runEditor(scratch); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(scratch)
+		if err != nil {
+			return fmt.Errorf("read edited file: %w", err)
+		}
+		if bytes.Equal(edited, original) {
+			color.New(color.FgYellow).Printf("No changes to %s\n", entry.Target)
+			return nil
+		}
+		stored, err := pipeline.Capture(entry, edited)
+		if err != nil {
+			return err
+		}
+		if err := dotfile.WriteCopy(entry.Source, stored, 0o644); err != nil {
+			return err
+		}
+		if err := pipeline.Apply(entry); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Updated %s\n", entry.Target)
+		return nil
+	},
+}
+
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run editor: %w", err)
+	}
+	return nil
+}
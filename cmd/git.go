@@ -0,0 +1,475 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+	"github.com/subcode-labs/dots/internal/hook"
+	"github.com/subcode-labs/dots/internal/layer"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/snapshot"
+)
+
+const mutatesAnnotation = "dots.mutates"
+
+var (
+	commitMessage   string
+	pullPreview     bool
+	pullYes         bool
+	pullSkipScripts bool
+)
+
+var commitCmd = &cobra.Command{
+	Use:   "commit",
+	Short: "Commit changes in the dots repository",
+	Long: "Stage every change in the dots repository and commit it. Without -m the message\n" +
+		"summarises the entries that were added, updated or removed.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		subject, err := commitChanges(home, commitMessage)
+		if err != nil {
+			return err
+		}
+		if subject == "" {
+			color.New(color.FgYellow).Println("Nothing to commit.")
+			return nil
+		}
+		color.New(color.FgGreen).Printf("Committed: %s\n", subject)
+		return nil
+	},
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Push committed changes to the remote",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		repo, err := openRepo(home)
+		if err != nil {
+			return err
+		}
+		if err := repo.Push(); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Println("Pushed.")
+		return nil
+	},
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Pull changes from the remote and apply them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		if pullPreview {
+			pending, err := showIncoming(home)
+			if err != nil || !pending {
+				return err
+			}
+			if !pullYes && !confirm(cmd.InOrStdin(), "Pull and apply these changes?") {
+				color.New(color.FgYellow).Println("Pull cancelled.")
+				return nil
+			}
+		}
+		return pullAndApply(home, pullSkipScripts)
+	},
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Commit local changes, pull, apply and push",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		subject, err := commitChanges(home, commitMessage)
+		if err != nil {
+			return err
+		}
+		if subject != "" {
+			color.New(color.FgGreen).Printf("Committed: %s\n", subject)
+		}
+		if err := pullAndApply(home, pullSkipScripts); err != nil {
+			return err
+		}
+		repo, err := openRepo(home)
+		if err != nil {
+			return err
+		}
+		if err := repo.Push(); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Println("Pushed.")
+		return nil
+	},
+}
+
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "Manage the git remotes of the dots repository",
+}
+
+var remoteListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured remotes",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := homeRepo()
+		if err != nil {
+			return err
+		}
+		remotes, err := repo.Remotes()
+		if err != nil {
+			return err
+		}
+		if len(remotes) == 0 {
+			color.New(color.FgYellow).Println("No remotes configured.")
+			return nil
+		}
+		for _, remote := range remotes {
+			fmt.Printf("%-12s %s\n", remote.Name, remote.URL)
+		}
+		return nil
+	},
+}
+
+var remoteAddCmd = &cobra.Command{
+	Use:   "add [name] <url>",
+	Short: "Add a remote, named origin unless a name is given",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := homeRepo()
+		if err != nil {
+			return err
+		}
+		name, url := "origin", args[0]
+		if len(args) == 2 {
+			name, url = args[0], args[1]
+		}
+		if err := repo.AddRemote(name, url); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Added remote %s -> %s\n", name, url)
+		return nil
+	},
+}
+
+var remoteRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a remote",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := homeRepo()
+		if err != nil {
+			return err
+		}
+		if err := repo.RemoveRemote(args[0]); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Removed remote %s\n", args[0])
+		return nil
+	},
+}
+
+var remoteSetURLCmd = &cobra.Command{
+	Use:   "set-url <name> <url>",
+	Short: "Change the URL of a remote",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := homeRepo()
+		if err != nil {
+			return err
+		}
+		if err := repo.SetRemoteURL(args[0], args[1]); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Remote %s -> %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+func init() {
+	commitCmd.Flags().StringVarP(&commitMessage, "message", "m", "", "commit message instead of the generated summary")
+	syncCmd.Flags().StringVarP(&commitMessage, "message", "m", "", "commit message instead of the generated summary")
+	pullCmd.Flags().BoolVar(&pullPreview, "preview", false, "show incoming changes and ask before pulling")
+	pullCmd.Flags().BoolVarP(&pullYes, "yes", "y", false, "with --preview, pull without asking")
+	pullCmd.Flags().BoolVar(&pullSkipScripts, "skip-scripts", false, "apply pulled files without running the manifest scripts")
+	syncCmd.Flags().BoolVar(&pullSkipScripts, "skip-scripts", false, "apply pulled files without running the manifest scripts")
+	remoteCmd.AddCommand(remoteListCmd, remoteAddCmd, remoteRemoveCmd, remoteSetURLCmd)
+	for _, command := range []*cobra.Command{
+		addCmd, removeCmd, adoptCmd, editCmd, trashRestoreCmd, restoreCmd,
+		keysInitCmd, keysAddCmd, keysRemoveCmd, keysRekeyCmd,
+		signCmd, layersAddCmd,
+	} {
+		if command.Annotations == nil {
+			command.Annotations = map[string]string{}
+		}
+		command.Annotations[mutatesAnnotation] = "true"
+	}
+}
+
+func homeRepo() (*gitrepo.Repo, error) {
+	home, err := dotfile.HomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return openRepo(home)
+}
+
+func openRepo(home string) (*gitrepo.Repo, error) {
+	repo := gitrepo.Open(config.DotsDir(home))
+	if !repo.Exists() {
+		return nil, fmt.Errorf("%s is not a git repository, run 'dots init' first", repo.Dir)
+	}
+	return repo, nil
+}
+
+func commitChanges(home, message string) (string, error) {
+	repo, err := openRepo(home)
+	if err != nil {
+		return "", err
+	}
+	if err := repo.StageAll(); err != nil {
+		return "", err
+	}
+	changes, err := repo.StagedChanges()
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return "", nil
+	}
+	if message == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return "", err
+		}
+		old, err := manifestAt(repo, head, home)
+		if err != nil {
+			return "", err
+		}
+		current, err := config.LoadDir(repo.Dir, home)
+		if err != nil {
+			return "", err
+		}
+		message = gitrepo.Summarize(repo.Dir, home, old, current, changes).Message()
+	}
+	if err := repo.Commit(message); err != nil {
+		return "", err
+	}
+	return strings.SplitN(message, "\n", 2)[0], nil
+}
+
+func manifestAt(repo *gitrepo.Repo, rev, home string) (*config.Manifest, error) {
+	if rev == "" {
+		return nil, nil
+	}
+	data, err := repo.Show(rev, config.ManifestName)
+	if err != nil {
+		return nil, nil
+	}
+	return config.Parse(data, repo.Dir, home)
+}
+
+func pullAndApply(home string, skipScripts bool) error {
+	repo, err := openRepo(home)
+	if err != nil {
+		return err
+	}
+	_, before, err := loadStack()
+	if err != nil {
+		return err
+	}
+	oldHead, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	snap, err := pullSnapshot(home, repo, before)
+	if err != nil {
+		return err
+	}
+	stashed, err := repo.Stash()
+	if err != nil {
+		dropSnapshot(snap)
+		return fmt.Errorf("stash uncommitted changes: %w", err)
+	}
+	unstash := func() error {
+		if !stashed {
+			return nil
+		}
+		return repo.Unstash()
+	}
+	if err := repo.Pull(); err != nil {
+		dropSnapshot(snap)
+		if stashErr := unstash(); stashErr != nil {
+			return fmt.Errorf("%w (%v)", err, stashErr)
+		}
+		return err
+	}
+	newHead, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	if newHead == oldHead {
+		dropSnapshot(snap)
+		if err := unstash(); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Println("Already up to date.")
+		return nil
+	}
+	_, after, err := loadStack()
+	if err == nil {
+		err = requireSignature(after)
+	}
+	if err == nil {
+		err = enforcePolicy(after)
+	}
+	if err == nil {
+		err = config.ValidateScripts(after.Merged.Scripts)
+	}
+	if err != nil {
+		dropSnapshot(snap)
+		if oldHead != "" {
+			if resetErr := repo.ResetHard(oldHead); resetErr != nil {
+				return fmt.Errorf("%w (rolling back failed: %v)", err, resetErr)
+			}
+			color.New(color.FgYellow).Printf("Rolled back to %s\n", shortHash(oldHead))
+		}
+		if stashErr := unstash(); stashErr != nil {
+			return fmt.Errorf("%w (%v)", err, stashErr)
+		}
+		return err
+	}
+	if stashed {
+		if err := repo.Unstash(); err != nil {
+			dropSnapshot(snap)
+			return err
+		}
+		if _, after, err = loadStack(); err != nil {
+			dropSnapshot(snap)
+			return err
+		}
+	}
+	changes, err := repo.ChangedBetween(oldHead, newHead)
+	if err != nil {
+		dropSnapshot(snap)
+		return err
+	}
+	changed := map[string]bool{}
+	for _, change := range changes {
+		changed[filepath.Join(repo.Dir, filepath.FromSlash(change.Path))] = true
+	}
+	return applyPulled(home, before, after, changed, oldHead, snap, skipScripts)
+}
+
+func applyPulled(home string, before, after *layer.Stack, changed map[string]bool, oldHead string, snap *snapshot.Snapshot, skipScripts bool) error {
+	previous := map[string]config.FileEntry{}
+	for _, entry := range before.Merged.Files {
+		previous[entry.Target] = entry
+	}
+	pipeline := render.New(home, after.Merged)
+	runner, err := newHookRunner(home, after.Merged)
+	if err != nil {
+		return err
+	}
+	pending := pendingChanges(pipeline)
+	for _, entry := range after.Merged.Files {
+		old, existed := previous[entry.Target]
+		switch {
+		case !existed:
+			pending[entry.Target] = "new"
+		case old != entry || changed[entry.Source]:
+			pending[entry.Target] = "updated"
+		}
+	}
+	if err := keepSnapshot(home, pipeline, pending, snap); err != nil {
+		return err
+	}
+	targets := changedTargets(after.Merged.Files, pending)
+	if err := runner.Global(hook.PreApply, targets); err != nil {
+		return err
+	}
+	for _, entry := range after.Merged.Files {
+		err := applyWithHooks(runner, pipeline, entry, pending, func() {
+			switch pending[entry.Target] {
+			case "new":
+				color.New(color.FgGreen).Printf("New     %s -> %s%s\n", entry.Target, entry.Source, layerLabel(entry))
+			case "updated":
+				color.New(color.FgCyan).Printf("Updated %s -> %s%s\n", entry.Target, entry.Source, layerLabel(entry))
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := runner.Global(hook.PostApply, targets); err == nil {
+		runner.Global(hook.OnChange, targets)
+	}
+	if err := recordApplied(home, pipeline, before.Merged.Files, oldHead); err != nil {
+		return err
+	}
+	if !skipScripts {
+		if err := runScripts(home, after.Merged); err != nil {
+			return err
+		}
+	}
+	return runner.Err()
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+func autoCommit(cmd *cobra.Command, args []string) error {
+	if cmd.Annotations[mutatesAnnotation] == "" {
+		return nil
+	}
+	home, err := dotfile.HomeDir()
+	if err != nil {
+		return err
+	}
+	manifest, err := config.Load(home)
+	if err != nil || !manifest.Settings.AutoCommit {
+		return err
+	}
+	repo := gitrepo.Open(config.DotsDir(home))
+	if !repo.Exists() {
+		return nil
+	}
+	if _, active := repo.CheckedOut(); active {
+		return nil
+	}
+	subject, err := commitChanges(home, "")
+	if err != nil {
+		return fmt.Errorf("auto-commit: %w", err)
+	}
+	if subject != "" {
+		color.New(color.FgGreen).Printf("Committed: %s\n", subject)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+var (
+	restoreAt    string
+	checkoutBack bool
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log <file>",
+	Short: "List the commits that changed a tracked file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		history, err := loadHistory(args[0])
+		if err != nil {
+			return err
+		}
+		commits, err := history.repo.Log(history.path)
+		if err != nil {
+			return err
+		}
+		if len(commits) == 0 {
+			color.New(color.FgYellow).Printf("No commits touch %s yet.\n", history.entry.Target)
+			return nil
+		}
+		for _, commit := range commits {
+			fmt.Printf("%s  %s  %s\n", color.New(color.FgYellow).Sprint(commit.Short()), commit.Date.Local().Format("2006-01-02 15:04"), commit.Subject)
+		}
+		return nil
+	},
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show <file>@<rev|date>",
+	Short: "Print a tracked file as it was stored at a revision or date",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target, spec := args[0], "HEAD"
+		if at := strings.LastIndex(args[0], "@"); at > 0 {
+			target, spec = args[0][:at], args[0][at+1:]
+		}
+		history, err := loadHistory(target)
+		if err != nil {
+			return err
+		}
+		content, _, err := history.at(spec)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(content)
+		return err
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file> --at <rev|date>",
+	Short: "Restore a tracked file to the version stored at a revision or date",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if restoreAt == "" {
+			return fmt.Errorf("--at is required")
+		}
+		history, err := loadHistory(args[0])
+		if err != nil {
+			return err
+		}
+		hash, err := history.repo.Resolve(restoreAt)
+		if err != nil {
+			return err
+		}
+		stored, err := history.repo.Show(hash, history.path)
+		if err != nil {
+			return fmt.Errorf("%s is not stored at %s", history.entry.Target, shortHash(hash))
+		}
+		perm := os.FileMode(0o644)
+		if info, err := os.Stat(history.entry.Source); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := dotfile.WriteCopy(history.entry.Source, stored, perm); err != nil {
+			return err
+		}
+		if err := history.pipeline.Apply(history.entry); err != nil {
+			return err
+		}
+		commit, err := history.repo.Describe(hash)
+		if err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Restored %s to %s (%s, %s)\n", history.entry.Target, commit.Short(), commit.Date.Local().Format("2006-01-02 15:04"), commit.Subject)
+		return nil
+	},
+}
+
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout <rev|date>",
+	Short: "Temporarily apply the whole store as it was at a revision or date",
+	Long: "Check out the dots repository at an older revision and apply it. Run\n" +
+		"'dots checkout --back' to return to your branch and re-apply it.",
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		repo, err := openRepo(home)
+		if err != nil {
+			return err
+		}
+		if checkoutBack {
+			if len(args) > 0 {
+				return fmt.Errorf("--back takes no revision")
+			}
+			branch, err := repo.EndCheckout()
+			if err != nil {
+				return err
+			}
+			if err := applyCheckout(); err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Back on %s\n", branch)
+			return nil
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("specify a revision or date, or use --back")
+		}
+		hash, err := repo.Resolve(args[0])
+		if err != nil {
+			return err
+		}
+		if err := repo.BeginCheckout(hash); err != nil {
+			return err
+		}
+		if err := applyCheckout(); err != nil {
+			return err
+		}
+		commit, err := repo.Describe(hash)
+		if err != nil {
+			return err
+		}
+		color.New(color.FgYellow).Printf("Applied the store at %s (%s, %s), run 'dots checkout --back' to return\n", commit.Short(), commit.Date.Local().Format("2006-01-02 15:04"), commit.Subject)
+		return nil
+	},
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreAt, "at", "", "revision or date to restore, e.g. HEAD~2, 2026-10-13 or \"last tuesday\"")
+	checkoutCmd.Flags().BoolVar(&checkoutBack, "back", false, "return to the branch that was checked out before")
+}
+
+type fileHistory struct {
+	repo     *gitrepo.Repo
+	pipeline *render.Pipeline
+	entry    config.FileEntry
+	path     string
+}
+
+func loadHistory(target string) (*fileHistory, error) {
+	home, err := dotfile.HomeDir()
+	if err != nil {
+		return nil, err
+	}
+	repo, err := openRepo(home)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := config.Load(home)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := matchEntries(manifest, []string{target})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("%s matches %d files, name exactly one", target, len(entries))
+	}
+	entry := entries[0]
+	if entry.Local {
+		return nil, fmt.Errorf("%s is local-only and has no history", entry.Target)
+	}
+	rel, err := filepath.Rel(repo.Dir, entry.Source)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%s is not stored in %s", entry.Target, repo.Dir)
+	}
+	return &fileHistory{repo: repo, pipeline: render.New(home, manifest), entry: entry, path: filepath.ToSlash(rel)}, nil
+}
+
+func (h *fileHistory) at(spec string) ([]byte, string, error) {
+	hash, err := h.repo.Resolve(spec)
+	if err != nil {
+		return nil, "", err
+	}
+	stored, err := h.repo.Show(hash, h.path)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s is not stored at %s", h.entry.Target, shortHash(hash))
+	}
+	content, err := h.pipeline.Decode(h.entry, stored)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, hash, nil
+}
+
+func applyCheckout() error {
+	home, stack, err := loadStack()
+	if err != nil {
+		return err
+	}
+	if err := requireSignature(stack); err != nil {
+		return err
+	}
+	pipeline := render.New(home, stack.Merged)
+	for _, entry := range stack.Merged.Files {
+		if _, err := os.Stat(entry.Source); err != nil {
+			color.New(color.FgYellow).Printf("Skipped %s (not stored at this revision)\n", entry.Target)
+			continue
+		}
+		if err := pipeline.Apply(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/hook"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+func newHookRunner(home string, manifest *config.Manifest) (*hook.Runner, error) {
+	runner, err := hook.New(home, manifest.Hooks)
+	if err != nil {
+		return nil, err
+	}
+	runner.Report = func(result hook.Result) {
+		scope := ""
+		if result.Target != "" {
+			scope = " " + config.ContractTarget(result.Target, home)
+		}
+		if result.Err != nil {
+			color.New(color.FgRed).Printf("Hook    %s%s: %s (%v)\n", result.Event, scope, result.Command, result.Err)
+		} else {
+			color.New(color.FgCyan).Printf("Hook    %s%s: %s\n", result.Event, scope, result.Command)
+		}
+		for _, line := range strings.Split(strings.TrimRight(result.Output, "\n"), "\n") {
+			if line != "" {
+				fmt.Printf("        %s\n", line)
+			}
+		}
+	}
+	return runner, nil
+}
+
+func pendingChanges(pipeline *render.Pipeline) map[string]string {
+	changed := map[string]string{}
+	for _, entry := range pipeline.Manifest.Files {
+		status, err := pipeline.Status(entry)
+		switch {
+		case err != nil:
+			changed[entry.Target] = string(dotfile.StatusMissing)
+		case status.Status != dotfile.StatusLinked:
+			changed[entry.Target] = string(status.Status)
+		}
+	}
+	return changed
+}
+
+func changedTargets(entries []config.FileEntry, changed map[string]string) []string {
+	var targets []string
+	for _, entry := range entries {
+		if _, ok := changed[entry.Target]; ok {
+			targets = append(targets, entry.Target)
+		}
+	}
+	return targets
+}
+
+func applyWithHooks(runner *hook.Runner, pipeline *render.Pipeline, entry config.FileEntry, changed map[string]string, report func()) error {
+	status, ok := changed[entry.Target]
+	if ok {
+		if err := runner.Entry(hook.PreApply, entry, status); err != nil {
+			return err
+		}
+	}
+	if err := pipeline.Apply(entry); err != nil {
+		return err
+	}
+	report()
+	if !ok {
+		return nil
+	}
+	if err := runner.Entry(hook.PostApply, entry, status); err == nil {
+		runner.Entry(hook.OnChange, entry, status)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+var incomingCmd = &cobra.Command{
+	Use:   "incoming",
+	Short: "Show the changes a pull would bring in without merging them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		_, err = showIncoming(home)
+		return err
+	},
+}
+
+func showIncoming(home string) (bool, error) {
+	repo, err := openRepo(home)
+	if err != nil {
+		return false, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return false, err
+	}
+	upstream, err := repo.Fetch()
+	if err != nil {
+		return false, err
+	}
+	base := ""
+	if head != "" && upstream != "" {
+		if base, err = repo.MergeBase(head, upstream); err != nil {
+			return false, err
+		}
+	}
+	if upstream == "" || upstream == head || upstream == base {
+		color.New(color.FgGreen).Println("Already up to date.")
+		return false, nil
+	}
+
+	before, err := manifestAt(repo, base, home)
+	if err != nil {
+		return false, err
+	}
+	after, err := manifestAt(repo, upstream, home)
+	if err != nil {
+		return false, err
+	}
+	if after == nil {
+		after = &config.Manifest{}
+	}
+	entries := gitrepo.CompareManifests(before, after)
+	files, err := repo.ChangedBetween(base, upstream)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Incoming %s..%s\n", shortHash(base), shortHash(upstream))
+	if len(entries) > 0 {
+		fmt.Println()
+		printEntryChanges(home, entries)
+	}
+
+	encrypted := map[string]bool{}
+	for _, entry := range after.Files {
+		if entry.Encrypted {
+			encrypted[entry.Source] = true
+		}
+	}
+	affected := map[string]bool{}
+	var paths []string
+	for _, file := range files {
+		source := filepath.Join(repo.Dir, filepath.FromSlash(file.Path))
+		affected[source] = true
+		if config.IsReserved(file.Path) {
+			continue
+		}
+		if encrypted[source] {
+			color.New(color.FgCyan).Printf("\n%s changed (encrypted)\n", file.Path)
+			continue
+		}
+		paths = append(paths, file.Path)
+	}
+	if len(paths) > 0 {
+		diff, err := repo.Diff(base, upstream, paths...)
+		if err != nil {
+			return false, err
+		}
+		fmt.Println()
+		printDiff(strings.TrimRight(diff, "\n"))
+	}
+
+	for _, change := range entries {
+		if change.Kind != gitrepo.EntryAdded {
+			affected[change.Old.Source] = true
+		}
+	}
+	hidden, err := hiddenEdits(home, repo, affected)
+	if err != nil {
+		return false, err
+	}
+	if len(hidden) > 0 {
+		fmt.Println()
+		for _, target := range hidden {
+			color.New(color.FgYellow).Printf("! %s has local edits that this pull would hide\n", config.ContractTarget(target, home))
+		}
+	}
+	return true, nil
+}
+
+func printEntryChanges(home string, changes []gitrepo.EntryChange) {
+	for _, change := range changes {
+		switch change.Kind {
+		case gitrepo.EntryAdded:
+			color.New(color.FgGreen).Printf("+ %-10s %s\n", change.Kind, config.ContractTarget(change.New.Target, home))
+		case gitrepo.EntryRemoved:
+			color.New(color.FgRed).Printf("- %-10s %s\n", change.Kind, config.ContractTarget(change.Old.Target, home))
+		case gitrepo.EntryRetargeted:
+			color.New(color.FgCyan).Printf("~ %-10s %s -> %s\n", change.Kind, config.ContractTarget(change.Old.Target, home), config.ContractTarget(change.New.Target, home))
+		default:
+			color.New(color.FgCyan).Printf("~ %-10s %s\n", change.Kind, config.ContractTarget(change.New.Target, home))
+		}
+	}
+}
+
+func hiddenEdits(home string, repo *gitrepo.Repo, affected map[string]bool) ([]string, error) {
+	uncommitted, err := repo.Uncommitted()
+	if err != nil {
+		return nil, err
+	}
+	edited := map[string]bool{}
+	for _, path := range uncommitted {
+		edited[filepath.Join(repo.Dir, filepath.FromSlash(path))] = true
+	}
+	_, stack, err := loadStack()
+	if err != nil {
+		return nil, err
+	}
+	pipeline := render.New(home, stack.Merged)
+	var hidden []string
+	for _, entry := range stack.Merged.Files {
+		if !affected[entry.Source] || entry.Layer != "" {
+			continue
+		}
+		if edited[entry.Source] {
+			hidden = append(hidden, entry.Target)
+			continue
+		}
+		if !entry.IsCopy() {
+			continue
+		}
+		status, err := pipeline.Status(entry)
+		if err != nil {
+			return nil, err
+		}
+		if status.Status == dotfile.StatusDiverged {
+			hidden = append(hidden, entry.Target)
+		}
+	}
+	return hidden, nil
+}
+
+func confirm(in io.Reader, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
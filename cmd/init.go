@@ -2,27 +2,51 @@ package cmd
 
 import (
 	"fmt"
-	"os/exec"
+	"os"
+	"path/filepath"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
+	"github.com/subcode-labs/dots/internal/bootstrap"
+	"github.com/subcode-labs/dots/internal/config"
 	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+var (
+	initFrom        string
+	initDryRun      bool
+	initSkipScripts bool
 )
 
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a dots repository",
+	Long: "Initialize ~/.dots, reusing a git repository that is already there. With --from, clone an\n" +
+		"existing dots repository, back up files that would be overwritten and apply it.",
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		home, err := dotfile.HomeDir()
 		if err != nil {
 			return err
 		}
+		if initFrom != "" {
+			return initFromRepo(home, initFrom)
+		}
 		dotsDir, err := dotfile.Init(home)
 		if err != nil {
 			return err
 		}
-		if err := initGitRepo(dotsDir); err != nil {
+		if repo := gitrepo.Open(dotsDir); repo.Exists() {
+			color.New(color.FgGreen).Printf("Reusing existing git repository at %s\n", dotsDir)
+			return registerMergeDriver(home)
+		}
+		if _, err := gitrepo.Init(dotsDir); err != nil {
+			return err
+		}
+		if err := registerMergeDriver(home); err != nil {
 			return err
 		}
 		color.New(color.FgGreen).Printf("Initialized dots at %s\n", dotsDir)
@@ -30,11 +54,145 @@ var initCmd = &cobra.Command{
 	},
 }
 
-func initGitRepo(path string) error {
-	cmd := exec.Command("git", "-C", path, "init")
-	output, err := cmd.CombinedOutput()
+func init() {
+	initCmd.Flags().StringVar(&initFrom, "from", "", "clone an existing dots repository from a URL or local path and apply it")
+	initCmd.Flags().BoolVar(&initDryRun, "dry-run", false, "with --from, show the plan without changing any files in your home directory")
+	initCmd.Flags().BoolVar(&initSkipScripts, "skip-scripts", false, "with --from, apply files without running the manifest scripts")
+}
+
+func initFromRepo(home, source string) error {
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		if source, err = filepath.Abs(source); err != nil {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+	}
+	dir := config.DotsDir(home)
+	repo := gitrepo.Open(dir)
+	fresh := false
+	switch {
+	case repo.Exists():
+		remotes, err := repo.Remotes()
+		if err != nil {
+			return err
+		}
+		if !hasRemote(remotes, source) {
+			return fmt.Errorf("%s already holds a repository that was not cloned from %s", dir, source)
+		}
+		color.New(color.FgGreen).Printf("Reusing existing clone at %s\n", dir)
+	default:
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return fmt.Errorf("%s already exists and is not a git repository", dir)
+		}
+		if _, err := gitrepo.Clone(source, dir); err != nil {
+			return err
+		}
+		fresh = true
+		color.New(color.FgGreen).Printf("Cloned %s into %s\n", source, dir)
+	}
+
+	if err := registerMergeDriver(home); err != nil {
+		return err
+	}
+	steps, pipeline, err := planBootstrap(home)
+	if err != nil {
+		if fresh {
+			if removeErr := os.RemoveAll(dir); removeErr != nil {
+				return fmt.Errorf("%w (removing the clone failed: %v)", err, removeErr)
+			}
+			color.New(color.FgYellow).Printf("Removed the clone at %s\n", dir)
+		}
+		return err
+	}
+	printPlan(steps)
+	if !initSkipScripts {
+		plans, err := planScripts(home, pipeline.Manifest)
+		if err != nil {
+			return err
+		}
+		for _, plan := range plans {
+			if plan.Due() {
+				color.New(color.FgCyan).Printf("%-8s %s\n", "run", plan.Script.Name)
+			}
+		}
+	}
+	if initDryRun {
+		color.New(color.FgYellow).Println("Dry run, nothing applied. Re-run without --dry-run to apply.")
+		return nil
+	}
+
+	backupDir := bootstrap.NewBackupDir(home)
+	backedUp := 0
+	for _, step := range steps {
+		if step.Action == bootstrap.ActionKeep {
+			continue
+		}
+		if step.Action == bootstrap.ActionBackup {
+			if _, err := bootstrap.Backup(home, backupDir, step.Entry.Target); err != nil {
+				return err
+			}
+			backedUp++
+		}
+		if err := pipeline.Apply(step.Entry); err != nil {
+			return err
+		}
+	}
+	if err := recordApplied(home, pipeline, nil, ""); err != nil {
+		return err
+	}
+	if backedUp > 0 {
+		color.New(color.FgYellow).Printf("Backed up %d files to %s\n", backedUp, backupDir)
+	}
+	color.New(color.FgGreen).Printf("Applied %d files from %s\n", len(steps), source)
+	if initSkipScripts {
+		return nil
+	}
+	return runScripts(home, pipeline.Manifest)
+}
+
+func planBootstrap(home string) ([]bootstrap.Step, *render.Pipeline, error) {
+	if err := ensureManifestExists(home); err != nil {
+		return nil, nil, fmt.Errorf("repository has no %s", config.ManifestName)
+	}
+	_, stack, err := loadStack()
 	if err != nil {
-		return fmt.Errorf("init git repo: %w (%s)", err, string(output))
+		return nil, nil, err
+	}
+	if err := requireSignature(stack); err != nil {
+		return nil, nil, err
+	}
+	if err := enforcePolicy(stack); err != nil {
+		return nil, nil, err
+	}
+	pipeline := render.New(home, stack.Merged)
+	steps, err := bootstrap.Plan(pipeline, stack.Merged.Files)
+	if err != nil {
+		return nil, nil, err
+	}
+	return steps, pipeline, nil
+}
+
+func printPlan(steps []bootstrap.Step) {
+	for _, step := range steps {
+		painter := color.New(color.FgGreen)
+		switch step.Action {
+		case bootstrap.ActionKeep:
+			painter = color.New(color.FgWhite)
+		case bootstrap.ActionBackup:
+			painter = color.New(color.FgYellow)
+		}
+		line := fmt.Sprintf("%-8s %s", step.Action, step.Entry.Target)
+		if step.Info != "" {
+			line += " (" + step.Info + ")"
+		}
+		painter.Println(line)
+	}
+}
+
+func hasRemote(remotes []gitrepo.Remote, url string) bool {
+	for _, remote := range remotes {
+		if remote.URL == url {
+			return true
+		}
 	}
-	return nil
+	return false
 }
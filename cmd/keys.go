@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/crypt"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+var keysInitName string
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the keys used for encrypted entries",
+}
+
+var keysInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a local identity and add it as a recipient",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		path, err := crypt.DefaultIdentityPath()
+		if err != nil {
+			return err
+		}
+		identity, err := crypt.LoadIdentity(path)
+		if err != nil {
+			if identity, err = crypt.GenerateIdentity(); err != nil {
+				return err
+			}
+			if err := crypt.SaveIdentity(path, identity); err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Created identity %s\n", path)
+		}
+
+		key := identity.Recipient()
+		for _, recipient := range manifest.Recipients {
+			if recipient.Key == key {
+				fmt.Printf("Public key: %s (recipient %q)\n", key, recipient.Name)
+				return nil
+			}
+		}
+		name := keysInitName
+		if name == "" {
+			name = defaultRecipientName()
+		}
+		manifest.Recipients = append(manifest.Recipients, config.Recipient{Name: name, Key: key})
+		if err := config.Save(home, manifest); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Added recipient %s\n", name)
+		fmt.Printf("Public key: %s\n", key)
+		return nil
+	},
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recipients of encrypted entries",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		if len(manifest.Recipients) == 0 {
+			color.New(color.FgYellow).Println("No recipients.")
+			return nil
+		}
+		own := ""
+		if identity, err := render.New(home, manifest).Identity(); err == nil {
+			own = identity.Recipient()
+		}
+		for _, recipient := range manifest.Recipients {
+			marker := " "
+			if recipient.Key == own {
+				marker = "*"
+			}
+			fmt.Printf("%s %-20s %s\n", marker, recipient.Name, recipient.Key)
+		}
+		return nil
+	},
+}
+
+var keysAddCmd = &cobra.Command{
+	Use:   "add <name> <public-key>",
+	Short: "Grant a recipient access to encrypted entries",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		if _, err := crypt.ParseRecipient(args[1]); err != nil {
+			return err
+		}
+		for _, recipient := range manifest.Recipients {
+			if recipient.Name == args[0] {
+				return fmt.Errorf("recipient %q already exists", args[0])
+			}
+			if recipient.Key == args[1] {
+				return fmt.Errorf("key already belongs to recipient %q", recipient.Name)
+			}
+		}
+		manifest.Recipients = append(manifest.Recipients, config.Recipient{Name: args[0], Key: args[1]})
+		if err := rekeyAll(home, manifest); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Added recipient %s\n", args[0])
+		return nil
+	},
+}
+
+var keysRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Revoke a recipient's access to encrypted entries",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		kept := manifest.Recipients[:0:0]
+		for _, recipient := range manifest.Recipients {
+			if recipient.Name != args[0] {
+				kept = append(kept, recipient)
+			}
+		}
+		if len(kept) == len(manifest.Recipients) {
+			return fmt.Errorf("recipient %q not found", args[0])
+		}
+		if len(kept) == 0 && hasEncrypted(manifest) {
+			return fmt.Errorf("cannot remove the last recipient while encrypted entries exist")
+		}
+		manifest.Recipients = kept
+		if err := rekeyAll(home, manifest); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Removed recipient %s\n", args[0])
+		color.New(color.FgYellow).Println("Secrets they could read before remain in git history; rotate them if needed.")
+		return nil
+	},
+}
+
+var keysRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Re-encrypt every encrypted entry for the current recipients",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		return rekeyAll(home, manifest)
+	},
+}
+
+func init() {
+	keysInitCmd.Flags().StringVar(&keysInitName, "name", "", "recipient name (defaults to user@host)")
+	keysCmd.AddCommand(keysInitCmd)
+	keysCmd.AddCommand(keysListCmd)
+	keysCmd.AddCommand(keysAddCmd)
+	keysCmd.AddCommand(keysRemoveCmd)
+	keysCmd.AddCommand(keysRekeyCmd)
+}
+
+func rekeyAll(home string, manifest *config.Manifest) error {
+	entries, err := render.New(home, manifest).RekeyAll(func() error {
+		return config.Save(home, manifest)
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		color.New(color.FgGreen).Printf("Re-encrypted %s\n", entry.Target)
+	}
+	return nil
+}
+
+func hasEncrypted(manifest *config.Manifest) bool {
+	for _, entry := range manifest.Files {
+		if entry.Encrypted {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultRecipientName() string {
+	name := "me"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/layer"
+)
+
+var (
+	layersAddRef     string
+	layersAddTrusted bool
+)
+
+var layersCmd = &cobra.Command{
+	Use:   "layers",
+	Short: "Manage the repositories layered under your own",
+}
+
+var layersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List layers in the order they are applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, stack, err := loadStack()
+		if err != nil {
+			return err
+		}
+		for _, source := range stack.Sources {
+			winning := 0
+			for _, decision := range stack.Decisions {
+				if layer.Name(decision.Winner) == source.Name {
+					winning++
+				}
+			}
+			fmt.Printf("%-12s %3d of %3d files  %s\n", source.Name, winning, len(source.Manifest.Files), source.Dir)
+		}
+		return nil
+	},
+}
+
+var layersAddCmd = &cobra.Command{
+	Use:   "add <name> <url|path>",
+	Short: "Add a layer below your personal repository",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		entry := config.Layer{Name: args[0], Ref: layersAddRef, Trusted: layersAddTrusted}
+		if isGitURL(args[1]) {
+			entry.URL = args[1]
+		} else {
+			path, err := filepath.Abs(args[1])
+			if err != nil {
+				return fmt.Errorf("resolve path: %w", err)
+			}
+			entry.Path = config.ContractTarget(path, home)
+		}
+		if err := layer.Validate(append(manifest.Layers, entry)); err != nil {
+			return err
+		}
+		if err := layer.Sync(home, entry); err != nil {
+			return err
+		}
+		manifest.Layers = append(manifest.Layers, entry)
+		if _, err := layer.Resolve(home, manifest); err != nil {
+			return err
+		}
+		if err := config.Save(home, manifest); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Added layer %s, run 'dots apply' to link its files\n", entry.Name)
+		return nil
+	},
+}
+
+var layersUpdateCmd = &cobra.Command{
+	Use:   "update [name]...",
+	Short: "Fetch the latest version of git layers",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		updated := 0
+		for _, entry := range manifest.Layers {
+			if entry.URL == "" || (len(args) > 0 && !contains(args, entry.Name)) {
+				continue
+			}
+			if err := layer.Sync(home, entry); err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Updated %s\n", entry.Name)
+			updated++
+		}
+		if updated == 0 {
+			color.New(color.FgYellow).Println("No git layers to update.")
+		}
+		return nil
+	},
+}
+
+var whyCmd = &cobra.Command{
+	Use:   "why <target>",
+	Short: "Explain which layer provides a file and why",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, stack, err := loadStack()
+		if err != nil {
+			return err
+		}
+		target, err := filepath.Abs(args[0])
+		if err != nil {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+		decision, found := stack.Decisions[target]
+		if !found {
+			return fmt.Errorf("file not tracked by any layer: %s", target)
+		}
+		fmt.Println(target)
+		fmt.Printf("  provided by: %s (%s)\n", layer.Name(decision.Winner), config.ContractTarget(decision.Winner.Source, home))
+		fmt.Printf("  rule:        %s\n", decision.Rule)
+		var others []string
+		for _, candidate := range decision.Candidates {
+			if candidate != decision.Winner {
+				others = append(others, layer.Name(candidate))
+			}
+		}
+		if len(others) > 0 {
+			fmt.Printf("  overrides:   %s\n", strings.Join(others, ", "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	layersAddCmd.Flags().StringVar(&layersAddRef, "ref", "", "branch or tag to check out for git layers")
+	layersAddCmd.Flags().BoolVar(&layersAddTrusted, "trusted", false, "use the secret providers defined by this layer")
+	layersCmd.AddCommand(layersListCmd)
+	layersCmd.AddCommand(layersAddCmd)
+	layersCmd.AddCommand(layersUpdateCmd)
+}
+
+func loadStack() (string, *layer.Stack, error) {
+	home, err := dotfile.HomeDir()
+	if err != nil {
+		return "", nil, err
+	}
+	manifest, err := config.Load(home)
+	if err != nil {
+		return "", nil, err
+	}
+	stack, err := layer.Resolve(home, manifest)
+	if err != nil {
+		return "", nil, err
+	}
+	return home, stack, nil
+}
+
+func layerLabel(entry config.FileEntry) string {
+	if entry.Layer == "" {
+		return ""
+	}
+	return " " + color.New(color.FgCyan).Sprintf("[%s]", entry.Layer)
+}
+
+func isGitURL(value string) bool {
+	return strings.Contains(value, "://") || strings.HasPrefix(value, "git@") || strings.HasSuffix(value, ".git")
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
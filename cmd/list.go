@@ -6,23 +6,17 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
-
-	"github.com/subcode-labs/dots/internal/config"
-	"github.com/subcode-labs/dots/internal/dotfile"
 )
 
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List tracked dotfiles",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		home, err := dotfile.HomeDir()
-		if err != nil {
-			return err
-		}
-		manifest, err := config.Load(home)
+		_, stack, err := loadStack()
 		if err != nil {
 			return err
 		}
+		manifest := stack.Merged
 		if len(manifest.Files) == 0 {
 			color.New(color.FgYellow).Println("No tracked dotfiles.")
 			return nil
@@ -31,7 +25,11 @@ var listCmd = &cobra.Command{
 			return manifest.Files[i].Target < manifest.Files[j].Target
 		})
 		for _, entry := range manifest.Files {
-			fmt.Println(entry.Target)
+			if entry.Local {
+				fmt.Printf("%s %s\n", entry.Target, color.New(color.FgCyan).Sprint("(local)"))
+				continue
+			}
+			fmt.Printf("%s%s\n", entry.Target, layerLabel(entry))
 		}
 		return nil
 	},
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+)
+
+var mergeDriverCmd = &cobra.Command{
+	Use:   "merge-driver <base> <ours> <theirs> [path]",
+	Short: "Merge dots.yaml versions, called by git during merges",
+	Long: "Three-way merge of dots.yaml by entry target, following git's merge driver protocol.\n" +
+		"The result is written to <ours>. Conflicting entries are marked and the command exits\n" +
+		"non-zero so git reports the file as conflicted. 'dots init' registers the driver.",
+	Args: cobra.RangeArgs(3, 4),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var sides [3][]byte
+		for i, path := range args[:3] {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("read merge input: %w", err)
+			}
+			sides[i] = data
+		}
+		merged, conflicts, err := config.MergeManifests(sides[0], sides[1], sides[2])
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[1], merged, 0o644); err != nil {
+			return fmt.Errorf("write merge result: %w", err)
+		}
+		if len(conflicts) == 0 {
+			return nil
+		}
+		name := config.ManifestName
+		if len(args) == 4 {
+			name = args[3]
+		}
+		for _, conflict := range conflicts {
+			color.New(color.FgRed).Fprintf(os.Stderr, "CONFLICT (%s) in %s, both sides changed it differently\n", conflict, name)
+			fmt.Fprint(os.Stderr, labelled("ours", conflict.Ours), labelled("theirs", conflict.Theirs))
+		}
+		return fmt.Errorf("%d conflicts in %s", len(conflicts), name)
+	},
+}
+
+func labelled(label, encoded string) string {
+	if encoded == "" {
+		return fmt.Sprintf("  %s: (removed)\n", label)
+	}
+	return fmt.Sprintf("  %s:\n    %s\n", label, strings.ReplaceAll(strings.TrimSuffix(encoded, "\n"), "\n", "\n    "))
+}
+
+func registerMergeDriver(home string) error {
+	if err := config.WriteAttributes(home); err != nil {
+		return err
+	}
+	repo := gitrepo.Open(config.DotsDir(home))
+	if err := repo.SetConfig("merge."+config.MergeDriverName+".name", "dots manifest merge"); err != nil {
+		return err
+	}
+	return repo.SetConfig("merge."+config.MergeDriverName+".driver", driverExecutable()+" merge-driver %O %A %B %P")
+}
+
+func driverExecutable() string {
+	self, err := os.Executable()
+	if err != nil {
+		return "dots"
+	}
+	if onPath, err := exec.LookPath("dots"); err == nil {
+		a, errA := filepath.EvalSymlinks(onPath)
+		b, errB := filepath.EvalSymlinks(self)
+		if errA == nil && errB == nil && a == b {
+			return "dots"
+		}
+	}
+	return "'" + strings.ReplaceAll(self, "'", `'\''`) + "'"
+}
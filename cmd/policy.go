@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/layer"
+	"github.com/subcode-labs/dots/internal/policy"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Show and check required, locked and forbidden entries",
+}
+
+var policyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List policy rules from every layer",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, stack, err := loadStack()
+		if err != nil {
+			return err
+		}
+		rules := policy.Collect(stack).Rules()
+		if len(rules) == 0 {
+			color.New(color.FgYellow).Println("No policy rules.")
+			return nil
+		}
+		for _, rule := range rules {
+			fmt.Printf("%-9s %-40s %s\n", rule.Kind, config.ContractTarget(rule.Pattern, home), rule.Owner)
+		}
+		return nil
+	},
+}
+
+var policyCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Report policy violations",
+	Long: "Report policy violations, including required files that are not applied.\n" +
+		"Exits with status 3 when a violation is found.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, stack, err := loadStack()
+		if err != nil {
+			return err
+		}
+		violations, err := policy.Collect(stack).Check(stack)
+		if err != nil {
+			return err
+		}
+		unapplied, err := unappliedRequired(home, stack)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, unapplied...)
+		if len(violations) == 0 {
+			color.New(color.FgGreen).Println("No policy violations.")
+			return nil
+		}
+		printViolations(violations)
+		return &exitError{code: ExitPolicyViolation, err: &policy.ViolationError{Violations: violations}}
+	},
+}
+
+func init() {
+	policyCmd.AddCommand(policyListCmd)
+	policyCmd.AddCommand(policyCheckCmd)
+}
+
+func unappliedRequired(home string, stack *layer.Stack) ([]policy.Violation, error) {
+	rules := policy.Collect(stack)
+	pipeline := render.New(home, stack.Merged)
+	var violations []policy.Violation
+	for _, entry := range stack.Merged.Files {
+		rule, ok, err := rules.Match(policy.Required, entry.Target)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		status, err := pipeline.Status(entry)
+		if err != nil {
+			return nil, err
+		}
+		if status.Status != dotfile.StatusLinked {
+			violations = append(violations, policy.Violation{
+				Target: entry.Target,
+				Kind:   policy.Required,
+				Detail: fmt.Sprintf("required by policy in %s but %s, run 'dots apply'", rule.Owner, status.Status),
+			})
+		}
+	}
+	return violations, nil
+}
+
+func printViolations(violations []policy.Violation) {
+	for _, violation := range violations {
+		painter := color.New(color.FgRed)
+		if violation.Enforced {
+			painter = color.New(color.FgYellow)
+		}
+		fmt.Printf("%s %s\n", painter.Sprintf("%-9s", violation.Kind), violation)
+	}
+}
+
+func enforcePolicy(stack *layer.Stack) error {
+	violations, err := policy.Collect(stack).Check(stack)
+	if err != nil {
+		return err
+	}
+	printViolations(violations)
+	if blocking := policy.Blocking(violations); len(blocking) > 0 {
+		return &exitError{code: ExitPolicyViolation, err: &policy.ViolationError{Violations: blocking}}
+	}
+	return nil
+}
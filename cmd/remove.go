@@ -12,13 +12,29 @@ import (
 
 	"github.com/subcode-labs/dots/internal/config"
 	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/hook"
+	"github.com/subcode-labs/dots/internal/layer"
+	"github.com/subcode-labs/dots/internal/policy"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/trash"
+)
+
+var (
+	removeKeepStored bool
+	removeForget     bool
 )
 
 var removeCmd = &cobra.Command{
-	Use:   "remove <file>",
-	Short: "Remove a file from dots management",
-	Args:  cobra.ExactArgs(1),
+	Use:   "remove <file>...",
+	Short: "Remove files from dots management",
+	Long: "Remove files from dots management. Targets may be shell-style globs matched against tracked paths.\n" +
+		"The symlink is replaced with a copy of the stored file and the stored file is moved to the trash,\n" +
+		"from where 'dots trash restore' can bring it back.",
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if removeKeepStored && removeForget {
+			return fmt.Errorf("--keep-stored and --forget cannot be combined")
+		}
 		home, err := dotfile.HomeDir()
 		if err != nil {
 			return err
@@ -30,37 +46,179 @@ var removeCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		resolvedTarget, err := filepath.Abs(args[0])
+		entries, err := matchEntries(manifest, args)
 		if err != nil {
-			return fmt.Errorf("resolve path: %w", err)
-		}
-		entry, found := config.FindEntry(manifest, resolvedTarget)
-		if !found {
-			return fmt.Errorf("file not tracked: %s", resolvedTarget)
+			return err
 		}
-
-		if err := removeSymlink(entry.Target); err != nil {
+		stack, err := layer.Resolve(home, manifest)
+		if err != nil {
 			return err
 		}
-		if err := restoreFile(entry); err != nil {
+		rules := policy.Collect(stack)
+		for _, entry := range entries {
+			if err := rules.CheckRemove(stack, entry.Target); err != nil {
+				return err
+			}
+		}
+
+		runner, err := newHookRunner(home, manifest)
+		if err != nil {
 			return err
 		}
-		if removed := config.RemoveEntry(manifest, resolvedTarget); !removed {
-			return fmt.Errorf("failed to remove manifest entry for %s", resolvedTarget)
+		targets := make([]string, len(entries))
+		for i, entry := range entries {
+			targets[i] = entry.Target
 		}
-		if err := config.Save(home, manifest); err != nil {
+		if err := runner.Global(hook.PreRemove, targets); err != nil {
 			return err
 		}
-		if err := os.Remove(entry.Source); err != nil {
-			if !errors.Is(err, fs.ErrNotExist) {
-				return fmt.Errorf("remove stored file: %w", err)
+
+		var removeErr error
+		var removed []string
+		for _, entry := range entries {
+			if removeErr = runner.Entry(hook.PreRemove, entry, "removed"); removeErr != nil {
+				break
+			}
+			if removeErr = removeEntry(home, manifest, entry); removeErr != nil {
+				break
 			}
+			removed = append(removed, entry.Target)
+			if err := runner.Entry(hook.PostRemove, entry, "removed"); err == nil && !removeForget {
+				runner.Entry(hook.OnChange, entry, "removed")
+			}
+		}
+		if len(removed) > 0 {
+			if err := config.Save(home, manifest); err != nil {
+				return err
+			}
+		}
+		if err := runner.Global(hook.PostRemove, removed); err == nil && !removeForget {
+			runner.Global(hook.OnChange, removed)
 		}
-		color.New(color.FgGreen).Printf("Removed %s from dots\n", entry.Target)
-		return nil
+		if removeErr != nil {
+			return removeErr
+		}
+		return runner.Err()
 	},
 }
 
+func init() {
+	removeCmd.Flags().BoolVar(&removeKeepStored, "keep-stored", false, "stop managing the file but keep the stored copy in the dots directory")
+	removeCmd.Flags().BoolVar(&removeForget, "forget", false, "drop the manifest entry without touching the target or the stored file")
+}
+
+func matchEntries(manifest *config.Manifest, args []string) ([]config.FileEntry, error) {
+	var entries []config.FileEntry
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		pattern, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("resolve path: %w", err)
+		}
+		matched := false
+		for _, entry := range manifest.Files {
+			ok := entry.Target == pattern
+			if !ok && dotfile.HasMeta(pattern) {
+				if ok, err = dotfile.MatchPattern(pattern, entry.Target); err != nil {
+					return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+				}
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			if !seen[entry.Target] {
+				seen[entry.Target] = true
+				entries = append(entries, entry)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("file not tracked: %s", pattern)
+		}
+	}
+	return entries, nil
+}
+
+func removeEntry(home string, manifest *config.Manifest, entry config.FileEntry) error {
+	if !removeForget && entry.Block != "" {
+		removed, err := render.New(home, manifest).Detach(entry)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			color.New(color.FgYellow).Printf("Block %s was not found in %s\n", entry.Block, entry.Target)
+		}
+	}
+	if !removeForget {
+		note, err := detachTarget(entry)
+		if err != nil {
+			return err
+		}
+		if note != "" {
+			color.New(color.FgYellow).Printf("Left %s in place (%s)\n", entry.Target, note)
+		}
+		if err := dotfile.PruneEmptyDirs(filepath.Dir(entry.Target), home); err != nil {
+			return err
+		}
+	}
+	if removed := config.RemoveEntry(manifest, entry.Target); !removed {
+		return fmt.Errorf("failed to remove manifest entry for %s", entry.Target)
+	}
+
+	switch {
+	case removeForget:
+		color.New(color.FgGreen).Printf("Forgot %s\n", entry.Target)
+	case removeKeepStored:
+		color.New(color.FgGreen).Printf("Removed %s from dots (kept %s)\n", entry.Target, entry.Source)
+	default:
+		if _, err := os.Lstat(entry.Source); errors.Is(err, fs.ErrNotExist) {
+			color.New(color.FgGreen).Printf("Removed %s from dots\n", entry.Target)
+			return nil
+		}
+		item, err := trash.Move(home, entry)
+		if err != nil {
+			return err
+		}
+		if err := dotfile.PruneEmptyDirs(filepath.Dir(entry.Source), config.DotsDir(home)); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Removed %s from dots (trash id %s)\n", entry.Target, item.ID)
+	}
+	return nil
+}
+
+func detachTarget(entry config.FileEntry) (string, error) {
+	if entry.IsCopy() {
+		return "", nil
+	}
+	status, err := dotfile.LinkStatus(entry)
+	if err != nil {
+		return "", err
+	}
+	switch status.Status {
+	case dotfile.StatusConflicts:
+		return status.Info, nil
+	case dotfile.StatusLinked:
+		if err := removeSymlink(entry.Target); err != nil {
+			return "", err
+		}
+	}
+	if exists, err := storedExists(entry); err != nil || !exists {
+		return "stored file missing", err
+	}
+	return "", restoreFile(entry)
+}
+
+func storedExists(entry config.FileEntry) (bool, error) {
+	if _, err := os.Stat(entry.Source); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat stored file: %w", err)
+	}
+	return true, nil
+}
+
 func removeSymlink(target string) error {
 	info, err := os.Lstat(target)
 	if err != nil {
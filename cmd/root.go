@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"os"
 
 	"github.com/fatih/color"
@@ -13,9 +14,28 @@ var rootCmd = &cobra.Command{
 	Long:  "dots manages your dotfiles by tracking them in a ~/.dots directory and a YAML manifest.",
 }
 
+const ExitPolicyViolation = 3
+
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		color.New(color.FgRed).Fprintf(os.Stderr, "Error: %v\n", err)
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -27,6 +47,8 @@ func init() {
 	rootCmd.Version = "0.1.0"
 	rootCmd.SilenceUsage = true
 	rootCmd.SilenceErrors = true
+	rootCmd.PersistentPreRun = warnTrySession
+	rootCmd.PersistentPostRunE = autoCommit
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(addCmd)
 	rootCmd.AddCommand(statusCmd)
@@ -34,5 +56,33 @@ func init() {
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(removeCmd)
 	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(trashCmd)
+	rootCmd.AddCommand(unlinkCmd)
+	rootCmd.AddCommand(relinkCmd)
+	rootCmd.AddCommand(adoptCmd)
+	rootCmd.AddCommand(scanCmd)
+	rootCmd.AddCommand(editCmd)
+	rootCmd.AddCommand(keysCmd)
+	rootCmd.AddCommand(valuesCmd)
+	rootCmd.AddCommand(signCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(trustCmd)
+	rootCmd.AddCommand(layersCmd)
+	rootCmd.AddCommand(whyCmd)
+	rootCmd.AddCommand(policyCmd)
+	rootCmd.AddCommand(commitCmd)
+	rootCmd.AddCommand(pushCmd)
+	rootCmd.AddCommand(pullCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(remoteCmd)
+	rootCmd.AddCommand(incomingCmd)
+	rootCmd.AddCommand(mergeDriverCmd)
+	rootCmd.AddCommand(logCmd)
+	rootCmd.AddCommand(showCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(checkoutCmd)
+	rootCmd.AddCommand(tryCmd)
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(scriptsCmd)
 }
 
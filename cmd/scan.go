@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/secrets"
+)
+
+const hookMarker = "# installed by dots: secret scan"
+
+var (
+	scanStaged      bool
+	scanInstallHook bool
+	scanForce       bool
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan [file...]",
+	Short: "Scan tracked files for secrets",
+	Long: "Scan files for private keys, tokens and high-entropy credentials. Without arguments every\n" +
+		"stored file is scanned. Lines containing '" + secrets.AllowMarker + "' are ignored.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		if scanInstallHook {
+			return installSecretHook(home)
+		}
+		scanner, err := secrets.New(home, manifest.Secrets)
+		if err != nil {
+			return err
+		}
+
+		var findings []secrets.Finding
+		switch {
+		case scanStaged:
+			findings, err = scanStagedFiles(home, manifest, scanner)
+		case len(args) > 0:
+			findings, err = scanPaths(args, scanner)
+		default:
+			findings, err = scanStored(manifest, scanner)
+		}
+		if err != nil {
+			return err
+		}
+		if len(findings) == 0 {
+			color.New(color.FgGreen).Println("No secrets found.")
+			return nil
+		}
+		for _, finding := range findings {
+			color.New(color.FgRed).Println(finding.String())
+		}
+		return fmt.Errorf("found %d possible secrets (mark false positives with %q or settings in the manifest)", len(findings), secrets.AllowMarker)
+	},
+}
+
+func init() {
+	scanCmd.Flags().BoolVar(&scanStaged, "staged", false, "scan files staged for commit in the dots repository")
+	scanCmd.Flags().BoolVar(&scanInstallHook, "install-hook", false, "install a git pre-commit hook in the dots repository that runs 'dots scan --staged'")
+	scanCmd.Flags().BoolVar(&scanForce, "force", false, "overwrite an existing pre-commit hook")
+}
+
+func checkSecrets(scanner *secrets.Scanner, path, label string) error {
+	findings, err := scanner.ScanFile(path)
+	if err != nil {
+		return err
+	}
+	for i := range findings {
+		findings[i].Path = label
+	}
+	if len(findings) > 0 {
+		return &secrets.FoundError{Findings: findings}
+	}
+	return nil
+}
+
+func checkCleanedSecrets(pipeline *render.Pipeline, scanner *secrets.Scanner, entry config.FileEntry, live []byte) error {
+	cleaned, _, err := pipeline.Clean(entry, live)
+	if err != nil {
+		return err
+	}
+	if findings := scanner.Scan(entry.Target, cleaned); len(findings) > 0 {
+		return &secrets.FoundError{Findings: findings}
+	}
+	return nil
+}
+
+func scanStored(manifest *config.Manifest, scanner *secrets.Scanner) ([]secrets.Finding, error) {
+	var findings []secrets.Finding
+	for _, entry := range manifest.Files {
+		if entry.Local {
+			continue
+		}
+		content, err := os.ReadFile(entry.Source)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("read stored file: %w", err)
+		}
+		findings = append(findings, scanner.Scan(entry.Target, content)...)
+	}
+	return findings, nil
+}
+
+func scanPaths(args []string, scanner *secrets.Scanner) ([]secrets.Finding, error) {
+	var findings []secrets.Finding
+	for _, arg := range args {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("resolve path: %w", err)
+		}
+		found, err := scanner.ScanFile(path)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+func scanStagedFiles(home string, manifest *config.Manifest, scanner *secrets.Scanner) ([]secrets.Finding, error) {
+	dotsDir := config.DotsDir(home)
+	output, err := exec.Command("git", "-C", dotsDir, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR").Output()
+	if err != nil {
+		return nil, fmt.Errorf("list staged files: %w", err)
+	}
+	var findings []secrets.Finding
+	for _, name := range strings.Split(string(output), "\x00") {
+		if name == "" {
+			continue
+		}
+		content, err := exec.Command("git", "-C", dotsDir, "show", ":"+name).Output()
+		if err != nil {
+			return nil, fmt.Errorf("read staged %s: %w", name, err)
+		}
+		label := filepath.Join(dotsDir, filepath.FromSlash(name))
+		for _, entry := range manifest.Files {
+			if entry.Source == label {
+				label = entry.Target
+				break
+			}
+		}
+		findings = append(findings, scanner.Scan(label, content)...)
+	}
+	return findings, nil
+}
+
+func installSecretHook(home string) error {
+	hooksDir := filepath.Join(config.DotsDir(home), ".git", "hooks")
+	if _, err := os.Stat(filepath.Dir(hooksDir)); err != nil {
+		return fmt.Errorf("dots directory is not a git repository")
+	}
+	hookPath := filepath.Join(hooksDir, "pre-commit")
+	if existing, err := os.ReadFile(hookPath); err == nil {
+		if !strings.Contains(string(existing), hookMarker) && !scanForce {
+			return fmt.Errorf("%s already exists, use --force to replace it", hookPath)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read existing hook: %w", err)
+	}
+	if err := os.MkdirAll(hooksDir, 0o755); err != nil {
+		return fmt.Errorf("create hooks dir: %w", err)
+	}
+	script := "#!/bin/sh\n" + hookMarker + "\nexec dots scan --staged\n"
+	if err := os.WriteFile(hookPath, []byte(script), 0o755); err != nil {
+		return fmt.Errorf("write hook: %w", err)
+	}
+	color.New(color.FgGreen).Printf("Installed pre-commit hook at %s\n", dotfile.RelativePath(home, hookPath))
+	return nil
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/script"
+	"github.com/subcode-labs/dots/internal/state"
+)
+
+var scriptsCmd = &cobra.Command{
+	Use:   "scripts",
+	Short: "Show bootstrap scripts run by apply",
+}
+
+var scriptsStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which scripts the next apply will run",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, stack, err := loadStack()
+		if err != nil {
+			return err
+		}
+		plans, err := planScripts(home, stack.Merged)
+		if err != nil {
+			return err
+		}
+		if len(plans) == 0 {
+			color.New(color.FgYellow).Println("No scripts.")
+			return nil
+		}
+		for _, plan := range plans {
+			painter := color.New(color.FgYellow)
+			if !plan.Due() {
+				painter = color.New(color.FgGreen)
+			}
+			line := fmt.Sprintf("%s %-20s %-8s", painter.Sprintf("%-10s", plan.Status), plan.Script.Name, plan.Script.Mode())
+			if !plan.Last.RanAt.IsZero() {
+				line += " last ran " + plan.Last.RanAt.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Println(strings.TrimRight(line, " "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	scriptsCmd.AddCommand(scriptsStatusCmd)
+}
+
+func planScripts(home string, manifest *config.Manifest) ([]script.Plan, error) {
+	runs, err := state.LoadScriptRuns(home)
+	if err != nil {
+		return nil, err
+	}
+	return script.PlanAll(manifest.Scripts, runs)
+}
+
+func runScripts(home string, manifest *config.Manifest) error {
+	if len(manifest.Scripts) == 0 {
+		return nil
+	}
+	runs, err := state.LoadScriptRuns(home)
+	if err != nil {
+		return err
+	}
+	plans, err := script.PlanAll(manifest.Scripts, runs)
+	if err != nil {
+		return err
+	}
+	for _, plan := range plans {
+		if !plan.Due() {
+			continue
+		}
+		color.New(color.FgCyan).Printf("Running script %s (%s)\n", plan.Script.Name, plan.Status)
+		if err := script.Run(home, plan.Script, os.Stdout, os.Stderr); err != nil {
+			return err
+		}
+		script.Record(runs, plan)
+		if err := state.SaveScriptRuns(home, runs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
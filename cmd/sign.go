@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/layer"
+	"github.com/subcode-labs/dots/internal/sign"
+)
+
+var signGenerate bool
+
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign the manifest and stored files with your signing key",
+	Long: "Write dots.sig, an ed25519 signature over the manifest and the hash of every stored\n" +
+		"file. Machines that trust the key refuse to apply content that changed since.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		path, err := sign.DefaultKeyPath()
+		if err != nil {
+			return err
+		}
+		if signGenerate {
+			key, err := sign.GenerateKey()
+			if err != nil {
+				return err
+			}
+			if err := sign.SaveKey(path, key); err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Created signing key %s\n", path)
+			fmt.Printf("Public key: %s\n", sign.PublicKey(key))
+			return nil
+		}
+		key, err := sign.LoadKey(path)
+		if err != nil {
+			return err
+		}
+		dir := config.DotsDir(home)
+		if err := sign.Sign(dir, manifest, key); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Signed %s with %s\n", sign.SignaturePath(dir), sign.PublicKey(key))
+		return nil
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the signature of the dots repository against trusted keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, stack, err := loadStack()
+		if err != nil {
+			return err
+		}
+		trusted, err := loadTrusted()
+		if err != nil {
+			return err
+		}
+		if len(trusted) == 0 {
+			return fmt.Errorf("no trusted keys, add one with 'dots trust add'")
+		}
+		for _, source := range stack.Sources {
+			signer, err := verifySignature(source, trusted)
+			if err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Verified %s, signed by %s\n", source.Name, signerName(signer))
+		}
+		return nil
+	},
+}
+
+var trustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Manage the keys trusted to sign dots repositories",
+}
+
+var trustAddCmd = &cobra.Command{
+	Use:   "add <name> <key>",
+	Short: "Trust a signing key",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, key := args[0], args[1]
+		if _, err := sign.ParsePublicKey(key); err != nil {
+			return err
+		}
+		trusted, err := loadTrusted()
+		if err != nil {
+			return err
+		}
+		for _, existing := range trusted {
+			if existing.Key == key || existing.Name == name {
+				return fmt.Errorf("key %s is already trusted as %q", existing.Key, existing.Name)
+			}
+		}
+		if err := saveTrusted(append(trusted, sign.TrustedKey{Name: name, Key: key})); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Trusted %s\n", name)
+		return nil
+	},
+}
+
+var trustListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List trusted signing keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		trusted, err := loadTrusted()
+		if err != nil {
+			return err
+		}
+		if len(trusted) == 0 {
+			color.New(color.FgYellow).Println("No trusted keys.")
+			return nil
+		}
+		for _, key := range trusted {
+			fmt.Printf("%-20s %s\n", key.Name, key.Key)
+		}
+		return nil
+	},
+}
+
+var trustRemoveCmd = &cobra.Command{
+	Use:   "remove <name|key>",
+	Short: "Stop trusting a signing key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		trusted, err := loadTrusted()
+		if err != nil {
+			return err
+		}
+		kept := trusted[:0]
+		for _, key := range trusted {
+			if key.Name != args[0] && key.Key != args[0] {
+				kept = append(kept, key)
+			}
+		}
+		if len(kept) == len(trusted) {
+			return fmt.Errorf("no trusted key named %s", args[0])
+		}
+		if err := saveTrusted(kept); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Removed %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	signCmd.Flags().BoolVar(&signGenerate, "generate", false, "create a new signing key instead of signing")
+	trustCmd.AddCommand(trustAddCmd)
+	trustCmd.AddCommand(trustListCmd)
+	trustCmd.AddCommand(trustRemoveCmd)
+}
+
+func loadTrusted() ([]sign.TrustedKey, error) {
+	path, err := sign.DefaultTrustPath()
+	if err != nil {
+		return nil, err
+	}
+	return sign.LoadTrusted(path)
+}
+
+func saveTrusted(keys []sign.TrustedKey) error {
+	path, err := sign.DefaultTrustPath()
+	if err != nil {
+		return err
+	}
+	return sign.SaveTrusted(path, keys)
+}
+
+func signerName(key sign.TrustedKey) string {
+	if key.Name != "" {
+		return key.Name
+	}
+	return key.Key
+}
+
+func verifySignature(source layer.Source, trusted []sign.TrustedKey) (sign.TrustedKey, error) {
+	signer, err := sign.Verify(source.Dir, source.Manifest, trusted)
+	var changed *sign.ChangedError
+	if errors.As(err, &changed) {
+		color.New(color.FgRed).Printf("Signature check of %s failed: %v\n", source.Name, err)
+		for _, change := range changed.Changes {
+			fmt.Printf("  %-9s %s\n", change.Kind, change.Path)
+		}
+		return signer, fmt.Errorf("refusing to use unsigned changes, ask a trusted maintainer to run 'dots sign'")
+	}
+	if err != nil {
+		return signer, fmt.Errorf("%s: %w", source.Name, err)
+	}
+	return signer, nil
+}
+
+func requireSignature(stack *layer.Stack) error {
+	trusted, err := loadTrusted()
+	if err != nil || len(trusted) == 0 {
+		return err
+	}
+	for _, source := range stack.Sources {
+		if _, err := verifySignature(source, trusted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+	"github.com/subcode-labs/dots/internal/layer"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/snapshot"
+	"github.com/subcode-labs/dots/internal/state"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Create and restore snapshots of every path dots manages",
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Archive the current state of every target path",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, stack, err := loadStack()
+		if err != nil {
+			return err
+		}
+		targets, err := snapshotTargets(home, stack.Merged.Files)
+		if err != nil {
+			return err
+		}
+		snap, err := snapshot.Create(targets, config.DotsDir(home), "manual")
+		if err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Created snapshot %s (%d paths)\n", snap.ID, len(snap.Paths))
+		return nil
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snaps, err := snapshot.List()
+		if err != nil {
+			return err
+		}
+		if len(snaps) == 0 {
+			color.New(color.FgYellow).Println("No snapshots.")
+			return nil
+		}
+		for _, snap := range snaps {
+			fmt.Printf("%-20s %s  %4d paths  %8s  %s\n", snap.ID, snap.CreatedAt.Local().Format("2006-01-02 15:04"), len(snap.Paths), config.FormatSize(snap.Size), snap.Reason)
+		}
+		return nil
+	},
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Put every path in a snapshot back the way it was",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snap, err := snapshot.Restore(args[0])
+		if err != nil {
+			return err
+		}
+		for _, path := range snap.Paths {
+			switch path.Kind {
+			case snapshot.KindAbsent:
+				fmt.Printf("Removed  %s\n", path.Path)
+			default:
+				fmt.Printf("Restored %s\n", path.Path)
+			}
+		}
+		color.New(color.FgGreen).Printf("Restored snapshot %s\n", snap.ID)
+		return nil
+	},
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Delete snapshots",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, id := range args {
+			if err := snapshot.Delete(id); err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Deleted snapshot %s\n", id)
+		}
+		return nil
+	},
+}
+
+func init() {
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+}
+
+func snapshotTargets(home string, entries []config.FileEntry) ([]string, error) {
+	recorded, err := state.LoadApplied(home)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var targets []string
+	for _, entry := range entries {
+		if !seen[entry.Target] {
+			seen[entry.Target] = true
+			targets = append(targets, entry.Target)
+		}
+	}
+	for target := range recorded {
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+func autoSnapshot(home string, pipeline *render.Pipeline, reason string) error {
+	changes, err := pendingSnapshotChanges(home, pipeline, pendingChanges(pipeline))
+	if err != nil || changes == 0 {
+		return err
+	}
+	targets, err := snapshotTargets(home, pipeline.Manifest.Files)
+	if err != nil {
+		return err
+	}
+	snap, err := snapshot.Create(targets, config.DotsDir(home), reason)
+	if err != nil {
+		return err
+	}
+	announceSnapshot(snap, changes)
+	return nil
+}
+
+func pullSnapshot(home string, repo *gitrepo.Repo, before *layer.Stack) (*snapshot.Snapshot, error) {
+	if snapshot.Threshold(before.Merged.Settings.SnapshotThreshold) == 0 {
+		return nil, nil
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := repo.Fetch()
+	if err != nil || upstream == "" || upstream == head {
+		return nil, err
+	}
+	entries := append([]config.FileEntry(nil), before.Merged.Files...)
+	incoming, err := manifestAt(repo, upstream, home)
+	if err != nil {
+		return nil, err
+	}
+	if incoming != nil {
+		entries = append(entries, incoming.Files...)
+	}
+	targets, err := snapshotTargets(home, entries)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := snapshot.Create(targets, config.DotsDir(home), "pull")
+	if err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+func keepSnapshot(home string, pipeline *render.Pipeline, pending map[string]string, snap *snapshot.Snapshot) error {
+	if snap == nil {
+		return nil
+	}
+	changes, err := pendingSnapshotChanges(home, pipeline, pending)
+	if err != nil {
+		return err
+	}
+	if changes == 0 {
+		return snapshot.Delete(snap.ID)
+	}
+	announceSnapshot(*snap, changes)
+	return nil
+}
+
+func dropSnapshot(snap *snapshot.Snapshot) {
+	if snap != nil {
+		_ = snapshot.Delete(snap.ID)
+	}
+}
+
+func announceSnapshot(snap snapshot.Snapshot, changes int) {
+	color.New(color.FgCyan).Printf("Snapshot %s taken before %d changes, undo with 'dots snapshot restore %s'\n", snap.ID, changes, snap.ID)
+}
+
+func pendingSnapshotChanges(home string, pipeline *render.Pipeline, pending map[string]string) (int, error) {
+	threshold := snapshot.Threshold(pipeline.Manifest.Settings.SnapshotThreshold)
+	if threshold == 0 {
+		return 0, nil
+	}
+	current := map[string]bool{}
+	for _, entry := range pipeline.Manifest.Files {
+		current[entry.Target] = true
+	}
+	changes := len(pending)
+	recorded, err := state.LoadApplied(home)
+	if err != nil {
+		return 0, err
+	}
+	for target := range recorded {
+		if !current[target] {
+			changes++
+		}
+	}
+	if changes < threshold {
+		return 0, nil
+	}
+	return changes, nil
+}
@@ -2,50 +2,113 @@ package cmd
 
 import (
 	"fmt"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
 	"github.com/subcode-labs/dots/internal/config"
 	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+	"github.com/subcode-labs/dots/internal/render"
 )
 
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show dotfile sync status",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		home, err := dotfile.HomeDir()
+		home, stack, err := loadStack()
 		if err != nil {
 			return err
 		}
-		manifest, err := config.Load(home)
-		if err != nil {
-			return err
+		repo := gitrepo.Open(config.DotsDir(home))
+		var git *gitrepo.Status
+		if repo.Exists() {
+			if git, err = repo.Status(); err != nil {
+				return err
+			}
+			printBranch(repo, git)
 		}
+		manifest := stack.Merged
 		if len(manifest.Files) == 0 {
 			color.New(color.FgYellow).Println("No tracked dotfiles.")
-			return nil
 		}
+		pipeline := render.New(home, manifest)
 		statuses := make([]dotfile.StatusEntry, 0, len(manifest.Files))
+		referenced := map[string]bool{}
 		for _, entry := range manifest.Files {
-			status, err := dotfile.ContentStatus(entry)
+			status, err := pipeline.Status(entry)
 			if err != nil {
 				return err
 			}
 			statuses = append(statuses, status)
+			referenced[entry.Source] = true
 		}
 		sort.Slice(statuses, func(i, j int) bool {
 			return statuses[i].Entry.Target < statuses[j].Entry.Target
 		})
 		for _, status := range statuses {
-			printStatus(status)
+			printStatus(status, storeState(repo, git, status.Entry))
+		}
+		if git != nil {
+			printUnreferenced(repo, git, referenced)
 		}
 		return nil
 	},
 }
 
-func printStatus(status dotfile.StatusEntry) {
+func printBranch(repo *gitrepo.Repo, git *gitrepo.Status) {
+	if branch, active := repo.CheckedOut(); active {
+		head, _ := repo.Head()
+		color.New(color.FgYellow).Printf("Checked out %s, run 'dots checkout --back' to return to %s\n", shortHash(head), branch)
+		return
+	}
+	header := "On branch " + git.Branch
+	switch {
+	case git.Upstream == "":
+		header += ", no upstream"
+	case git.Ahead == 0 && git.Behind == 0:
+		header += fmt.Sprintf(", up to date with %s", git.Upstream)
+	default:
+		header += fmt.Sprintf(", %d ahead and %d behind %s", git.Ahead, git.Behind, git.Upstream)
+	}
+	color.New(color.FgCyan).Println(header)
+}
+
+func storeState(repo *gitrepo.Repo, git *gitrepo.Status, entry config.FileEntry) []string {
+	if git == nil || entry.Layer != "" || entry.Local {
+		return nil
+	}
+	rel, err := filepath.Rel(repo.Dir, entry.Source)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	return git.Files[filepath.ToSlash(rel)].Labels()
+}
+
+func printUnreferenced(repo *gitrepo.Repo, git *gitrepo.Status, referenced map[string]bool) {
+	var untracked []string
+	for path, state := range git.Files {
+		if !state.Untracked || config.IsReserved(strings.Split(path, "/")[0]) {
+			continue
+		}
+		if !referenced[filepath.Join(repo.Dir, filepath.FromSlash(path))] {
+			untracked = append(untracked, path)
+		}
+	}
+	if len(untracked) == 0 {
+		return
+	}
+	sort.Strings(untracked)
+	color.New(color.FgYellow).Printf("\nUntracked files in %s not referenced by the manifest:\n", repo.Dir)
+	for _, path := range untracked {
+		fmt.Printf("  %s\n", path)
+	}
+}
+
+func printStatus(status dotfile.StatusEntry, store []string) {
 	label := string(status.Status)
 	var painter *color.Color
 	info := status.Info
@@ -62,14 +125,20 @@ func printStatus(status dotfile.StatusEntry) {
 	case dotfile.StatusConflicts:
 		painter = color.New(color.FgMagenta)
 		label = "conflict"
+	case dotfile.StatusLocked:
+		painter = color.New(color.FgYellow)
 	default:
 		painter = color.New(color.FgWhite)
 	}
 
 	statusLabel := painter.Sprintf("%-9s", label)
+	suffix := ""
+	if len(store) > 0 {
+		suffix = " " + color.New(color.FgYellow).Sprintf("[%s]", strings.Join(store, ", "))
+	}
 	if info != "" {
-		fmt.Printf("%s %s (%s)\n", statusLabel, status.Entry.Target, info)
+		fmt.Printf("%s %s%s (%s)%s\n", statusLabel, status.Entry.Target, layerLabel(status.Entry), info, suffix)
 		return
 	}
-	fmt.Printf("%s %s\n", statusLabel, status.Entry.Target)
+	fmt.Printf("%s %s%s%s\n", statusLabel, status.Entry.Target, layerLabel(status.Entry), suffix)
 }
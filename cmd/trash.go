@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/trash"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Inspect and restore removed dotfiles",
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List removed dotfiles",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		items, err := trash.List(home)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			color.New(color.FgYellow).Println("Trash is empty.")
+			return nil
+		}
+		for _, item := range items {
+			fmt.Printf("%s  %s  %s\n", item.ID, item.RemovedAt.Local().Format("2006-01-02 15:04"), item.Target)
+		}
+		return nil
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <id|file>",
+	Short: "Restore a removed dotfile and track it again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		if err := ensureManifestExists(home); err != nil {
+			return err
+		}
+		item, err := findTrashItem(home, args[0])
+		if err != nil {
+			return err
+		}
+		manifest, err := config.Load(home)
+		if err != nil {
+			return err
+		}
+		if existing, found := config.FindEntry(manifest, item.Target); found {
+			return fmt.Errorf("%s is already tracked from %s", item.Target, existing.Source)
+		}
+		if err := trash.Restore(home, item); err != nil {
+			return err
+		}
+		entry := item.Entry()
+		config.UpsertEntry(manifest, entry)
+		if err := config.Save(home, manifest); err != nil {
+			return err
+		}
+
+		if _, err := os.Lstat(entry.Target); err == nil {
+			color.New(color.FgYellow).Printf("Restored %s; target exists, run 'dots apply' to relink it\n", entry.Target)
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("stat target: %w", err)
+		}
+		if err := render.New(home, manifest).Apply(entry); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Restored %s -> %s\n", entry.Target, entry.Source)
+		return nil
+	},
+}
+
+func init() {
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+}
+
+func findTrashItem(home, arg string) (trash.Item, error) {
+	if item, err := trash.Find(home, arg); err == nil {
+		return item, nil
+	}
+	target, err := filepath.Abs(arg)
+	if err != nil {
+		return trash.Item{}, fmt.Errorf("resolve path: %w", err)
+	}
+	items, err := trash.List(home)
+	if err != nil {
+		return trash.Item{}, err
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].Target == target {
+			return items[i], nil
+		}
+	}
+	return trash.Item{}, fmt.Errorf("no trash entry for %s", arg)
+}
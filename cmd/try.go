@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/gitrepo"
+	"github.com/subcode-labs/dots/internal/layer"
+	"github.com/subcode-labs/dots/internal/render"
+	"github.com/subcode-labs/dots/internal/state"
+)
+
+var tryEnd bool
+
+var tryCmd = &cobra.Command{
+	Use:   "try <branch|path>",
+	Short: "Temporarily apply another branch or dots repository",
+	Long: "Apply the entries of a branch of the dots repository, or of another dots repository on\n" +
+		"disk, on top of your home directory. Files it replaces are backed up into a session that\n" +
+		"'dots try --end' uses to restore the exact links and files you had before.",
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, err := dotfile.HomeDir()
+		if err != nil {
+			return err
+		}
+		if tryEnd {
+			if len(args) > 0 {
+				return fmt.Errorf("--end takes no arguments")
+			}
+			return endTry(home)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("specify a branch or path, or use --end")
+		}
+		return startTry(home, args[0])
+	},
+}
+
+func init() {
+	tryCmd.Flags().BoolVar(&tryEnd, "end", false, "end the try session and restore the previous files")
+}
+
+func startTry(home, source string) error {
+	session, err := state.NewSession(source)
+	if err != nil {
+		return err
+	}
+	if err := prepareTryTree(home, session, source); err != nil {
+		if closeErr := discardTry(home, session); closeErr != nil {
+			return fmt.Errorf("%w (cleaning up failed: %v)", err, closeErr)
+		}
+		return err
+	}
+	manifest, err := config.LoadDir(session.Tree, home)
+	if err == nil && len(manifest.Files) == 0 {
+		err = fmt.Errorf("%s has no tracked files", source)
+	}
+	var stack *layer.Stack
+	if err == nil {
+		stack, err = verifyTry(home, session.Tree, manifest)
+	}
+	if err != nil {
+		if closeErr := discardTry(home, session); closeErr != nil {
+			return fmt.Errorf("%w (cleaning up failed: %v)", err, closeErr)
+		}
+		return err
+	}
+
+	pipeline := render.New(home, stack.Merged)
+	for _, entry := range stack.Merged.Files {
+		capture := session.Capture
+		if entry.IsPartial() {
+			capture = session.CaptureCopy
+		}
+		if err := capture(entry.Target); err != nil {
+			return fmt.Errorf("%w, run 'dots try --end' to restore", err)
+		}
+		if err := pipeline.Apply(entry); err != nil {
+			return fmt.Errorf("%w, run 'dots try --end' to restore", err)
+		}
+		color.New(color.FgCyan).Printf("Trying %s -> %s\n", entry.Target, entry.Source)
+	}
+	color.New(color.FgYellow).Printf("Trying %s, run 'dots try --end' to restore your files\n", source)
+	return nil
+}
+
+func verifyTry(home, tree string, manifest *config.Manifest) (*layer.Stack, error) {
+	stack, err := layer.Resolve(home, manifest)
+	if err != nil {
+		return nil, err
+	}
+	stack.Sources[len(stack.Sources)-1].Dir = tree
+	if err := requireSignature(stack); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(stack); err != nil {
+		return nil, err
+	}
+	return stack, nil
+}
+
+func prepareTryTree(home string, session *state.Session, source string) error {
+	if info, err := os.Stat(filepath.Join(source, config.ManifestName)); err == nil && !info.IsDir() {
+		tree, err := filepath.Abs(source)
+		if err != nil {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+		session.Tree = tree
+		return session.Save()
+	}
+	repo, err := openRepo(home)
+	if err != nil {
+		return err
+	}
+	_, _ = repo.Fetch()
+	hash, ok := repo.Revision(source)
+	if !ok {
+		if hash, ok = repo.Revision("origin/" + source); !ok {
+			return fmt.Errorf("%s is neither a branch of the dots repository nor a dots repository on disk", source)
+		}
+	}
+	session.Tree = filepath.Join(session.Dir(), "tree")
+	session.Revision = hash
+	session.Worktree = true
+	if err := repo.AddWorktree(session.Tree, hash); err != nil {
+		return err
+	}
+	return session.Save()
+}
+
+func discardTry(home string, session *state.Session) error {
+	if session.Worktree {
+		if err := gitrepo.Open(config.DotsDir(home)).RemoveWorktree(session.Tree); err != nil {
+			return err
+		}
+	}
+	return session.Close()
+}
+
+func endTry(home string) error {
+	session, err := state.LoadSession()
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		color.New(color.FgYellow).Println("No try session is active.")
+		return nil
+	}
+	restored := len(session.Priors)
+	if err := session.Restore(); err != nil {
+		return err
+	}
+	if err := discardTry(home, session); err != nil {
+		return err
+	}
+	color.New(color.FgGreen).Printf("Ended try of %s, restored %d files\n", session.Source, restored)
+	return nil
+}
+
+func warnTrySession(cmd *cobra.Command, args []string) {
+	if cmd == tryCmd {
+		return
+	}
+	session, err := state.LoadSession()
+	if err != nil || session == nil {
+		return
+	}
+	note := ""
+	if session.SurvivedReboot() {
+		note = ", left open across a reboot"
+	}
+	color.New(color.FgYellow).Fprintf(os.Stderr, "Warning: trying %s since %s%s, run 'dots try --end' to restore your files\n",
+		session.Source, session.StartedAt.Local().Format("2006-01-02 15:04"), note)
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+)
+
+var (
+	unlinkAll   bool
+	relinkAll   bool
+	relinkForce bool
+)
+
+var unlinkCmd = &cobra.Command{
+	Use:   "unlink [file...]",
+	Short: "Replace symlinks with real copies of the stored files",
+	Long: "Replace managed symlinks with real copies of the stored files. The manifest and the\n" +
+		"dots directory are left intact so 'dots relink' can undo it.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		entries, err := selectEntries(manifest, args, unlinkAll)
+		if err != nil {
+			return err
+		}
+
+		var unlinked, skipped int
+		for _, entry := range entries {
+			if entry.IsCopy() {
+				skipped++
+				continue
+			}
+			status, err := dotfile.LinkStatus(entry)
+			if err != nil {
+				return err
+			}
+			if status.Status != dotfile.StatusLinked {
+				skipped++
+				if status.Status == dotfile.StatusConflicts {
+					color.New(color.FgYellow).Printf("Skipped %s (%s)\n", entry.Target, status.Info)
+				}
+				continue
+			}
+			if err := removeSymlink(entry.Target); err != nil {
+				return err
+			}
+			if exists, err := storedExists(entry); err != nil {
+				return err
+			} else if !exists {
+				color.New(color.FgYellow).Printf("Removed dangling link %s (stored file missing)\n", entry.Target)
+				unlinked++
+				continue
+			}
+			if err := restoreFile(entry); err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Unlinked %s\n", entry.Target)
+			unlinked++
+		}
+		fmt.Printf("%d unlinked, %d unchanged\n", unlinked, skipped)
+		return nil
+	},
+}
+
+var relinkCmd = &cobra.Command{
+	Use:   "relink [file...]",
+	Short: "Replace unlinked copies with symlinks again",
+	Long: "Replace real copies left by 'dots unlink' with symlinks to the stored files. Copies whose\n" +
+		"content no longer matches the stored file are skipped unless --force is given.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		entries, err := selectEntries(manifest, args, relinkAll)
+		if err != nil {
+			return err
+		}
+
+		var relinked, unchanged, skipped int
+		for _, entry := range entries {
+			if entry.IsCopy() {
+				unchanged++
+				continue
+			}
+			status, err := dotfile.LinkStatus(entry)
+			if err != nil {
+				return err
+			}
+			if status.Status == dotfile.StatusLinked {
+				unchanged++
+				continue
+			}
+			if exists, err := storedExists(entry); err != nil {
+				return err
+			} else if !exists {
+				color.New(color.FgYellow).Printf("Skipped %s (stored file missing)\n", entry.Target)
+				skipped++
+				continue
+			}
+			if status.Status == dotfile.StatusConflicts && !relinkForce {
+				same, err := dotfile.SameContent(entry.Source, entry.Target)
+				if err != nil {
+					return err
+				}
+				if !same {
+					color.New(color.FgYellow).Printf("Skipped %s (%s, content differs; use --force)\n", entry.Target, status.Info)
+					skipped++
+					continue
+				}
+			}
+			if err := dotfile.EnsureSymlink(entry.Target, entry.Source); err != nil {
+				return err
+			}
+			color.New(color.FgGreen).Printf("Linked %s -> %s\n", entry.Target, entry.Source)
+			relinked++
+		}
+		fmt.Printf("%d relinked, %d unchanged, %d skipped\n", relinked, unchanged, skipped)
+		return nil
+	},
+}
+
+func init() {
+	unlinkCmd.Flags().BoolVar(&unlinkAll, "all", false, "unlink every tracked file")
+	relinkCmd.Flags().BoolVar(&relinkAll, "all", false, "relink every tracked file")
+	relinkCmd.Flags().BoolVar(&relinkForce, "force", false, "replace targets even when their content differs from the stored file")
+}
+
+func loadManifest() (string, *config.Manifest, error) {
+	home, err := dotfile.HomeDir()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := ensureManifestExists(home); err != nil {
+		return "", nil, err
+	}
+	manifest, err := config.Load(home)
+	if err != nil {
+		return "", nil, err
+	}
+	return home, manifest, nil
+}
+
+func selectEntries(manifest *config.Manifest, args []string, all bool) ([]config.FileEntry, error) {
+	if all {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("--all cannot be combined with file arguments")
+		}
+		return manifest.Files, nil
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("specify files or use --all")
+	}
+	return matchEntries(manifest, args)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/subcode-labs/dots/internal/filter"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+var valuesCmd = &cobra.Command{
+	Use:   "values",
+	Short: "Manage local values filled into filtered files",
+	Long: "Manage the local, uncommitted values that replace placeholders such as\n" +
+		filter.Placeholder("signing_key") + " when filtered files are applied.",
+}
+
+var valuesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List local value names",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		values, err := render.New(home, manifest).Values()
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			color.New(color.FgYellow).Println("No local values.")
+			return nil
+		}
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	},
+}
+
+var valuesSetCmd = &cobra.Command{
+	Use:   "set <name> [value|-]",
+	Short: "Set a local value (reads stdin when the value is '-' or omitted)",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		home, manifest, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		value := ""
+		if len(args) == 2 && args[1] != "-" {
+			value = args[1]
+		} else {
+			reader := bufio.NewReader(cmd.InOrStdin())
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("read value from stdin: %w", err)
+			}
+			value = strings.TrimRight(line, "\r\n")
+		}
+		if err := render.New(home, manifest).SetValues(filter.Values{args[0]: value}); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Set %s, run 'dots apply' to update filtered files\n", args[0])
+		return nil
+	},
+}
+
+var valuesUnsetCmd = &cobra.Command{
+	Use:   "unset <name>",
+	Short: "Remove a local value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filter.DefaultValuesPath()
+		if err != nil {
+			return err
+		}
+		values, err := filter.LoadValues(path)
+		if err != nil {
+			return err
+		}
+		if _, ok := values[args[0]]; !ok {
+			return fmt.Errorf("value %q not set", args[0])
+		}
+		delete(values, args[0])
+		if err := filter.SaveValues(path, values); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("Unset %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	valuesCmd.AddCommand(valuesListCmd)
+	valuesCmd.AddCommand(valuesSetCmd)
+	valuesCmd.AddCommand(valuesUnsetCmd)
+}
@@ -0,0 +1,103 @@
+package block
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func ValidName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid block name %q, use letters, digits, '.', '_' or '-'", name)
+	}
+	return nil
+}
+
+func Markers(name string) (string, string) {
+	return "# BEGIN dots:" + name, "# END dots:" + name
+}
+
+type region struct {
+	start, inner, innerEnd, end int
+}
+
+func find(content []byte, name string) (region, bool, error) {
+	begin, end := Markers(name)
+	var r region
+	found := false
+	offset := 0
+	for offset < len(content) {
+		lineEnd := bytes.IndexByte(content[offset:], '\n')
+		next := len(content)
+		if lineEnd >= 0 {
+			next = offset + lineEnd + 1
+		}
+		line := string(bytes.TrimRight(content[offset:next], "\r\n"))
+		switch {
+		case line == begin:
+			if found {
+				return region{}, false, fmt.Errorf("block %s appears more than once", name)
+			}
+			found = true
+			r = region{start: offset, inner: next, innerEnd: -1}
+		case line == end:
+			if !found || r.innerEnd >= 0 {
+				return region{}, false, fmt.Errorf("block %s has an end marker without a begin marker", name)
+			}
+			r.innerEnd, r.end = offset, next
+		}
+		offset = next
+	}
+	if found && r.innerEnd < 0 {
+		return region{}, false, fmt.Errorf("block %s has no end marker", name)
+	}
+	return r, found, nil
+}
+
+func Extract(content []byte, name string) ([]byte, bool, error) {
+	r, found, err := find(content, name)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return append([]byte(nil), content[r.inner:r.innerEnd]...), true, nil
+}
+
+func Replace(content []byte, name string, body []byte) ([]byte, error) {
+	r, found, err := find(content, name)
+	if err != nil {
+		return nil, err
+	}
+	begin, end := Markers(name)
+	var section bytes.Buffer
+	section.WriteString(begin + "\n")
+	section.Write(body)
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		section.WriteByte('\n')
+	}
+	section.WriteString(end + "\n")
+
+	var out bytes.Buffer
+	if found {
+		out.Write(content[:r.start])
+		out.Write(section.Bytes())
+		out.Write(content[r.end:])
+		return out.Bytes(), nil
+	}
+	out.Write(content)
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	out.Write(section.Bytes())
+	return out.Bytes(), nil
+}
+
+func Remove(content []byte, name string) ([]byte, bool, error) {
+	r, found, err := find(content, name)
+	if err != nil || !found {
+		return content, false, err
+	}
+	out := append(append([]byte(nil), content[:r.start]...), content[r.end:]...)
+	return out, true, nil
+}
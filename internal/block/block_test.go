@@ -0,0 +1,61 @@
+package block
+
+import (
+	"testing"
+)
+
+func TestReplaceInsertsAndUpdates(t *testing.T) {
+	original := []byte("export PATH=/opt/bin:$PATH\n# company settings")
+	inserted, err := Replace(original, "aliases", []byte("alias ll='ls -l'"))
+	if err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	want := "export PATH=/opt/bin:$PATH\n# company settings\n# BEGIN dots:aliases\nalias ll='ls -l'\n# END dots:aliases\n"
+	if string(inserted) != want {
+		t.Errorf("inserted = %q, want %q", inserted, want)
+	}
+
+	edited := append(inserted, []byte("echo after\n")...)
+	updated, err := Replace(edited, "aliases", []byte("alias la='ls -a'\n"))
+	if err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	want = "export PATH=/opt/bin:$PATH\n# company settings\n# BEGIN dots:aliases\nalias la='ls -a'\n# END dots:aliases\necho after\n"
+	if string(updated) != want {
+		t.Errorf("updated = %q, want %q", updated, want)
+	}
+
+	region, found, err := Extract(updated, "aliases")
+	if err != nil || !found || string(region) != "alias la='ls -a'\n" {
+		t.Errorf("Extract = %q, %v, %v", region, found, err)
+	}
+	if _, found, err := Extract(updated, "other"); err != nil || found {
+		t.Errorf("Extract of a missing block = %v, %v", found, err)
+	}
+
+	removed, ok, err := Remove(updated, "aliases")
+	if err != nil || !ok {
+		t.Fatalf("Remove = %v, %v", ok, err)
+	}
+	if string(removed) != "export PATH=/opt/bin:$PATH\n# company settings\necho after\n" {
+		t.Errorf("removed = %q", removed)
+	}
+}
+
+func TestMalformedBlocks(t *testing.T) {
+	for _, content := range []string{
+		"# BEGIN dots:a\nx\n",
+		"x\n# END dots:a\n",
+		"# BEGIN dots:a\n# END dots:a\n# BEGIN dots:a\n# END dots:a\n",
+	} {
+		if _, _, err := Extract([]byte(content), "a"); err == nil {
+			t.Errorf("Extract(%q) succeeded", content)
+		}
+	}
+	if err := ValidName("ssh config"); err == nil {
+		t.Error("ValidName accepted a space")
+	}
+	if err := ValidName("vpn.hosts"); err != nil {
+		t.Errorf("ValidName rejected vpn.hosts: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package bootstrap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+const BackupDirName = ".dots-backup"
+
+type Action string
+
+const (
+	ActionCreate  Action = "create"
+	ActionKeep    Action = "keep"
+	ActionReplace Action = "replace"
+	ActionBackup  Action = "backup"
+)
+
+type Step struct {
+	Entry  config.FileEntry
+	Action Action
+	Info   string
+}
+
+func Plan(pipeline *render.Pipeline, entries []config.FileEntry) ([]Step, error) {
+	var steps []Step
+	for _, entry := range entries {
+		step, err := plan(pipeline, entry)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func plan(pipeline *render.Pipeline, entry config.FileEntry) (Step, error) {
+	if _, err := os.Stat(entry.Source); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Step{}, fmt.Errorf("stored file for %s is missing from the repository", entry.Target)
+		}
+		return Step{}, fmt.Errorf("stat stored file: %w", err)
+	}
+	if entry.IsPartial() {
+		return planPartial(pipeline, entry)
+	}
+	info, err := os.Lstat(entry.Target)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Step{Entry: entry, Action: ActionCreate}, nil
+		}
+		return Step{}, fmt.Errorf("stat target: %w", err)
+	}
+	if info.IsDir() {
+		return Step{}, fmt.Errorf("target %s is a directory", entry.Target)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(entry.Target)
+		if err != nil {
+			return Step{}, fmt.Errorf("read symlink: %w", err)
+		}
+		if !entry.IsCopy() && link == entry.Source {
+			return Step{Entry: entry, Action: ActionKeep}, nil
+		}
+		return Step{Entry: entry, Action: ActionBackup, Info: "links to " + link}, nil
+	}
+	same, err := sameContent(pipeline, entry)
+	if err != nil {
+		return Step{}, err
+	}
+	switch {
+	case same && entry.IsCopy():
+		return Step{Entry: entry, Action: ActionKeep}, nil
+	case same:
+		return Step{Entry: entry, Action: ActionReplace, Info: "identical content"}, nil
+	}
+	return Step{Entry: entry, Action: ActionBackup, Info: "different content"}, nil
+}
+
+func planPartial(pipeline *render.Pipeline, entry config.FileEntry) (Step, error) {
+	status, err := pipeline.Status(entry)
+	if err != nil {
+		return Step{}, err
+	}
+	switch status.Status {
+	case dotfile.StatusLinked:
+		return Step{Entry: entry, Action: ActionKeep}, nil
+	case dotfile.StatusMissing:
+		return Step{Entry: entry, Action: ActionCreate, Info: partialInfo(entry)}, nil
+	}
+	return Step{Entry: entry, Action: ActionReplace, Info: partialInfo(entry)}, nil
+}
+
+func partialInfo(entry config.FileEntry) string {
+	if entry.Merge {
+		return "merge managed keys"
+	}
+	return "block " + entry.Block
+}
+
+func sameContent(pipeline *render.Pipeline, entry config.FileEntry) (bool, error) {
+	if !entry.IsCopy() {
+		return dotfile.SameContent(entry.Source, entry.Target)
+	}
+	want, err := pipeline.Render(entry)
+	if err != nil {
+		return false, err
+	}
+	have, err := os.ReadFile(entry.Target)
+	if err != nil {
+		return false, fmt.Errorf("read target: %w", err)
+	}
+	return bytes.Equal(have, want), nil
+}
+
+func NewBackupDir(home string) string {
+	return filepath.Join(home, BackupDirName, time.Now().UTC().Format("20060102T150405"))
+}
+
+func Backup(home, dir, target string) (string, error) {
+	rel, err := filepath.Rel(home, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Join("_root", strings.TrimPrefix(target, filepath.VolumeName(target)))
+	}
+	destination := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(destination), 0o700); err != nil {
+		return "", fmt.Errorf("create backup directory: %w", err)
+	}
+	if err := os.Rename(target, destination); err != nil {
+		return "", fmt.Errorf("back up %s: %w", target, err)
+	}
+	return destination, nil
+}
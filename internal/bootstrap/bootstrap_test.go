@@ -0,0 +1,91 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/render"
+)
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	home := t.TempDir()
+	dir := config.DotsDir(home)
+	entry := func(name string) config.FileEntry {
+		write(t, filepath.Join(dir, name), name+"\n")
+		return config.FileEntry{Source: filepath.Join(dir, name), Target: filepath.Join(home, name)}
+	}
+	fresh := entry(".bashrc")
+	linked := entry(".vimrc")
+	if err := os.Symlink(linked.Source, linked.Target); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	identical := entry(".zshrc")
+	write(t, identical.Target, ".zshrc\n")
+	conflict := entry(".gitconfig")
+	write(t, conflict.Target, "[user]\n")
+	elsewhere := entry(".inputrc")
+	if err := os.Symlink("/etc/inputrc", elsewhere.Target); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	manifest := &config.Manifest{Files: []config.FileEntry{fresh, linked, identical, conflict, elsewhere}}
+	steps, err := Plan(render.New(home, manifest), manifest.Files)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	want := []Action{ActionCreate, ActionKeep, ActionReplace, ActionBackup, ActionBackup}
+	for i, step := range steps {
+		if step.Action != want[i] {
+			t.Errorf("%s: action = %s, want %s", step.Entry.Target, step.Action, want[i])
+		}
+	}
+
+	missing := config.FileEntry{Source: filepath.Join(dir, ".missing"), Target: filepath.Join(home, ".missing")}
+	if _, err := Plan(render.New(home, manifest), []config.FileEntry{missing}); err == nil {
+		t.Error("Plan should fail when a stored file is missing")
+	}
+}
+
+func TestBackup(t *testing.T) {
+	home := t.TempDir()
+	target := filepath.Join(home, ".config", "app", "config")
+	write(t, target, "mine\n")
+	dir := NewBackupDir(home)
+	destination, err := Backup(home, dir, target)
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if want := filepath.Join(dir, ".config", "app", "config"); destination != want {
+		t.Errorf("destination = %s, want %s", destination, want)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("target still present: %v", err)
+	}
+	data, err := os.ReadFile(destination)
+	if err != nil || string(data) != "mine\n" {
+		t.Errorf("backup content = %q, %v", data, err)
+	}
+
+	outside := filepath.Join(t.TempDir(), "file")
+	write(t, outside, "x")
+	destination, err = Backup(home, dir, outside)
+	if err != nil {
+		t.Fatalf("Backup outside home failed: %v", err)
+	}
+	if !strings.HasPrefix(destination, filepath.Join(dir, "_root")) {
+		t.Errorf("outside destination = %s", destination)
+	}
+}
@@ -6,22 +6,135 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 const (
-	DirName      = ".dots"
-	ManifestName = "dots.yaml"
+	DirName           = ".dots"
+	ManifestName      = "dots.yaml"
+	LocalManifestName = "dots.local.yaml"
+	IgnoreFileName    = ".gitignore"
+	AttributesName    = ".gitattributes"
+	SignatureName     = "dots.sig"
+	TrashDirName      = ".trash"
+	LayersDirName     = ".layers"
 )
 
+var reservedNames = []string{".git", ManifestName, LocalManifestName, IgnoreFileName, AttributesName, SignatureName, TrashDirName, LayersDirName}
+
 type Manifest struct {
-	Files []FileEntry `yaml:"files"`
+	Settings   Settings                `yaml:"settings,omitempty"`
+	Secrets    SecretsConfig           `yaml:"secrets,omitempty"`
+	Recipients []Recipient             `yaml:"recipients,omitempty"`
+	Filters    map[string][]FilterRule `yaml:"filters,omitempty"`
+	Providers  []ProviderConfig        `yaml:"providers,omitempty"`
+	Layers     []Layer                 `yaml:"layers,omitempty"`
+	Overrides  []Override              `yaml:"overrides,omitempty"`
+	Policy     Policy                  `yaml:"policy,omitempty"`
+	Hooks      Hooks                   `yaml:"hooks,omitempty"`
+	Scripts    []Script                `yaml:"scripts,omitempty"`
+	Files      []FileEntry             `yaml:"files"`
+}
+
+type Settings struct {
+	MaxFileSize       string `yaml:"max_file_size,omitempty"`
+	AutoCommit        bool   `yaml:"auto_commit,omitempty"`
+	SnapshotThreshold int    `yaml:"snapshot_threshold,omitempty"`
+}
+
+type SecretsConfig struct {
+	Rules      []SecretRule `yaml:"rules,omitempty"`
+	Allow      []string     `yaml:"allow,omitempty"`
+	AllowPaths []string     `yaml:"allow_paths,omitempty"`
+}
+
+type SecretRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
 }
 
 type FileEntry struct {
-	Source string `yaml:"source"`
+	Source    string `yaml:"source"`
+	Target    string `yaml:"target"`
+	Encrypted bool   `yaml:"encrypted,omitempty"`
+	Filter    string `yaml:"filter,omitempty"`
+	Template  bool   `yaml:"template,omitempty"`
+	Block     string `yaml:"block,omitempty"`
+	Merge     bool   `yaml:"merge,omitempty"`
+	Arrays    string `yaml:"arrays,omitempty"`
+	Local     bool   `yaml:"-"`
+	Layer     string `yaml:"-"`
+}
+
+func (e FileEntry) IsCopy() bool {
+	return e.Encrypted || e.Filter != "" || e.Template || e.IsPartial()
+}
+
+func (e FileEntry) IsPartial() bool {
+	return e.Block != "" || e.Merge
+}
+
+type FilterRule struct {
+	Pattern     string `yaml:"pattern"`
+	Placeholder string `yaml:"placeholder,omitempty"`
+	Secret      string `yaml:"secret,omitempty"`
+}
+
+type ProviderConfig struct {
+	Type    string `yaml:"type"`
+	Match   string `yaml:"match,omitempty"`
+	Prefix  string `yaml:"prefix,omitempty"`
+	Path    string `yaml:"path,omitempty"`
+	Command string `yaml:"command,omitempty"`
+}
+
+type Layer struct {
+	Name    string `yaml:"name"`
+	Path    string `yaml:"path,omitempty"`
+	URL     string `yaml:"url,omitempty"`
+	Ref     string `yaml:"ref,omitempty"`
+	Trusted bool   `yaml:"trusted,omitempty"`
+}
+
+type Override struct {
 	Target string `yaml:"target"`
+	Layer  string `yaml:"layer"`
+}
+
+type Policy struct {
+	Required  []string `yaml:"required,omitempty"`
+	Locked    []string `yaml:"locked,omitempty"`
+	Forbidden []string `yaml:"forbidden,omitempty"`
+}
+
+type HookSet struct {
+	PreApply   []string `yaml:"pre_apply,omitempty"`
+	PostApply  []string `yaml:"post_apply,omitempty"`
+	PreAdd     []string `yaml:"pre_add,omitempty"`
+	PostAdd    []string `yaml:"post_add,omitempty"`
+	PreRemove  []string `yaml:"pre_remove,omitempty"`
+	PostRemove []string `yaml:"post_remove,omitempty"`
+	OnChange   []string `yaml:"on_change,omitempty"`
+}
+
+type Hooks struct {
+	HookSet `yaml:",inline"`
+	Timeout string      `yaml:"timeout,omitempty"`
+	Files   []FileHooks `yaml:"files,omitempty"`
+}
+
+type FileHooks struct {
+	Target  string `yaml:"target"`
+	HookSet `yaml:",inline"`
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+type Recipient struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
 }
 
 func DotsDir(home string) string {
@@ -32,6 +145,19 @@ func ManifestPath(home string) string {
 	return filepath.Join(DotsDir(home), ManifestName)
 }
 
+func LocalManifestPath(home string) string {
+	return filepath.Join(DotsDir(home), LocalManifestName)
+}
+
+func IsReserved(name string) bool {
+	for _, reserved := range reservedNames {
+		if name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
 func EnsureDotsDir(home string) (string, error) {
 	path := DotsDir(home)
 	if err := os.MkdirAll(path, 0o755); err != nil {
@@ -41,14 +167,30 @@ func EnsureDotsDir(home string) (string, error) {
 }
 
 func Load(home string) (*Manifest, error) {
-	manifestPath := ManifestPath(home)
-	data, err := os.ReadFile(manifestPath)
+	manifest, err := LoadDir(DotsDir(home), home)
+	if err != nil {
+		return nil, err
+	}
+	local, err := loadLocal(home)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Files = append(manifest.Files, local...)
+	return manifest, nil
+}
+
+func LoadDir(dir, home string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return &Manifest{Files: []FileEntry{}}, nil
 		}
 		return nil, fmt.Errorf("read manifest: %w", err)
 	}
+	return Parse(data, dir, home)
+}
+
+func Parse(data []byte, dir, home string) (*Manifest, error) {
 	var manifest Manifest
 	if err := yaml.Unmarshal(data, &manifest); err != nil {
 		return nil, fmt.Errorf("parse manifest: %w", err)
@@ -56,11 +198,70 @@ func Load(home string) (*Manifest, error) {
 	if manifest.Files == nil {
 		manifest.Files = []FileEntry{}
 	}
+	expandEntries(manifest.Files, dir, home)
+	for i := range manifest.Overrides {
+		manifest.Overrides[i].Target = ExpandTarget(manifest.Overrides[i].Target, home)
+	}
+	for i := range manifest.Hooks.Files {
+		manifest.Hooks.Files[i].Target = ExpandTarget(manifest.Hooks.Files[i].Target, home)
+	}
+	expandScripts(manifest.Scripts, dir, home)
+	manifest.Policy = mapPolicy(manifest.Policy, func(target string) string { return ExpandTarget(target, home) })
 	return &manifest, nil
 }
 
+type localManifest struct {
+	Files []FileEntry `yaml:"files"`
+}
+
+func loadLocal(home string) ([]FileEntry, error) {
+	data, err := os.ReadFile(LocalManifestPath(home))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read local manifest: %w", err)
+	}
+	var local localManifest
+	if err := yaml.Unmarshal(data, &local); err != nil {
+		return nil, fmt.Errorf("parse local manifest: %w", err)
+	}
+	expandEntries(local.Files, DotsDir(home), home)
+	for i := range local.Files {
+		local.Files[i].Local = true
+	}
+	return local.Files, nil
+}
+
 func Save(home string, manifest *Manifest) error {
-	data, err := yaml.Marshal(manifest)
+	shared := *manifest
+	shared.Files = []FileEntry{}
+	shared.Overrides = nil
+	var local []FileEntry
+	for _, entry := range manifest.Files {
+		if entry.Layer != "" {
+			continue
+		}
+		if entry.Local {
+			local = append(local, entry)
+		} else {
+			shared.Files = append(shared.Files, entry)
+		}
+	}
+	for _, override := range manifest.Overrides {
+		override.Target = ContractTarget(override.Target, home)
+		shared.Overrides = append(shared.Overrides, override)
+	}
+	shared.Hooks.Files = nil
+	for _, hooks := range manifest.Hooks.Files {
+		hooks.Target = ContractTarget(hooks.Target, home)
+		shared.Hooks.Files = append(shared.Hooks.Files, hooks)
+	}
+	shared.Scripts = contractScripts(manifest.Scripts, DotsDir(home), home)
+	shared.Files = contractEntries(shared.Files, DotsDir(home), home)
+	shared.Policy = mapPolicy(manifest.Policy, func(target string) string { return ContractTarget(target, home) })
+
+	data, err := yaml.Marshal(&shared)
 	if err != nil {
 		return fmt.Errorf("encode manifest: %w", err)
 	}
@@ -68,6 +269,89 @@ func Save(home string, manifest *Manifest) error {
 	if err := os.WriteFile(manifestPath, data, 0o644); err != nil {
 		return fmt.Errorf("write manifest: %w", err)
 	}
+	if err := saveLocal(home, local); err != nil {
+		return err
+	}
+	return WriteIgnore(home, local)
+}
+
+func ExpandTarget(target, home string) string {
+	switch {
+	case target == "~":
+		return home
+	case strings.HasPrefix(target, "~/"):
+		return filepath.Join(home, filepath.FromSlash(target[2:]))
+	case !filepath.IsAbs(target):
+		return filepath.Join(home, filepath.FromSlash(target))
+	}
+	return target
+}
+
+func ContractTarget(target, home string) string {
+	if rel, ok := within(home, target); ok {
+		return "~/" + rel
+	}
+	return target
+}
+
+func mapPolicy(policy Policy, convert func(string) string) Policy {
+	mapped := func(targets []string) []string {
+		if targets == nil {
+			return nil
+		}
+		out := make([]string, len(targets))
+		for i, target := range targets {
+			out[i] = convert(target)
+		}
+		return out
+	}
+	return Policy{Required: mapped(policy.Required), Locked: mapped(policy.Locked), Forbidden: mapped(policy.Forbidden)}
+}
+
+func expandEntries(files []FileEntry, dir, home string) {
+	for i := range files {
+		if files[i].Source != "" && !filepath.IsAbs(files[i].Source) {
+			files[i].Source = filepath.Join(dir, filepath.FromSlash(files[i].Source))
+		}
+		files[i].Target = ExpandTarget(files[i].Target, home)
+	}
+}
+
+func contractEntries(files []FileEntry, dir, home string) []FileEntry {
+	contracted := make([]FileEntry, len(files))
+	for i, entry := range files {
+		if rel, ok := within(dir, entry.Source); ok {
+			entry.Source = rel
+		}
+		entry.Target = ContractTarget(entry.Target, home)
+		contracted[i] = entry
+	}
+	return contracted
+}
+
+func within(base, path string) (string, bool) {
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func saveLocal(home string, files []FileEntry) error {
+	path := LocalManifestPath(home)
+	if len(files) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove local manifest: %w", err)
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(&localManifest{Files: contractEntries(files, DotsDir(home), home)})
+	if err != nil {
+		return fmt.Errorf("encode local manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write local manifest: %w", err)
+	}
 	return nil
 }
 
@@ -99,3 +383,49 @@ func RemoveEntry(manifest *Manifest, target string) bool {
 	}
 	return false
 }
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+func ParseSize(value string) (int64, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(value))
+	if normalized == "" {
+		return 0, nil
+	}
+	if normalized == "0" || normalized == "UNLIMITED" {
+		return -1, nil
+	}
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(normalized, unit.suffix) {
+			factor = unit.factor
+			normalized = strings.TrimSpace(strings.TrimSuffix(normalized, unit.suffix))
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(normalized, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(number * float64(factor)), nil
+}
+
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -309,3 +310,200 @@ func TestRemoveEntryLastItem(t *testing.T) {
 		t.Errorf("expected empty manifest, got %d entries", len(manifest.Files))
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", -1, false},
+		{"unlimited", -1, false},
+		{"512", 512, false},
+		{"512K", 512 << 10, false},
+		{"4MB", 4 << 20, false},
+		{"1.5 MiB", 3 << 19, false},
+		{"2g", 2 << 30, false},
+		{"lots", 0, true},
+		{"-1M", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSize(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{12, "12 B"},
+		{2048, "2.0 KiB"},
+		{3 << 20, "3.0 MiB"},
+		{2 << 30, "2.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.size); got != tt.want {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, err := EnsureDotsDir(tmpDir); err != nil {
+		t.Fatalf("EnsureDotsDir failed: %v", err)
+	}
+	original := &Manifest{Settings: Settings{MaxFileSize: "4M"}, Files: []FileEntry{}}
+	if err := Save(tmpDir, original); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Settings.MaxFileSize != "4M" {
+		t.Errorf("MaxFileSize = %q, want %q", loaded.Settings.MaxFileSize, "4M")
+	}
+}
+
+func TestSaveSplitsLocalEntries(t *testing.T) {
+	home := t.TempDir()
+	if _, err := EnsureDotsDir(home); err != nil {
+		t.Fatalf("EnsureDotsDir failed: %v", err)
+	}
+	dotsDir := DotsDir(home)
+	shared := FileEntry{Source: filepath.Join(dotsDir, ".bashrc"), Target: filepath.Join(home, ".bashrc")}
+	local := FileEntry{Source: filepath.Join(dotsDir, ".bashrc.local"), Target: filepath.Join(home, ".bashrc.local"), Local: true}
+
+	if err := Save(home, &Manifest{Files: []FileEntry{shared, local}}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, err := os.ReadFile(ManifestPath(home))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	if strings.Contains(string(data), ".bashrc.local") {
+		t.Errorf("shared manifest contains the local entry:\n%s", data)
+	}
+	if _, err := os.Stat(LocalManifestPath(home)); err != nil {
+		t.Fatalf("local manifest not written: %v", err)
+	}
+
+	loaded, err := Load(home)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded.Files) != 2 || loaded.Files[0] != shared || loaded.Files[1] != local {
+		t.Errorf("loaded files = %+v", loaded.Files)
+	}
+
+	if err := Save(home, &Manifest{Files: []FileEntry{shared}}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(LocalManifestPath(home)); !os.IsNotExist(err) {
+		t.Error("local manifest should be removed when no local entries remain")
+	}
+}
+
+func TestWriteIgnore(t *testing.T) {
+	home := t.TempDir()
+	if _, err := EnsureDotsDir(home); err != nil {
+		t.Fatalf("EnsureDotsDir failed: %v", err)
+	}
+	if err := os.WriteFile(IgnorePath(home), []byte("*.swp"), 0o644); err != nil {
+		t.Fatalf("failed to write ignore file: %v", err)
+	}
+	local := []FileEntry{{Source: filepath.Join(DotsDir(home), "work", "vpn.conf"), Local: true}}
+
+	if err := WriteIgnore(home, local); err != nil {
+		t.Fatalf("WriteIgnore failed: %v", err)
+	}
+	first, _ := os.ReadFile(IgnorePath(home))
+	for _, want := range []string{"*.swp\n", "/dots.local.yaml\n", "/.trash/\n", "/work/vpn.conf\n"} {
+		if !strings.Contains(string(first), want) {
+			t.Errorf("ignore file missing %q:\n%s", want, first)
+		}
+	}
+
+	if err := WriteIgnore(home, nil); err != nil {
+		t.Fatalf("WriteIgnore failed: %v", err)
+	}
+	second, _ := os.ReadFile(IgnorePath(home))
+	if strings.Contains(string(second), "vpn.conf") {
+		t.Errorf("ignore file still lists a removed local entry:\n%s", second)
+	}
+	if strings.Count(string(second), ignoreBegin) != 1 || !strings.HasPrefix(string(second), "*.swp\n") {
+		t.Errorf("managed block was not replaced in place:\n%s", second)
+	}
+}
+
+func TestSaveWritesPortablePaths(t *testing.T) {
+	home := t.TempDir()
+	if _, err := EnsureDotsDir(home); err != nil {
+		t.Fatalf("EnsureDotsDir failed: %v", err)
+	}
+	entry := FileEntry{Source: filepath.Join(DotsDir(home), ".config", "nvim", "init.lua"), Target: filepath.Join(home, ".config", "nvim", "init.lua")}
+	outside := FileEntry{Source: "/srv/shared/profile", Target: "/etc/profile.d/dots.sh"}
+	if err := Save(home, &Manifest{Files: []FileEntry{entry, outside}}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, err := os.ReadFile(ManifestPath(home))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	for _, want := range []string{"source: .config/nvim/init.lua", "target: ~/.config/nvim/init.lua", "source: /srv/shared/profile"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("manifest missing %q:\n%s", want, data)
+		}
+	}
+
+	loaded, err := Load(home)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded.Files) != 2 || loaded.Files[0] != entry || loaded.Files[1] != outside {
+		t.Errorf("loaded files = %+v", loaded.Files)
+	}
+}
+
+func TestScriptPathsRoundTrip(t *testing.T) {
+	home := t.TempDir()
+	dir := DotsDir(home)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("scripts:\n  - name: brew\n    path: scripts/brew.sh\n    run: onchange\n    watch: [Brewfile, ~/.config/app.toml]\nfiles: []\n")
+	manifest, err := Parse(data, dir, home)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	script := manifest.Scripts[0]
+	if script.Path != filepath.Join(dir, "scripts", "brew.sh") {
+		t.Errorf("Path = %s", script.Path)
+	}
+	if script.Watch[0] != filepath.Join(dir, "Brewfile") || script.Watch[1] != filepath.Join(home, ".config", "app.toml") {
+		t.Errorf("Watch = %v", script.Watch)
+	}
+	if err := Save(home, manifest); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	saved, err := os.ReadFile(ManifestPath(home))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"path: scripts/brew.sh", "- Brewfile", "- ~/.config/app.toml"} {
+		if !strings.Contains(string(saved), want) {
+			t.Errorf("saved manifest lacks %q:\n%s", want, saved)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ignoreBegin = "# BEGIN dots managed (do not edit)"
+	ignoreEnd   = "# END dots managed"
+)
+
+var ignoredPaths = []string{
+	"/" + LocalManifestName,
+	"/" + TrashDirName + "/",
+	"/" + LayersDirName + "/",
+	".*.dots-*",
+}
+
+func IgnorePath(home string) string {
+	return filepath.Join(DotsDir(home), IgnoreFileName)
+}
+
+func WriteIgnore(home string, local []FileEntry) error {
+	lines := append([]string{ignoreBegin}, ignoredPaths...)
+	dotsDir := DotsDir(home)
+	for _, entry := range local {
+		rel, err := filepath.Rel(dotsDir, entry.Source)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		lines = append(lines, "/"+filepath.ToSlash(rel))
+	}
+	lines = append(lines, ignoreEnd)
+	block := strings.Join(lines, "\n") + "\n"
+
+	path := IgnorePath(home)
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read ignore file: %w", err)
+	}
+	updated := replaceIgnoreBlock(string(existing), block)
+	if updated == string(existing) {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(updated), 0o644); err != nil {
+		return fmt.Errorf("write ignore file: %w", err)
+	}
+	return nil
+}
+
+func WriteAttributes(home string) error {
+	line := ManifestName + " merge=" + MergeDriverName
+	path := filepath.Join(DotsDir(home), AttributesName)
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read attributes file: %w", err)
+	}
+	for _, current := range strings.Split(string(existing), "\n") {
+		if strings.TrimSpace(current) == line {
+			return nil
+		}
+	}
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if err := os.WriteFile(path, []byte(content+line+"\n"), 0o644); err != nil {
+		return fmt.Errorf("write attributes file: %w", err)
+	}
+	return nil
+}
+
+func replaceIgnoreBlock(content, block string) string {
+	start := strings.Index(content, ignoreBegin)
+	if start < 0 {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return content + block
+	}
+	end := strings.Index(content[start:], ignoreEnd)
+	if end < 0 {
+		return content[:start] + block
+	}
+	end += start + len(ignoreEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return content[:start] + block + content[end:]
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const MergeDriverName = "dots"
+
+type MergeConflict struct {
+	Section string
+	Key     string
+	Ours    string
+	Theirs  string
+}
+
+func (c MergeConflict) String() string {
+	if c.Key == "" {
+		return c.Section
+	}
+	return fmt.Sprintf("%s %s", c.Section, c.Key)
+}
+
+func MergeManifests(base, ours, theirs []byte) ([]byte, []MergeConflict, error) {
+	var b, o, t Manifest
+	for _, side := range []struct {
+		name     string
+		data     []byte
+		manifest *Manifest
+	}{{"base", base, &b}, {"ours", ours, &o}, {"theirs", theirs, &t}} {
+		if err := yaml.Unmarshal(side.data, side.manifest); err != nil {
+			return nil, nil, fmt.Errorf("parse %s manifest: %w", side.name, err)
+		}
+	}
+
+	var conflicts []MergeConflict
+	merged := o
+	mergeField := func(section string, base, ours, theirs any, set func(any)) {
+		value, ok := merge3(base, ours, theirs)
+		if !ok {
+			conflicts = append(conflicts, MergeConflict{Section: section, Ours: encodeYAML(ours), Theirs: encodeYAML(theirs)})
+			return
+		}
+		set(value)
+	}
+	mergeField("settings", b.Settings, o.Settings, t.Settings, func(v any) { merged.Settings = v.(Settings) })
+	mergeField("secrets", b.Secrets, o.Secrets, t.Secrets, func(v any) { merged.Secrets = v.(SecretsConfig) })
+	mergeField("providers", b.Providers, o.Providers, t.Providers, func(v any) { merged.Providers = v.([]ProviderConfig) })
+	mergeField("policy", b.Policy, o.Policy, t.Policy, func(v any) { merged.Policy = v.(Policy) })
+	mergeField("hooks", b.Hooks, o.Hooks, t.Hooks, func(v any) { merged.Hooks = v.(Hooks) })
+
+	var c []MergeConflict
+	merged.Recipients, c = mergeKeyed("recipient", b.Recipients, o.Recipients, t.Recipients, func(r Recipient) string { return r.Name })
+	conflicts = append(conflicts, c...)
+	merged.Layers, c = mergeKeyed("layer", b.Layers, o.Layers, t.Layers, func(l Layer) string { return l.Name })
+	conflicts = append(conflicts, c...)
+	merged.Overrides, c = mergeKeyed("override", b.Overrides, o.Overrides, t.Overrides, func(o Override) string { return o.Target })
+	conflicts = append(conflicts, c...)
+	merged.Scripts, c = mergeKeyed("script", b.Scripts, o.Scripts, t.Scripts, func(s Script) string { return s.Name })
+	conflicts = append(conflicts, c...)
+	merged.Filters, c = mergeFilterMaps(b.Filters, o.Filters, t.Filters)
+	conflicts = append(conflicts, c...)
+	files, fileConflicts := mergeKeyed("file", b.Files, o.Files, t.Files, func(f FileEntry) string { return f.Target })
+	conflicts = append(conflicts, fileConflicts...)
+	merged.Files = []FileEntry{}
+	for _, entry := range files {
+		if !conflicted(fileConflicts, entry.Target) {
+			merged.Files = append(merged.Files, entry)
+		}
+	}
+
+	data, err := yaml.Marshal(&merged)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode manifest: %w", err)
+	}
+	if len(fileConflicts) > 0 {
+		data = appendFileConflicts(data, fileConflicts)
+	}
+	return data, conflicts, nil
+}
+
+func merge3(base, ours, theirs any) (any, bool) {
+	switch {
+	case reflect.DeepEqual(ours, theirs), reflect.DeepEqual(theirs, base):
+		return ours, true
+	case reflect.DeepEqual(ours, base):
+		return theirs, true
+	}
+	return nil, false
+}
+
+func mergeKeyed[T any](section string, base, ours, theirs []T, key func(T) string) ([]T, []MergeConflict) {
+	index := func(items []T) map[string]T {
+		m := make(map[string]T, len(items))
+		for _, item := range items {
+			m[key(item)] = item
+		}
+		return m
+	}
+	b, o, t := index(base), index(ours), index(theirs)
+	var keys []string
+	seen := map[string]bool{}
+	for _, items := range [][]T{ours, theirs} {
+		for _, item := range items {
+			if k := key(item); !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	for _, item := range base {
+		if k := key(item); !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	var merged []T
+	var conflicts []MergeConflict
+	for _, k := range keys {
+		bv, inBase := b[k]
+		ov, inOurs := o[k]
+		tv, inTheirs := t[k]
+		value, ok := merge3(presence(bv, inBase), presence(ov, inOurs), presence(tv, inTheirs))
+		if !ok {
+			conflicts = append(conflicts, MergeConflict{Section: section, Key: k, Ours: encodeYAML(presence(ov, inOurs)), Theirs: encodeYAML(presence(tv, inTheirs))})
+			if inOurs {
+				merged = append(merged, ov)
+			}
+			continue
+		}
+		if item, present := value.(T); present {
+			merged = append(merged, item)
+		}
+	}
+	return merged, conflicts
+}
+
+func presence[T any](value T, present bool) any {
+	if !present {
+		return nil
+	}
+	return value
+}
+
+func mergeFilterMaps(base, ours, theirs map[string][]FilterRule) (map[string][]FilterRule, []MergeConflict) {
+	type named struct {
+		Name  string
+		Rules []FilterRule
+	}
+	list := func(filters map[string][]FilterRule) []named {
+		names := make([]string, 0, len(filters))
+		for name := range filters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out := make([]named, 0, len(names))
+		for _, name := range names {
+			out = append(out, named{name, filters[name]})
+		}
+		return out
+	}
+	merged, conflicts := mergeKeyed("filter", list(base), list(ours), list(theirs), func(n named) string { return n.Name })
+	if len(merged) == 0 {
+		return nil, conflicts
+	}
+	filters := make(map[string][]FilterRule, len(merged))
+	for _, filter := range merged {
+		filters[filter.Name] = filter.Rules
+	}
+	return filters, conflicts
+}
+
+func conflicted(conflicts []MergeConflict, key string) bool {
+	for _, conflict := range conflicts {
+		if conflict.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func appendFileConflicts(data []byte, conflicts []MergeConflict) []byte {
+	if empty := []byte("files: []\n"); bytes.HasSuffix(data, empty) {
+		data = append(data[:len(data)-len(empty)], "files:\n"...)
+	}
+	var out strings.Builder
+	for _, conflict := range conflicts {
+		out.WriteString("<<<<<<< ours\n")
+		out.WriteString(indentEntry(conflict.Ours))
+		out.WriteString("=======\n")
+		out.WriteString(indentEntry(conflict.Theirs))
+		out.WriteString(">>>>>>> theirs\n")
+	}
+	return append(data, out.String()...)
+}
+
+func indentEntry(encoded string) string {
+	if encoded == "" {
+		return ""
+	}
+	var out strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(encoded, "\n"), "\n") {
+		prefix := "      "
+		if i == 0 {
+			prefix = "    - "
+		}
+		out.WriteString(prefix + line + "\n")
+	}
+	return out.String()
+}
+
+func encodeYAML(value any) string {
+	if value == nil {
+		return ""
+	}
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const mergeBase = `recipients:
+    - name: laptop
+      key: age1laptop
+files:
+    - source: .bashrc
+      target: ~/.bashrc
+    - source: .vimrc
+      target: ~/.vimrc
+`
+
+func TestMergeManifestsCombinesEntries(t *testing.T) {
+	ours := mergeBase + `    - source: .zshrc
+      target: ~/.zshrc
+`
+	theirs := strings.Replace(mergeBase, `    - source: .vimrc
+      target: ~/.vimrc
+`, "", 1) + `    - source: .gitconfig
+      target: ~/.gitconfig
+`
+	theirs = strings.Replace(theirs, "files:", "settings:\n    auto_commit: true\nfiles:", 1)
+
+	merged, conflicts, err := MergeManifests([]byte(mergeBase), []byte(ours), []byte(theirs))
+	if err != nil {
+		t.Fatalf("MergeManifests failed: %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("unexpected conflicts: %v", conflicts)
+	}
+	var manifest Manifest
+	if err := yaml.Unmarshal(merged, &manifest); err != nil {
+		t.Fatalf("merged manifest does not parse: %v\n%s", err, merged)
+	}
+	var targets []string
+	for _, entry := range manifest.Files {
+		targets = append(targets, entry.Target)
+	}
+	if got, want := strings.Join(targets, " "), "~/.bashrc ~/.zshrc ~/.gitconfig"; got != want {
+		t.Errorf("targets = %s, want %s", got, want)
+	}
+	if !manifest.Settings.AutoCommit || len(manifest.Recipients) != 1 {
+		t.Errorf("settings or recipients lost: %+v", manifest)
+	}
+}
+
+func TestMergeManifestsConflict(t *testing.T) {
+	ours := mergeBase + `    - source: zsh/ours
+      target: ~/.zshrc
+`
+	theirs := mergeBase + `    - source: zsh/theirs
+      target: ~/.zshrc
+`
+	theirs = strings.Replace(theirs, "age1laptop", "age1other", 1)
+	ours = strings.Replace(ours, "age1laptop", "age1mine", 1)
+
+	merged, conflicts, err := MergeManifests([]byte(mergeBase), []byte(ours), []byte(theirs))
+	if err != nil {
+		t.Fatalf("MergeManifests failed: %v", err)
+	}
+	if len(conflicts) != 2 {
+		t.Fatalf("conflicts = %v, want 2", conflicts)
+	}
+	if got := conflicts[1].String(); got != "file ~/.zshrc" {
+		t.Errorf("conflict = %s", got)
+	}
+	text := string(merged)
+	for _, want := range []string{"<<<<<<< ours\n    - source: zsh/ours\n      target: ~/.zshrc\n=======\n    - source: zsh/theirs", ">>>>>>> theirs\n", "key: age1mine"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("merged output missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "zsh/ours") != 1 {
+		t.Errorf("conflicting entry duplicated:\n%s", text)
+	}
+}
+
+func TestMergeManifestsDeleteVersusEdit(t *testing.T) {
+	ours := strings.Replace(mergeBase, "source: .vimrc", "source: vim/vimrc", 1)
+	theirs := strings.Replace(mergeBase, "    - source: .vimrc\n      target: ~/.vimrc\n", "", 1)
+	_, conflicts, err := MergeManifests([]byte(mergeBase), []byte(ours), []byte(theirs))
+	if err != nil {
+		t.Fatalf("MergeManifests failed: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Theirs != "" {
+		t.Errorf("conflicts = %+v", conflicts)
+	}
+}
+
+func TestWriteAttributes(t *testing.T) {
+	home := t.TempDir()
+	if _, err := EnsureDotsDir(home); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := WriteAttributes(home); err != nil {
+			t.Fatalf("WriteAttributes failed: %v", err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(DotsDir(home), AttributesName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "dots.yaml merge=dots\n" {
+		t.Errorf("attributes = %q", data)
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type RunMode string
+
+const (
+	RunOnce     RunMode = "once"
+	RunOnChange RunMode = "onchange"
+	RunAlways   RunMode = "always"
+)
+
+type Script struct {
+	Name    string   `yaml:"name"`
+	Path    string   `yaml:"path,omitempty"`
+	Command string   `yaml:"command,omitempty"`
+	Run     RunMode  `yaml:"run,omitempty"`
+	Watch   []string `yaml:"watch,omitempty"`
+	Timeout string   `yaml:"timeout,omitempty"`
+}
+
+func (s Script) Mode() RunMode {
+	if s.Run == "" {
+		return RunOnChange
+	}
+	return s.Run
+}
+
+func ValidateScripts(scripts []Script) error {
+	seen := make(map[string]bool)
+	for _, script := range scripts {
+		if script.Name == "" {
+			return fmt.Errorf("script without a name")
+		}
+		if seen[script.Name] {
+			return fmt.Errorf("duplicate script %q", script.Name)
+		}
+		seen[script.Name] = true
+		if (script.Path == "") == (script.Command == "") {
+			return fmt.Errorf("script %s: set exactly one of path and command", script.Name)
+		}
+		switch script.Mode() {
+		case RunOnce, RunOnChange, RunAlways:
+		default:
+			return fmt.Errorf("script %s: run must be once, onchange or always, not %q", script.Name, script.Run)
+		}
+	}
+	return nil
+}
+
+func expandScripts(scripts []Script, dir, home string) {
+	for i := range scripts {
+		if scripts[i].Path != "" {
+			scripts[i].Path = expandStored(scripts[i].Path, dir, home)
+		}
+		for j, watch := range scripts[i].Watch {
+			scripts[i].Watch[j] = expandStored(watch, dir, home)
+		}
+	}
+}
+
+func contractScripts(scripts []Script, dir, home string) []Script {
+	if scripts == nil {
+		return nil
+	}
+	contracted := make([]Script, len(scripts))
+	for i, script := range scripts {
+		if script.Path != "" {
+			script.Path = contractStored(script.Path, dir, home)
+		}
+		if script.Watch != nil {
+			watch := make([]string, len(script.Watch))
+			for j, path := range script.Watch {
+				watch[j] = contractStored(path, dir, home)
+			}
+			script.Watch = watch
+		}
+		contracted[i] = script
+	}
+	return contracted
+}
+
+func expandStored(path, dir, home string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return ExpandTarget(path, home)
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(dir, filepath.FromSlash(path))
+	}
+	return path
+}
+
+func contractStored(path, dir, home string) string {
+	if rel, ok := within(dir, path); ok {
+		return rel
+	}
+	return ContractTarget(path, home)
+}
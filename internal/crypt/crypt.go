@@ -0,0 +1,330 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	PublicKeyPrefix = "dotspub1"
+	IdentityPrefix  = "DOTSKEY1"
+
+	armorBegin = "-----BEGIN DOTS ENCRYPTED FILE-----"
+	armorEnd   = "-----END DOTS ENCRYPTED FILE-----"
+	version    = "dots-encrypted v1"
+	wrapInfo   = "dots-encrypted v1 x25519"
+)
+
+var (
+	ErrNotEncrypted = errors.New("content is not encrypted by dots")
+	ErrNoIdentity   = errors.New("no matching identity")
+)
+
+var encoding = base64.RawURLEncoding
+
+type Identity struct {
+	key *ecdh.PrivateKey
+}
+
+func GenerateIdentity() (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+func ParseIdentity(value string) (*Identity, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, IdentityPrefix) {
+		return nil, fmt.Errorf("invalid identity: missing %s prefix", IdentityPrefix)
+	}
+	raw, err := encoding.DecodeString(strings.TrimPrefix(value, IdentityPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+func (id *Identity) String() string {
+	return IdentityPrefix + encoding.EncodeToString(id.key.Bytes())
+}
+
+func (id *Identity) Recipient() string {
+	return FormatRecipient(id.key.PublicKey())
+}
+
+func FormatRecipient(key *ecdh.PublicKey) string {
+	return PublicKeyPrefix + encoding.EncodeToString(key.Bytes())
+}
+
+func ParseRecipient(value string) (*ecdh.PublicKey, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, PublicKeyPrefix) {
+		return nil, fmt.Errorf("invalid public key %q: missing %s prefix", value, PublicKeyPrefix)
+	}
+	raw, err := encoding.DecodeString(strings.TrimPrefix(value, PublicKeyPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %q: %w", value, err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %q: %w", value, err)
+	}
+	return key, nil
+}
+
+func DefaultIdentityPath() (string, error) {
+	if path := os.Getenv("DOTS_IDENTITY"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve config directory: %w", err)
+	}
+	return filepath.Join(dir, "dots", "identity"), nil
+}
+
+func LoadIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("identity file %s not found, run 'dots keys init'", path)
+		}
+		return nil, fmt.Errorf("read identity: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return ParseIdentity(line)
+	}
+	return nil, fmt.Errorf("identity file %s is empty", path)
+}
+
+func SaveIdentity(path string, id *Identity) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create identity directory: %w", err)
+	}
+	content := fmt.Sprintf("# public key: %s\n%s\n", id.Recipient(), id)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("identity file %s already exists", path)
+		}
+		return fmt.Errorf("create identity: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		return fmt.Errorf("write identity: %w", err)
+	}
+	return nil
+}
+
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armorBegin))
+}
+
+func Encrypt(plaintext []byte, recipients []string) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients configured, run 'dots keys init'")
+	}
+	fileKey := make([]byte, 32)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, fmt.Errorf("generate file key: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(armorBegin + "\n" + version + "\n")
+	for _, recipient := range recipients {
+		publicKey, err := ParseRecipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generate ephemeral key: %w", err)
+		}
+		shared, err := ephemeral.ECDH(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("derive shared key: %w", err)
+		}
+		wrapped, err := seal(wrapKey(shared, ephemeral.PublicKey().Bytes(), publicKey.Bytes()), fileKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "-> %s %s %s\n", FormatRecipient(publicKey), encoding.EncodeToString(ephemeral.PublicKey().Bytes()), encoding.EncodeToString(wrapped))
+	}
+	out.WriteString("---\n")
+
+	body, err := seal(fileKey, plaintext, []byte(version))
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(body)
+	for len(encoded) > 64 {
+		out.WriteString(encoded[:64] + "\n")
+		encoded = encoded[64:]
+	}
+	out.WriteString(encoded + "\n" + armorEnd + "\n")
+	return out.Bytes(), nil
+}
+
+func Decrypt(data []byte, id *Identity) ([]byte, error) {
+	header, body, err := parseArmor(data)
+	if err != nil {
+		return nil, err
+	}
+	self := id.Recipient()
+	for _, stanza := range header {
+		if stanza[0] != self {
+			continue
+		}
+		ephemeralRaw, err := encoding.DecodeString(stanza[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed recipient stanza: %w", err)
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralRaw)
+		if err != nil {
+			return nil, fmt.Errorf("malformed recipient stanza: %w", err)
+		}
+		wrapped, err := encoding.DecodeString(stanza[2])
+		if err != nil {
+			return nil, fmt.Errorf("malformed recipient stanza: %w", err)
+		}
+		shared, err := id.key.ECDH(ephemeral)
+		if err != nil {
+			return nil, fmt.Errorf("derive shared key: %w", err)
+		}
+		fileKey, err := open(wrapKey(shared, ephemeralRaw, id.key.PublicKey().Bytes()), wrapped, nil)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap file key: %w", err)
+		}
+		plaintext, err := open(fileKey, body, []byte(version))
+		if err != nil {
+			return nil, fmt.Errorf("decrypt content: %w", err)
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("%w: content is not encrypted for %s", ErrNoIdentity, self)
+}
+
+func Recipients(data []byte) ([]string, error) {
+	header, _, err := parseArmor(data)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]string, 0, len(header))
+	for _, stanza := range header {
+		recipients = append(recipients, stanza[0])
+	}
+	return recipients, nil
+}
+
+func parseArmor(data []byte) ([][3]string, []byte, error) {
+	if !IsEncrypted(data) {
+		return nil, nil, ErrNotEncrypted
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimLeft(data, " \t\r\n")))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	scanner.Scan()
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != version {
+		return nil, nil, fmt.Errorf("unsupported encrypted file version")
+	}
+
+	var header [][3]string
+	var encoded strings.Builder
+	inBody, closed := false, false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == armorEnd:
+			closed = true
+		case closed:
+		case !inBody && line == "---":
+			inBody = true
+		case !inBody:
+			fields := strings.Fields(line)
+			if len(fields) != 4 || fields[0] != "->" {
+				return nil, nil, fmt.Errorf("malformed recipient stanza %q", line)
+			}
+			header = append(header, [3]string{fields[1], fields[2], fields[3]})
+		default:
+			encoded.WriteString(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("read encrypted file: %w", err)
+	}
+	if !closed {
+		return nil, nil, fmt.Errorf("encrypted file is truncated")
+	}
+	body, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode encrypted body: %w", err)
+	}
+	return header, body, nil
+}
+
+func wrapKey(shared, ephemeral, recipient []byte) []byte {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(shared)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(wrapInfo))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,157 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustIdentity(t *testing.T) *Identity {
+	t.Helper()
+	identity, err := GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity failed: %v", err)
+	}
+	return identity
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	alice := mustIdentity(t)
+	bob := mustIdentity(t)
+	plaintext := []byte("machine api.example.com login me password hunter2\n")
+
+	encrypted, err := Encrypt(plaintext, []string{alice.Recipient(), bob.Recipient()})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if !IsEncrypted(encrypted) {
+		t.Error("IsEncrypted should recognise encrypted output")
+	}
+	if bytes.Contains(encrypted, []byte("hunter2")) {
+		t.Error("encrypted output contains plaintext")
+	}
+
+	for name, identity := range map[string]*Identity{"alice": alice, "bob": bob} {
+		got, err := Decrypt(encrypted, identity)
+		if err != nil {
+			t.Fatalf("Decrypt for %s failed: %v", name, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("Decrypt for %s = %q, want %q", name, got, plaintext)
+		}
+	}
+}
+
+func TestDecryptWrongIdentity(t *testing.T) {
+	alice := mustIdentity(t)
+	mallory := mustIdentity(t)
+	encrypted, err := Encrypt([]byte("secret"), []string{alice.Recipient()})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if _, err := Decrypt(encrypted, mallory); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("Decrypt error = %v, want %v", err, ErrNoIdentity)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	alice := mustIdentity(t)
+	encrypted, err := Encrypt([]byte(strings.Repeat("secret ", 20)), []string{alice.Recipient()})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	lines := strings.Split(string(encrypted), "\n")
+	body := lines[len(lines)-3]
+	flipped := []byte(body)
+	if flipped[10] == 'A' {
+		flipped[10] = 'B'
+	} else {
+		flipped[10] = 'A'
+	}
+	lines[len(lines)-3] = string(flipped)
+	if _, err := Decrypt([]byte(strings.Join(lines, "\n")), alice); err == nil {
+		t.Error("Decrypt should fail on tampered content")
+	}
+}
+
+func TestDecryptNotEncrypted(t *testing.T) {
+	if _, err := Decrypt([]byte("plain text"), mustIdentity(t)); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Decrypt error = %v, want %v", err, ErrNotEncrypted)
+	}
+}
+
+func TestEncryptRequiresRecipients(t *testing.T) {
+	if _, err := Encrypt([]byte("x"), nil); err == nil {
+		t.Error("Encrypt should fail without recipients")
+	}
+	if _, err := Encrypt([]byte("x"), []string{"not-a-key"}); err == nil {
+		t.Error("Encrypt should fail on malformed recipients")
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	alice := mustIdentity(t)
+	bob := mustIdentity(t)
+	encrypted, err := Encrypt([]byte("x"), []string{alice.Recipient(), bob.Recipient()})
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	got, err := Recipients(encrypted)
+	if err != nil {
+		t.Fatalf("Recipients failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != alice.Recipient() || got[1] != bob.Recipient() {
+		t.Errorf("Recipients = %v", got)
+	}
+}
+
+func TestIdentityStringRoundTrip(t *testing.T) {
+	identity := mustIdentity(t)
+	parsed, err := ParseIdentity(identity.String())
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+	if parsed.Recipient() != identity.Recipient() {
+		t.Error("parsed identity has a different public key")
+	}
+	if _, err := ParseIdentity("garbage"); err == nil {
+		t.Error("ParseIdentity should reject malformed input")
+	}
+	if _, err := ParseRecipient(identity.String()); err == nil {
+		t.Error("ParseRecipient should reject identities")
+	}
+}
+
+func TestSaveAndLoadIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dots", "identity")
+	identity := mustIdentity(t)
+	if err := SaveIdentity(path, identity); err != nil {
+		t.Fatalf("SaveIdentity failed: %v", err)
+	}
+	loaded, err := LoadIdentity(path)
+	if err != nil {
+		t.Fatalf("LoadIdentity failed: %v", err)
+	}
+	if loaded.Recipient() != identity.Recipient() {
+		t.Error("loaded identity differs from saved identity")
+	}
+	if err := SaveIdentity(path, mustIdentity(t)); err == nil {
+		t.Error("SaveIdentity should not overwrite an existing identity")
+	}
+	if _, err := LoadIdentity(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadIdentity should fail for a missing file")
+	}
+}
+
+func TestDefaultIdentityPathEnv(t *testing.T) {
+	t.Setenv("DOTS_IDENTITY", "/tmp/custom-identity")
+	path, err := DefaultIdentityPath()
+	if err != nil {
+		t.Fatalf("DefaultIdentityPath failed: %v", err)
+	}
+	if path != "/tmp/custom-identity" {
+		t.Errorf("DefaultIdentityPath = %q, want %q", path, "/tmp/custom-identity")
+	}
+}
@@ -1,6 +1,7 @@
 package dotfile
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/subcode-labs/dots/internal/config"
 )
@@ -19,6 +21,7 @@ const (
 	StatusLinked    SyncStatus = "linked"
 	StatusDiverged  SyncStatus = "diverged"
 	StatusConflicts SyncStatus = "conflict"
+	StatusLocked    SyncStatus = "locked"
 )
 
 type StatusEntry struct {
@@ -47,6 +50,9 @@ func Init(home string) (string, error) {
 	if _, err := config.EnsureDotsDir(home); err != nil {
 		return "", err
 	}
+	if _, err := os.Stat(config.ManifestPath(home)); err == nil {
+		return config.DotsDir(home), nil
+	}
 	manifest, err := config.Load(home)
 	if err != nil {
 		return "", err
@@ -57,7 +63,21 @@ func Init(home string) (string, error) {
 	return config.DotsDir(home), nil
 }
 
+type CopyOptions struct {
+	Name     string
+	Target   string
+	Manifest *config.Manifest
+	MaxSize  int64
+	Force    bool
+	Inspect  func(sourcePath string) error
+	Encode   func(content []byte) ([]byte, error)
+}
+
 func CopyIntoDots(home, sourcePath string) (string, error) {
+	return CopyIntoDotsWithOptions(home, sourcePath, CopyOptions{})
+}
+
+func CopyIntoDotsWithOptions(home, sourcePath string, opts CopyOptions) (string, error) {
 	info, err := os.Lstat(sourcePath)
 	if err != nil {
 		return "", fmt.Errorf("inspect source: %w", err)
@@ -68,14 +88,62 @@ func CopyIntoDots(home, sourcePath string) (string, error) {
 	if info.Mode()&os.ModeSymlink != 0 {
 		return "", fmt.Errorf("source must be a regular file, got symlink")
 	}
-	base := filepath.Base(sourcePath)
-	destination := filepath.Join(config.DotsDir(home), base)
+	if err := Preflight(home, sourcePath, info, opts); err != nil {
+		return "", err
+	}
+	if opts.Inspect != nil {
+		if err := opts.Inspect(sourcePath); err != nil {
+			return "", err
+		}
+	}
+	destination, err := StoredPath(home, storedName(sourcePath, opts))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+		return "", fmt.Errorf("ensure stored dir: %w", err)
+	}
+	if opts.Encode != nil {
+		content, err := os.ReadFile(sourcePath)
+		if err != nil {
+			return "", fmt.Errorf("read source: %w", err)
+		}
+		encoded, err := opts.Encode(content)
+		if err != nil {
+			return "", err
+		}
+		if err := WriteCopy(destination, encoded, info.Mode().Perm()); err != nil {
+			return "", err
+		}
+		return destination, nil
+	}
 	if err := CopyFile(sourcePath, destination); err != nil {
 		return "", err
 	}
 	return destination, nil
 }
 
+func storedName(sourcePath string, opts CopyOptions) string {
+	if opts.Name != "" {
+		return opts.Name
+	}
+	return filepath.Base(sourcePath)
+}
+
+func StoredPath(home, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", fmt.Errorf("invalid stored name %q: must be a relative path", name)
+	}
+	cleaned := filepath.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid stored name %q: must stay inside the dots directory", name)
+	}
+	if config.IsReserved(strings.Split(filepath.ToSlash(cleaned), "/")[0]) {
+		return "", fmt.Errorf("invalid stored name %q: reserved by dots", name)
+	}
+	return filepath.Join(config.DotsDir(home), cleaned), nil
+}
+
 func CopyFile(src, dst string) error {
 	return copyFile(src, dst)
 }
@@ -187,6 +255,10 @@ func ContentStatus(entry config.FileEntry) (StatusEntry, error) {
 	return StatusEntry{Entry: entry, Status: StatusDiverged}, nil
 }
 
+func SameContent(source, target string) (bool, error) {
+	return sameContent(source, target)
+}
+
 func sameContent(source, target string) (bool, error) {
 	sourceHash, err := fileHash(source)
 	if err != nil {
@@ -222,3 +294,83 @@ func RelativePath(home, path string) string {
 	}
 	return path
 }
+
+func PruneEmptyDirs(dir, stop string) error {
+	stop = filepath.Clean(stop)
+	for dir = filepath.Clean(dir); dir != stop && strings.HasPrefix(dir, stop+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("read directory: %w", err)
+		}
+		if len(entries) > 0 {
+			return nil
+		}
+		if err := os.Remove(dir); err != nil {
+			return fmt.Errorf("remove empty directory: %w", err)
+		}
+	}
+	return nil
+}
+
+func CopyStatus(entry config.FileEntry, want []byte) (StatusEntry, error) {
+	info, err := os.Lstat(entry.Target)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return StatusEntry{Entry: entry, Status: StatusMissing, Info: "target missing"}, nil
+		}
+		return StatusEntry{}, fmt.Errorf("stat target: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return StatusEntry{Entry: entry, Status: StatusConflicts, Info: "not a regular file"}, nil
+	}
+	current, err := os.ReadFile(entry.Target)
+	if err != nil {
+		return StatusEntry{}, fmt.Errorf("read target: %w", err)
+	}
+	if bytes.Equal(current, want) {
+		return StatusEntry{Entry: entry, Status: StatusLinked}, nil
+	}
+	return StatusEntry{Entry: entry, Status: StatusDiverged}, nil
+}
+
+func WriteCopy(target string, content []byte, perm os.FileMode) error {
+	tmp, err := WriteTemp(target, content, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("replace target: %w", err)
+	}
+	return nil
+}
+
+func WriteTemp(target string, content []byte, perm os.FileMode) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", fmt.Errorf("ensure parent dir: %w", err)
+	}
+	if info, err := os.Lstat(target); err == nil && info.IsDir() {
+		return "", fmt.Errorf("target %s is a directory", target)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".dots-*")
+	if err != nil {
+		return "", fmt.Errorf("create temporary file: %w", err)
+	}
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return "", fmt.Errorf("write temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", fmt.Errorf("close temporary file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", fmt.Errorf("set permissions: %w", err)
+	}
+	return tmp.Name(), nil
+}
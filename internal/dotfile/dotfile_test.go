@@ -475,3 +475,209 @@ func TestSyncStatusConstants(t *testing.T) {
 		t.Errorf("StatusConflicts = %q, want %q", StatusConflicts, "conflict")
 	}
 }
+
+func TestPruneEmptyDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	nested := filepath.Join(tmpDir, "a", "b", "c")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatalf("failed to create directories: %v", err)
+	}
+	keep := filepath.Join(tmpDir, "a", "keep")
+	if err := os.WriteFile(keep, []byte("x"), 0o644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	if err := PruneEmptyDirs(nested, tmpDir); err != nil {
+		t.Fatalf("PruneEmptyDirs failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "a", "b")); !os.IsNotExist(err) {
+		t.Error("empty directories should be removed")
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("non-empty parent should be kept: %v", err)
+	}
+	if _, err := os.Stat(tmpDir); err != nil {
+		t.Errorf("stop directory should never be removed: %v", err)
+	}
+}
+
+func TestPruneEmptyDirsOutsideStop(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := filepath.Join(tmpDir, "outside")
+	if err := os.Mkdir(outside, 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	if err := PruneEmptyDirs(outside, filepath.Join(tmpDir, "stop")); err != nil {
+		t.Fatalf("PruneEmptyDirs failed: %v", err)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("directories outside stop should be kept: %v", err)
+	}
+}
+
+func TestSameContent(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	a := filepath.Join(tmpDir, "a")
+	b := filepath.Join(tmpDir, "b")
+	c := filepath.Join(tmpDir, "c")
+	for path, content := range map[string]string{a: "same", b: "same", c: "different"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to create %s: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		target string
+		want   bool
+	}{
+		{"identical", a, b, true},
+		{"different", a, c, false},
+		{"missing target", a, filepath.Join(tmpDir, "missing"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SameContent(tt.source, tt.target)
+			if err != nil {
+				t.Fatalf("SameContent failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("SameContent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyIntoDotsWithName(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, err := Init(tmpDir); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	srcPath := filepath.Join(tmpDir, "init.vim")
+	if err := os.WriteFile(srcPath, []byte("set number"), 0o644); err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	destPath, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{Name: "nvim/init.vim"})
+	if err != nil {
+		t.Fatalf("CopyIntoDotsWithOptions failed: %v", err)
+	}
+	expectedDest := filepath.Join(tmpDir, ".dots", "nvim", "init.vim")
+	if destPath != expectedDest {
+		t.Errorf("CopyIntoDotsWithOptions returned %q, want %q", destPath, expectedDest)
+	}
+	if _, err := os.Stat(destPath); err != nil {
+		t.Errorf("copied file doesn't exist: %v", err)
+	}
+}
+
+func TestStoredPath(t *testing.T) {
+	home := "/home/testuser"
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{".bashrc", "/home/testuser/.dots/.bashrc", false},
+		{"nvim/init.vim", "/home/testuser/.dots/nvim/init.vim", false},
+		{"", "", true},
+		{"/etc/passwd", "", true},
+		{"../escape", "", true},
+		{".git/config", "", true},
+		{"dots.yaml", "", true},
+		{".trash/x", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StoredPath(home, tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("StoredPath(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("StoredPath(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCopyReplacesSymlink(t *testing.T) {
+	tmpDir := t.TempDir()
+	source := filepath.Join(tmpDir, "source")
+	if err := os.WriteFile(source, []byte("stored"), 0o644); err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	target := filepath.Join(tmpDir, "nested", "target")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.Symlink(source, target); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	if err := WriteCopy(target, []byte("rendered"), 0o600); err != nil {
+		t.Fatalf("WriteCopy failed: %v", err)
+	}
+	info, err := os.Lstat(target)
+	if err != nil {
+		t.Fatalf("target missing: %v", err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm() != 0o600 {
+		t.Errorf("target mode = %v, want regular 0600", info.Mode())
+	}
+	if got, _ := os.ReadFile(source); string(got) != "stored" {
+		t.Errorf("WriteCopy must not write through the symlink, source = %q", got)
+	}
+}
+
+func TestCopyStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+	entry := config.FileEntry{Source: filepath.Join(tmpDir, "source"), Target: filepath.Join(tmpDir, "target")}
+
+	status, err := CopyStatus(entry, []byte("want"))
+	if err != nil {
+		t.Fatalf("CopyStatus failed: %v", err)
+	}
+	if status.Status != StatusMissing {
+		t.Errorf("status = %v, want %v", status.Status, StatusMissing)
+	}
+
+	if err := os.WriteFile(entry.Target, []byte("want"), 0o600); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+	if status, _ = CopyStatus(entry, []byte("want")); status.Status != StatusLinked {
+		t.Errorf("status = %v, want %v", status.Status, StatusLinked)
+	}
+	if status, _ = CopyStatus(entry, []byte("other")); status.Status != StatusDiverged {
+		t.Errorf("status = %v, want %v", status.Status, StatusDiverged)
+	}
+}
+
+func TestCopyIntoDotsEncode(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, err := Init(tmpDir); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	srcPath := filepath.Join(tmpDir, ".netrc")
+	if err := os.WriteFile(srcPath, []byte("plain"), 0o600); err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	destPath, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{
+		Encode: func(content []byte) ([]byte, error) {
+			return append([]byte("encoded:"), content...), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("CopyIntoDotsWithOptions failed: %v", err)
+	}
+	got, _ := os.ReadFile(destPath)
+	if string(got) != "encoded:plain" {
+		t.Errorf("stored content = %q, want %q", got, "encoded:plain")
+	}
+}
@@ -0,0 +1,102 @@
+package dotfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func HasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func Glob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		return matches, nil
+	}
+
+	root := globRoot(pattern)
+	var matches []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+				return nil
+			}
+			return err
+		}
+		ok, err := MatchPattern(pattern, path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("expand %q: %w", pattern, err)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func MatchPattern(pattern, name string) (bool, error) {
+	return matchSegments(splitPath(pattern), splitPath(name))
+}
+
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				ok, err := matchSegments(pattern[1:], name[i:])
+				if ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := filepath.Match(pattern[0], name[0])
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern: %w", err)
+		}
+		if !ok {
+			return false, nil
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+func splitPath(path string) []string {
+	return strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+}
+
+func globRoot(pattern string) string {
+	segments := splitPath(pattern)
+	var root []string
+	for _, segment := range segments {
+		if HasMeta(segment) {
+			break
+		}
+		root = append(root, segment)
+	}
+	if len(root) == 0 {
+		return "."
+	}
+	joined := filepath.FromSlash(strings.Join(root, "/"))
+	if joined == "" {
+		return string(os.PathSeparator)
+	}
+	return joined
+}
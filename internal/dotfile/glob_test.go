@@ -0,0 +1,94 @@
+package dotfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"/home/user/.bashrc", "/home/user/.bashrc", true},
+		{"/home/user/.*rc", "/home/user/.vimrc", true},
+		{"/home/user/*", "/home/user/.config/nvim/init.vim", false},
+		{"/home/user/.config/**", "/home/user/.config/nvim/init.vim", true},
+		{"/home/user/.config/**/*.vim", "/home/user/.config/nvim/lua/init.vim", true},
+		{"/home/user/.config/**/*.vim", "/home/user/.config/init.vim", true},
+		{"/home/user/.config/**/*.vim", "/home/user/.config/nvim/init.lua", false},
+		{"/home/user/**/config", "/home/other/.ssh/config", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			got, err := MatchPattern(tt.pattern, tt.name)
+			if err != nil {
+				t.Fatalf("MatchPattern failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPatternInvalid(t *testing.T) {
+	if _, err := MatchPattern("/home/[", "/home/x"); err == nil {
+		t.Error("MatchPattern should fail on malformed patterns")
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{
+		".bashrc",
+		".zshrc",
+		filepath.Join(".config", "git", "config"),
+		filepath.Join(".config", "nvim", "lua", "init.lua"),
+	}
+	for _, file := range files {
+		path := filepath.Join(tmpDir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*rc", []string{".bashrc", ".zshrc"}},
+		{filepath.Join(".config", "**", "*.lua"), []string{filepath.Join(".config", "nvim", "lua", "init.lua")}},
+		{filepath.Join("**", "config"), []string{filepath.Join(".config", "git", "config")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := Glob(filepath.Join(tmpDir, tt.pattern))
+			if err != nil {
+				t.Fatalf("Glob failed: %v", err)
+			}
+			want := make([]string, len(tt.want))
+			for i, rel := range tt.want {
+				want[i] = filepath.Join(tmpDir, rel)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Glob = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestHasMeta(t *testing.T) {
+	if HasMeta("/home/user/.bashrc") {
+		t.Error("plain path should not be a pattern")
+	}
+	if !HasMeta("/home/user/.*rc") {
+		t.Error("wildcard path should be a pattern")
+	}
+}
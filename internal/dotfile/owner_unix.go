@@ -0,0 +1,22 @@
+//go:build !windows
+
+package dotfile
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+func foreignOwner(info os.FileInfo) (string, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int(stat.Uid) == os.Getuid() {
+		return "", false
+	}
+	uid := strconv.FormatUint(uint64(stat.Uid), 10)
+	if owner, err := user.LookupId(uid); err == nil {
+		return owner.Username, true
+	}
+	return "uid " + uid, true
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package dotfile
+
+import "os"
+
+func foreignOwner(info os.FileInfo) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,128 @@
+package dotfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+const DefaultMaxSize int64 = 1 << 20
+
+var (
+	ErrSpecialFile   = errors.New("special file")
+	ErrInsideDotsDir = errors.New("inside dots directory")
+	ErrUnreadable    = errors.New("unreadable file")
+	ErrNameCollision = errors.New("stored name collision")
+	ErrForeignOwner  = errors.New("owned by another user")
+	ErrTooLarge      = errors.New("file too large")
+	ErrBinary        = errors.New("binary file")
+)
+
+type PreflightError struct {
+	Path   string
+	Reason error
+	Detail string
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Detail)
+}
+
+func (e *PreflightError) Unwrap() error {
+	return e.Reason
+}
+
+func (e *PreflightError) Forceable() bool {
+	return e.Reason == ErrForeignOwner || e.Reason == ErrTooLarge || e.Reason == ErrBinary
+}
+
+func Preflight(home, sourcePath string, info os.FileInfo, opts CopyOptions) error {
+	fail := func(reason error, format string, args ...any) error {
+		return &PreflightError{Path: sourcePath, Reason: reason, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	if info.Mode()&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeCharDevice|os.ModeIrregular) != 0 {
+		return fail(ErrSpecialFile, "%s is a %s, only regular files can be tracked", sourcePath, fileKind(info.Mode()))
+	}
+
+	dotsDir := config.DotsDir(home)
+	if rel, err := filepath.Rel(dotsDir, sourcePath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fail(ErrInsideDotsDir, "%s already lives in %s", sourcePath, dotsDir)
+	}
+
+	destination, err := StoredPath(home, storedName(sourcePath, opts))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return fail(ErrUnreadable, "%v", err)
+	}
+	defer file.Close()
+
+	if opts.Manifest != nil {
+		target := opts.Target
+		if target == "" {
+			target = sourcePath
+		}
+		tracked := false
+		for _, entry := range opts.Manifest.Files {
+			if entry.Source != destination {
+				continue
+			}
+			if entry.Target != target {
+				return fail(ErrNameCollision, "%s is already stored for %s, choose another stored name", filepath.Base(destination), entry.Target)
+			}
+			tracked = true
+		}
+		if _, err := os.Lstat(destination); err == nil && !tracked {
+			return fail(ErrNameCollision, "%s already exists in %s, choose another stored name", filepath.Base(destination), dotsDir)
+		}
+	}
+
+	if opts.Force {
+		return nil
+	}
+
+	if owner, foreign := foreignOwner(info); foreign {
+		return fail(ErrForeignOwner, "%s is owned by %s", sourcePath, owner)
+	}
+
+	maxSize := opts.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return fail(ErrTooLarge, "%s is %s, over the %s limit", sourcePath, config.FormatSize(info.Size()), config.FormatSize(maxSize))
+	}
+
+	head := make([]byte, 8000)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fail(ErrUnreadable, "%v", err)
+	}
+	if bytes.IndexByte(head[:n], 0) >= 0 {
+		return fail(ErrBinary, "%s looks like a binary file", sourcePath)
+	}
+	return nil
+}
+
+func fileKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&(os.ModeDevice|os.ModeCharDevice) != 0:
+		return "device"
+	default:
+		return "special file"
+	}
+}
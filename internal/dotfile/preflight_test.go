@@ -0,0 +1,132 @@
+package dotfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+func writeSource(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	return path
+}
+
+func TestCopyIntoDotsRejectsLargeFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	_, _ = Init(tmpDir)
+	srcPath := writeSource(t, tmpDir, "big.log", []byte(strings.Repeat("x", 2048)))
+
+	_, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{MaxSize: 1024})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("error = %v, want %v", err, ErrTooLarge)
+	}
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) || !preflightErr.Forceable() {
+		t.Error("size limit should be forceable")
+	}
+
+	if _, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{MaxSize: 1024, Force: true}); err != nil {
+		t.Errorf("Force should bypass the size limit: %v", err)
+	}
+	if _, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{MaxSize: -1}); err != nil {
+		t.Errorf("negative MaxSize should disable the limit: %v", err)
+	}
+}
+
+func TestCopyIntoDotsRejectsBinary(t *testing.T) {
+	tmpDir := t.TempDir()
+	_, _ = Init(tmpDir)
+	srcPath := writeSource(t, tmpDir, "blob", []byte{0x7f, 'E', 'L', 'F', 0x00, 0x01})
+
+	if _, err := CopyIntoDots(tmpDir, srcPath); !errors.Is(err, ErrBinary) {
+		t.Fatalf("error = %v, want %v", err, ErrBinary)
+	}
+	if _, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{Force: true}); err != nil {
+		t.Errorf("Force should bypass the binary check: %v", err)
+	}
+}
+
+func TestCopyIntoDotsRejectsFileInsideDotsDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	dotsDir, _ := Init(tmpDir)
+	srcPath := writeSource(t, dotsDir, "inside", []byte("x"))
+
+	_, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{Name: "copy", Force: true})
+	if !errors.Is(err, ErrInsideDotsDir) {
+		t.Fatalf("error = %v, want %v", err, ErrInsideDotsDir)
+	}
+}
+
+func TestCopyIntoDotsRejectsNameCollision(t *testing.T) {
+	tmpDir := t.TempDir()
+	_, _ = Init(tmpDir)
+	srcPath := writeSource(t, tmpDir, "config", []byte("new"))
+	manifest := &config.Manifest{Files: []config.FileEntry{
+		{Source: filepath.Join(tmpDir, ".dots", "config"), Target: filepath.Join(tmpDir, ".ssh", "config")},
+	}}
+
+	_, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{Manifest: manifest, Force: true})
+	if !errors.Is(err, ErrNameCollision) {
+		t.Fatalf("error = %v, want %v", err, ErrNameCollision)
+	}
+
+	if _, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{Manifest: manifest, Name: "git-config"}); err != nil {
+		t.Errorf("a different stored name should not collide: %v", err)
+	}
+}
+
+func TestCopyIntoDotsRejectsExistingStoredFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	_, _ = Init(tmpDir)
+	srcPath := writeSource(t, tmpDir, ".profile", []byte("new"))
+	stored := filepath.Join(tmpDir, ".dots", ".profile")
+	if err := os.WriteFile(stored, []byte("untracked"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{Manifest: &config.Manifest{}, Force: true})
+	if !errors.Is(err, ErrNameCollision) {
+		t.Fatalf("error = %v, want %v", err, ErrNameCollision)
+	}
+	if data, _ := os.ReadFile(stored); string(data) != "untracked" {
+		t.Errorf("existing stored file = %q", data)
+	}
+}
+
+func TestCopyIntoDotsSameTargetIsNotCollision(t *testing.T) {
+	tmpDir := t.TempDir()
+	_, _ = Init(tmpDir)
+	srcPath := writeSource(t, tmpDir, ".bashrc", []byte("x"))
+	manifest := &config.Manifest{Files: []config.FileEntry{
+		{Source: filepath.Join(tmpDir, ".dots", ".bashrc"), Target: srcPath},
+	}}
+
+	if _, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{Manifest: manifest}); err != nil {
+		t.Errorf("re-adding the same target should be allowed: %v", err)
+	}
+}
+
+func TestCopyIntoDotsRejectsUnreadable(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root can read any file")
+	}
+	tmpDir := t.TempDir()
+	_, _ = Init(tmpDir)
+	srcPath := writeSource(t, tmpDir, "secret", []byte("x"))
+	if err := os.Chmod(srcPath, 0o000); err != nil {
+		t.Fatalf("chmod failed: %v", err)
+	}
+
+	_, err := CopyIntoDotsWithOptions(tmpDir, srcPath, CopyOptions{Force: true})
+	if !errors.Is(err, ErrUnreadable) {
+		t.Fatalf("error = %v, want %v", err, ErrUnreadable)
+	}
+}
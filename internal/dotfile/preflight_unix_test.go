@@ -0,0 +1,24 @@
+//go:build !windows
+
+package dotfile
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyIntoDotsRejectsFIFO(t *testing.T) {
+	tmpDir := t.TempDir()
+	_, _ = Init(tmpDir)
+	fifo := filepath.Join(tmpDir, "pipe")
+	if err := syscall.Mkfifo(fifo, 0o644); err != nil {
+		t.Skipf("mkfifo unavailable: %v", err)
+	}
+
+	_, err := CopyIntoDotsWithOptions(tmpDir, fifo, CopyOptions{Force: true})
+	if !errors.Is(err, ErrSpecialFile) {
+		t.Fatalf("error = %v, want %v", err, ErrSpecialFile)
+	}
+}
@@ -0,0 +1,254 @@
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{\{\s*value\s+"([^"]+)"\s*\}\}`)
+	secretPattern      = regexp.MustCompile(`\{\{\s*secret\s+"([^"]+)"\s*\}\}`)
+)
+
+type Values map[string]string
+
+type MissingValuesError struct {
+	Names []string
+}
+
+func (e *MissingValuesError) Error() string {
+	return fmt.Sprintf("missing local values for %s, set them with 'dots values set'", strings.Join(e.Names, ", "))
+}
+
+func Placeholder(name string) string {
+	return fmt.Sprintf(`{{ value "%s" }}`, name)
+}
+
+func SecretPlaceholder(name string) string {
+	return fmt.Sprintf(`{{ secret "%s" }}`, name)
+}
+
+func DefaultValuesPath() (string, error) {
+	if path := os.Getenv("DOTS_VALUES"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve config directory: %w", err)
+	}
+	return filepath.Join(dir, "dots", "values.yaml"), nil
+}
+
+func LoadValues(path string) (Values, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Values{}, nil
+		}
+		return nil, fmt.Errorf("read values: %w", err)
+	}
+	values := Values{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parse values: %w", err)
+	}
+	return values, nil
+}
+
+func SaveValues(path string, values Values) error {
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("encode values: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create values directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write values: %w", err)
+	}
+	return nil
+}
+
+func Clean(content []byte, rules []config.FilterRule) ([]byte, Values, error) {
+	captured := Values{}
+	for _, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid filter pattern %q: %w", rule.Pattern, err)
+		}
+		if (rule.Placeholder == "") == (rule.Secret == "") {
+			return nil, nil, fmt.Errorf("filter pattern %q needs exactly one of placeholder or secret", rule.Pattern)
+		}
+		replacement := Placeholder(rule.Placeholder)
+		if rule.Secret != "" {
+			replacement = SecretPlaceholder(rule.Secret)
+		}
+		existing := append(placeholderPattern.FindAllIndex(content, -1), secretPattern.FindAllIndex(content, -1)...)
+		var out []byte
+		last := 0
+		for _, match := range pattern.FindAllSubmatchIndex(content, -1) {
+			start, end := match[0], match[1]
+			if groups := len(match) / 2; groups > 1 {
+				start, end = match[2*(groups-1)], match[2*(groups-1)+1]
+			}
+			if start < 0 {
+				continue
+			}
+			if overlaps(existing, start, end) {
+				continue
+			}
+			if rule.Placeholder != "" {
+				value := string(content[start:end])
+				if previous, ok := captured[rule.Placeholder]; ok && previous != value {
+					return nil, nil, fmt.Errorf("placeholder %q matched different values", rule.Placeholder)
+				}
+				captured[rule.Placeholder] = value
+			}
+			out = append(out, content[last:start]...)
+			out = append(out, replacement...)
+			last = end
+		}
+		content = append(out, content[last:]...)
+	}
+	return content, captured, nil
+}
+
+func overlaps(spans [][]int, start, end int) bool {
+	for _, span := range spans {
+		if start < span[1] && span[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+func Smudge(content []byte, values Values) ([]byte, error) {
+	missing := map[string]bool{}
+	result := placeholderPattern.ReplaceAllFunc(content, func(token []byte) []byte {
+		name := string(placeholderPattern.FindSubmatch(token)[1])
+		value, ok := values[name]
+		if !ok {
+			missing[name] = true
+			return token
+		}
+		return []byte(value)
+	})
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, &MissingValuesError{Names: names}
+	}
+	return result, nil
+}
+
+func Placeholders(content []byte) []string {
+	return names(placeholderPattern, content)
+}
+
+func StripPlaceholders(line string) string {
+	return secretPattern.ReplaceAllString(placeholderPattern.ReplaceAllString(line, ""), "")
+}
+
+func SecretReferences(content []byte) []string {
+	return names(secretPattern, content)
+}
+
+func names(pattern *regexp.Regexp, content []byte) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, match := range pattern.FindAllSubmatch(content, -1) {
+		name := string(match[1])
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func ResolveSecrets(content []byte, lookup func(string) (string, error)) ([]byte, error) {
+	var lookupErr error
+	result := secretPattern.ReplaceAllFunc(content, func(token []byte) []byte {
+		if lookupErr != nil {
+			return token
+		}
+		value, err := lookup(string(secretPattern.FindSubmatch(token)[1]))
+		if err != nil {
+			lookupErr = err
+			return token
+		}
+		return []byte(value)
+	})
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	return result, nil
+}
+
+func MaskSecrets(live, template []byte, lookup func(string) (string, error)) ([]byte, error) {
+	references := SecretReferences(template)
+	if len(references) == 0 {
+		return live, nil
+	}
+	if matchesTemplate(live, template) {
+		return template, nil
+	}
+	resolved := make(map[string]string, len(references))
+	for _, name := range references {
+		value, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		resolved[name] = value
+	}
+	sort.Slice(references, func(i, j int) bool {
+		return len(resolved[references[i]]) > len(resolved[references[j]])
+	})
+	for _, name := range references {
+		if value := resolved[name]; value != "" {
+			live = bytes.ReplaceAll(live, []byte(value), []byte(SecretPlaceholder(name)))
+		}
+	}
+	return live, nil
+}
+
+func matchesTemplate(live, template []byte) bool {
+	var segments [][]byte
+	last := 0
+	for _, span := range secretPattern.FindAllIndex(template, -1) {
+		segments = append(segments, template[last:span[0]])
+		last = span[1]
+	}
+	segments = append(segments, template[last:])
+
+	first, final := segments[0], segments[len(segments)-1]
+	if !bytes.HasPrefix(live, first) {
+		return false
+	}
+	rest := live[len(first):]
+	for _, segment := range segments[1 : len(segments)-1] {
+		index := bytes.Index(rest, segment)
+		if index < 0 || !opaque(rest[:index]) {
+			return false
+		}
+		rest = rest[index+len(segment):]
+	}
+	return bytes.HasSuffix(rest, final) && opaque(rest[:len(rest)-len(final)])
+}
+
+func opaque(value []byte) bool {
+	return len(value) > 0 && bytes.IndexAny(value, " \t\r\n") < 0
+}
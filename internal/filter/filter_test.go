@@ -0,0 +1,217 @@
+package filter
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+var gitconfigRules = []config.FilterRule{
+	{Pattern: `signingkey\s*=\s*(\S+)`, Placeholder: "signing_key"},
+	{Pattern: `email\s*=\s*(\S+)`, Placeholder: "email"},
+}
+
+const gitconfig = "[user]\n\temail = me@work.example\n\tsigningkey = ABCDEF0123456789\n"
+
+func TestCleanReplacesCapturedValues(t *testing.T) {
+	cleaned, captured, err := Clean([]byte(gitconfig), gitconfigRules)
+	if err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	want := "[user]\n\temail = " + Placeholder("email") + "\n\tsigningkey = " + Placeholder("signing_key") + "\n"
+	if string(cleaned) != want {
+		t.Errorf("Clean = %q, want %q", cleaned, want)
+	}
+	wantValues := Values{"email": "me@work.example", "signing_key": "ABCDEF0123456789"}
+	if !reflect.DeepEqual(captured, wantValues) {
+		t.Errorf("captured = %v, want %v", captured, wantValues)
+	}
+}
+
+func TestCleanIsIdempotent(t *testing.T) {
+	once, _, err := Clean([]byte(gitconfig), gitconfigRules)
+	if err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	twice, captured, err := Clean(once, gitconfigRules)
+	if err != nil {
+		t.Fatalf("second Clean failed: %v", err)
+	}
+	if string(once) != string(twice) {
+		t.Errorf("cleaning cleaned content changed it: %q", twice)
+	}
+	if len(captured) != 0 {
+		t.Errorf("placeholders should not be captured as values: %v", captured)
+	}
+}
+
+func TestCleanWholeMatchWithoutGroups(t *testing.T) {
+	rules := []config.FilterRule{{Pattern: `npm_[A-Za-z0-9]+`, Placeholder: "npm_token"}}
+	cleaned, captured, err := Clean([]byte("//registry/:_authToken=npm_abc123\n"), rules)
+	if err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if string(cleaned) != "//registry/:_authToken="+Placeholder("npm_token")+"\n" {
+		t.Errorf("Clean = %q", cleaned)
+	}
+	if captured["npm_token"] != "npm_abc123" {
+		t.Errorf("captured = %v", captured)
+	}
+}
+
+func TestCleanConflictingValues(t *testing.T) {
+	rules := []config.FilterRule{{Pattern: `host = (\S+)`, Placeholder: "host"}}
+	if _, _, err := Clean([]byte("host = a\nhost = b\n"), rules); err == nil {
+		t.Error("Clean should fail when one placeholder matches different values")
+	}
+}
+
+func TestCleanInvalidRules(t *testing.T) {
+	if _, _, err := Clean([]byte("x"), []config.FilterRule{{Pattern: "(", Placeholder: "x"}}); err == nil {
+		t.Error("Clean should reject invalid patterns")
+	}
+	if _, _, err := Clean([]byte("x"), []config.FilterRule{{Pattern: "x"}}); err == nil {
+		t.Error("Clean should reject rules without placeholder")
+	}
+}
+
+func TestSmudgeRoundTrip(t *testing.T) {
+	cleaned, captured, err := Clean([]byte(gitconfig), gitconfigRules)
+	if err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	smudged, err := Smudge(cleaned, captured)
+	if err != nil {
+		t.Fatalf("Smudge failed: %v", err)
+	}
+	if string(smudged) != gitconfig {
+		t.Errorf("Smudge = %q, want %q", smudged, gitconfig)
+	}
+}
+
+func TestSmudgeMissingValues(t *testing.T) {
+	content := []byte(Placeholder("b") + Placeholder("a") + Placeholder("b"))
+	_, err := Smudge(content, Values{})
+	var missing *MissingValuesError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Smudge error = %v, want MissingValuesError", err)
+	}
+	if !reflect.DeepEqual(missing.Names, []string{"a", "b"}) {
+		t.Errorf("missing names = %v", missing.Names)
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	content := []byte(`a {{value "x"}} b {{ value "y" }} c {{ value "x" }}`)
+	if got := Placeholders(content); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("Placeholders = %v", got)
+	}
+}
+
+func TestValuesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dots", "values.yaml")
+	values, err := LoadValues(path)
+	if err != nil {
+		t.Fatalf("LoadValues on missing file failed: %v", err)
+	}
+	if len(values) != 0 {
+		t.Errorf("missing file should load as empty values")
+	}
+	if err := SaveValues(path, Values{"token": "s3cret"}); err != nil {
+		t.Fatalf("SaveValues failed: %v", err)
+	}
+	loaded, err := LoadValues(path)
+	if err != nil {
+		t.Fatalf("LoadValues failed: %v", err)
+	}
+	if loaded["token"] != "s3cret" {
+		t.Errorf("loaded = %v", loaded)
+	}
+}
+
+func TestCleanSecretRule(t *testing.T) {
+	rules := []config.FilterRule{{Pattern: `_authToken=(\S+)`, Secret: "npm/token"}}
+	cleaned, captured, err := Clean([]byte("_authToken=npm_abc\n"), rules)
+	if err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if string(cleaned) != "_authToken="+SecretPlaceholder("npm/token")+"\n" {
+		t.Errorf("Clean = %q", cleaned)
+	}
+	if len(captured) != 0 {
+		t.Errorf("secret rules must not capture values: %v", captured)
+	}
+	if _, _, err := Clean([]byte("x"), []config.FilterRule{{Pattern: "x", Placeholder: "a", Secret: "b"}}); err == nil {
+		t.Error("Clean should reject rules with both placeholder and secret")
+	}
+}
+
+func lookupFrom(values map[string]string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		value, ok := values[name]
+		if !ok {
+			return "", errors.New("not found: " + name)
+		}
+		return value, nil
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	content := []byte(`token={{ secret "a" }} again={{secret "a"}} b={{ secret "b" }}`)
+	resolved, err := ResolveSecrets(content, lookupFrom(map[string]string{"a": "1", "b": "2"}))
+	if err != nil {
+		t.Fatalf("ResolveSecrets failed: %v", err)
+	}
+	if string(resolved) != "token=1 again=1 b=2" {
+		t.Errorf("ResolveSecrets = %q", resolved)
+	}
+	if _, err := ResolveSecrets(content, lookupFrom(nil)); err == nil {
+		t.Error("ResolveSecrets should fail when a secret cannot be found")
+	}
+	if !reflect.DeepEqual(SecretReferences(content), []string{"a", "b"}) {
+		t.Errorf("SecretReferences = %v", SecretReferences(content))
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	template := []byte("user=me\ntoken=" + SecretPlaceholder("token") + "\n")
+	failing := lookupFrom(nil)
+
+	masked, err := MaskSecrets([]byte("user=me\ntoken=anything\n"), template, failing)
+	if err != nil {
+		t.Fatalf("MaskSecrets failed: %v", err)
+	}
+	if string(masked) != string(template) {
+		t.Errorf("matching content should mask to the template, got %q", masked)
+	}
+
+	masked, err = MaskSecrets([]byte("user=you\ntoken=hunter22\n"), template, lookupFrom(map[string]string{"token": "hunter22"}))
+	if err != nil {
+		t.Fatalf("MaskSecrets failed: %v", err)
+	}
+	if string(masked) != "user=you\ntoken="+SecretPlaceholder("token")+"\n" {
+		t.Errorf("MaskSecrets = %q", masked)
+	}
+
+	if _, err := MaskSecrets([]byte("user=you\n"), template, failing); err == nil {
+		t.Error("MaskSecrets should fail when it needs an unavailable secret")
+	}
+	plain := []byte("no references\n")
+	if masked, _ := MaskSecrets([]byte("other\n"), plain, failing); string(masked) != "other\n" {
+		t.Errorf("content without references should be unchanged, got %q", masked)
+	}
+}
+
+func TestMaskSecretsDetectsSurroundingChanges(t *testing.T) {
+	template := []byte("token=" + SecretPlaceholder("token") + "\n")
+	masked, err := MaskSecrets([]byte("token=hunter22\nextra=1\n"), template, lookupFrom(map[string]string{"token": "hunter22"}))
+	if err != nil {
+		t.Fatalf("MaskSecrets failed: %v", err)
+	}
+	if string(masked) != "token="+SecretPlaceholder("token")+"\nextra=1\n" {
+		t.Errorf("MaskSecrets = %q", masked)
+	}
+}
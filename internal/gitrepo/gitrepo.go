@@ -0,0 +1,349 @@
+package gitrepo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+var ErrNoRemote = errors.New("no git remote configured, run 'dots remote add <url>'")
+
+type Repo struct {
+	Dir string
+}
+
+type Change struct {
+	Status byte
+	Path   string
+}
+
+type Remote struct {
+	Name string
+	URL  string
+}
+
+func Open(dir string) *Repo {
+	return &Repo{Dir: dir}
+}
+
+func Init(dir string) (*Repo, error) {
+	repo := Open(dir)
+	if _, err := repo.git("init", "--quiet"); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func Clone(url, dir string) (*Repo, error) {
+	if _, err := Open("").git("clone", "--quiet", url, dir); err != nil {
+		return nil, err
+	}
+	return Open(dir), nil
+}
+
+func (r *Repo) Exists() bool {
+	_, err := os.Stat(filepath.Join(r.Dir, ".git"))
+	return err == nil
+}
+
+func (r *Repo) git(args ...string) (string, error) {
+	if r.Dir != "" {
+		args = append([]string{"-C", r.Dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = strings.TrimSpace(stdout.String())
+		}
+		command := args[0]
+		if r.Dir != "" {
+			command = args[2]
+		}
+		return "", fmt.Errorf("git %s: %w (%s)", command, err, message)
+	}
+	return stdout.String(), nil
+}
+
+func (r *Repo) Head() (string, error) {
+	if _, err := r.git("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return "", nil
+	}
+	out, err := r.git("rev-parse", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+func (r *Repo) Branch() (string, error) {
+	out, err := r.git("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *Repo) StageAll() error {
+	_, err := r.git("add", "-A")
+	return err
+}
+
+func (r *Repo) StagedChanges() ([]Change, error) {
+	out, err := r.git("diff", "--cached", "--name-status", "--no-renames", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return parseNameStatus(out), nil
+}
+
+func (r *Repo) ChangedBetween(from, to string) ([]Change, error) {
+	if from == "" {
+		out, err := r.git("ls-tree", "-r", "--name-only", "-z", to)
+		if err != nil {
+			return nil, err
+		}
+		var changes []Change
+		for _, path := range strings.Split(strings.TrimSuffix(out, "\x00"), "\x00") {
+			if path != "" {
+				changes = append(changes, Change{Status: 'A', Path: path})
+			}
+		}
+		return changes, nil
+	}
+	out, err := r.git("diff", "--name-status", "--no-renames", "-z", from, to)
+	if err != nil {
+		return nil, err
+	}
+	return parseNameStatus(out), nil
+}
+
+func parseNameStatus(out string) []Change {
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	var changes []Change
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "" {
+			continue
+		}
+		changes = append(changes, Change{Status: fields[i][0], Path: fields[i+1]})
+	}
+	return changes
+}
+
+func (r *Repo) Uncommitted() ([]string, error) {
+	if head, err := r.Head(); err != nil || head == "" {
+		return nil, err
+	}
+	out, err := r.git("diff", "--name-only", "--no-renames", "-z", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, path := range strings.Split(strings.TrimSuffix(out, "\x00"), "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func (r *Repo) Commit(message string) error {
+	_, err := r.git("commit", "--quiet", "-m", message)
+	return err
+}
+
+func (r *Repo) Show(rev, path string) ([]byte, error) {
+	out, err := r.git("show", rev+":"+path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+func (r *Repo) SetConfig(key, value string) error {
+	_, err := r.git("config", key, value)
+	return err
+}
+
+func (r *Repo) Remotes() ([]Remote, error) {
+	out, err := r.git("remote")
+	if err != nil {
+		return nil, err
+	}
+	var remotes []Remote
+	for _, name := range strings.Fields(out) {
+		url, err := r.git("remote", "get-url", name)
+		if err != nil {
+			return nil, err
+		}
+		remotes = append(remotes, Remote{Name: name, URL: strings.TrimSpace(url)})
+	}
+	return remotes, nil
+}
+
+func (r *Repo) AddRemote(name, url string) error {
+	_, err := r.git("remote", "add", name, url)
+	return err
+}
+
+func (r *Repo) RemoveRemote(name string) error {
+	_, err := r.git("remote", "remove", name)
+	return err
+}
+
+func (r *Repo) SetRemoteURL(name, url string) error {
+	_, err := r.git("remote", "set-url", name, url)
+	return err
+}
+
+func (r *Repo) Upstream() (string, error) {
+	out, err := r.git("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *Repo) defaultRemote() (string, error) {
+	remotes, err := r.Remotes()
+	if err != nil {
+		return "", err
+	}
+	if len(remotes) == 0 {
+		return "", ErrNoRemote
+	}
+	for _, remote := range remotes {
+		if remote.Name == "origin" {
+			return remote.Name, nil
+		}
+	}
+	return remotes[0].Name, nil
+}
+
+func (r *Repo) Push() error {
+	upstream, err := r.Upstream()
+	if err != nil {
+		return err
+	}
+	if upstream != "" {
+		_, err := r.git("push", "--quiet")
+		return err
+	}
+	remote, err := r.defaultRemote()
+	if err != nil {
+		return err
+	}
+	branch, err := r.Branch()
+	if err != nil {
+		return err
+	}
+	_, err = r.git("push", "--quiet", "--set-upstream", remote, branch)
+	return err
+}
+
+func (r *Repo) remoteBranch() (string, error) {
+	upstream, err := r.Upstream()
+	if err != nil || upstream != "" {
+		return upstream, err
+	}
+	remote, err := r.defaultRemote()
+	if err != nil {
+		return "", err
+	}
+	branch, err := r.Branch()
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.git("fetch", "--quiet", remote); err != nil {
+		return "", err
+	}
+	ref := remote + "/" + branch
+	if _, err := r.git("rev-parse", "--verify", "--quiet", "refs/remotes/"+ref); err != nil {
+		return "", nil
+	}
+	return ref, nil
+}
+
+func (r *Repo) Fetch() (string, error) {
+	ref, err := r.remoteBranch()
+	if err != nil || ref == "" {
+		return "", err
+	}
+	remote := strings.SplitN(ref, "/", 2)[0]
+	if _, err := r.git("fetch", "--quiet", remote); err != nil {
+		return "", err
+	}
+	out, err := r.git("rev-parse", ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *Repo) Pull() error {
+	upstream, err := r.Upstream()
+	if err != nil {
+		return err
+	}
+	if upstream == "" {
+		ref, err := r.remoteBranch()
+		if err != nil || ref == "" {
+			return err
+		}
+		if head, _ := r.Head(); head == "" {
+			if err := r.ResetHard(ref); err != nil {
+				return err
+			}
+		}
+		if _, err := r.git("branch", "--quiet", "--set-upstream-to", ref); err != nil {
+			return err
+		}
+	}
+	_, err = r.git("pull", "--quiet", "--rebase", "--autostash")
+	return err
+}
+
+func (r *Repo) MergeBase(a, b string) (string, error) {
+	out, err := r.git("merge-base", a, b)
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *Repo) Diff(from, to string, paths ...string) (string, error) {
+	if from == "" {
+		from = emptyTree
+	}
+	args := []string{"diff", "--no-color", "--no-renames", from, to, "--"}
+	return r.git(append(args, paths...)...)
+}
+
+func (r *Repo) Stash() (bool, error) {
+	dirty, err := r.Dirty()
+	if err != nil || !dirty {
+		return false, err
+	}
+	if _, err := r.git("stash", "push", "--quiet", "--message", "dots pull"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Repo) Unstash() error {
+	if _, err := r.git("stash", "pop", "--quiet", "--index"); err != nil {
+		return fmt.Errorf("restore uncommitted changes, they are kept in 'git stash list': %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) ResetHard(rev string) error {
+	_, err := r.git("reset", "--quiet", "--hard", rev)
+	return err
+}
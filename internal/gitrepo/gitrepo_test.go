@@ -0,0 +1,375 @@
+package gitrepo
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@example.com")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func commitAll(t *testing.T, repo *Repo, message string) {
+	t.Helper()
+	if err := repo.StageAll(); err != nil {
+		t.Fatalf("StageAll failed: %v", err)
+	}
+	if err := repo.Commit(message); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestPushPullRoundTrip(t *testing.T) {
+	requireGit(t)
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if _, err := Open("").git("init", "--quiet", "--bare", remote); err != nil {
+		t.Fatalf("init bare: %v", err)
+	}
+
+	first, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if head, err := first.Head(); err != nil || head != "" {
+		t.Fatalf("Head on empty repo = %q, %v", head, err)
+	}
+	if err := first.Push(); !errors.Is(err, ErrNoRemote) {
+		t.Fatalf("Push without remote = %v, want ErrNoRemote", err)
+	}
+	if err := first.AddRemote("origin", remote); err != nil {
+		t.Fatalf("AddRemote failed: %v", err)
+	}
+	writeFile(t, filepath.Join(first.Dir, ".bashrc"), "alias ll='ls -l'\n")
+	commitAll(t, first, "Add ~/.bashrc")
+	if err := first.Push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	second, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := second.AddRemote("origin", remote); err != nil {
+		t.Fatalf("AddRemote failed: %v", err)
+	}
+	if err := second.Pull(); err != nil {
+		t.Fatalf("Pull into empty repo failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(second.Dir, ".bashrc")); err != nil {
+		t.Fatalf("pulled file missing: %v", err)
+	}
+
+	writeFile(t, filepath.Join(first.Dir, ".vimrc"), "set number\n")
+	writeFile(t, filepath.Join(first.Dir, ".bashrc"), "alias ll='ls -la'\n")
+	commitAll(t, first, "Add ~/.vimrc")
+	if err := first.Push(); err != nil {
+		t.Fatalf("second Push failed: %v", err)
+	}
+
+	before, _ := second.Head()
+	incoming, err := second.Fetch()
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if head, _ := second.Head(); head != before {
+		t.Fatal("Fetch moved HEAD")
+	}
+	if pushed, _ := first.Head(); incoming != pushed {
+		t.Errorf("Fetch = %s, want %s", incoming, pushed)
+	}
+	if base, _ := second.MergeBase(before, incoming); base != before {
+		t.Errorf("MergeBase = %s, want %s", base, before)
+	}
+	if diff, err := second.Diff(before, incoming, ".vimrc"); err != nil || !strings.Contains(diff, "+set number") {
+		t.Errorf("Diff = %q, %v", diff, err)
+	}
+	if err := second.Pull(); err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	after, _ := second.Head()
+	changes, err := second.ChangedBetween(before, after)
+	if err != nil {
+		t.Fatalf("ChangedBetween failed: %v", err)
+	}
+	got := map[string]byte{}
+	for _, change := range changes {
+		got[change.Path] = change.Status
+	}
+	if got[".vimrc"] != 'A' || got[".bashrc"] != 'M' || len(got) != 2 {
+		t.Errorf("changes = %v", changes)
+	}
+}
+
+func TestRollbackKeepsUncommittedChanges(t *testing.T) {
+	requireGit(t)
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if _, err := Open("").git("init", "--quiet", "--bare", remote); err != nil {
+		t.Fatalf("init bare: %v", err)
+	}
+	upstream, err := Clone(remote, t.TempDir())
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	writeFile(t, filepath.Join(upstream.Dir, ".zshrc"), "export A=1\n")
+	writeFile(t, filepath.Join(upstream.Dir, config.ManifestName), "files: []\n")
+	commitAll(t, upstream, "Add ~/.zshrc")
+	if err := upstream.Push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	local, err := Clone(remote, filepath.Join(t.TempDir(), "local"))
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	writeFile(t, filepath.Join(upstream.Dir, config.ManifestName), "policy:\n  forbidden: [~/.zshrc]\n")
+	commitAll(t, upstream, "Forbid ~/.zshrc")
+	if err := upstream.Push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	zshrc := filepath.Join(local.Dir, ".zshrc")
+	writeFile(t, zshrc, "export A=2\n")
+	oldHead, _ := local.Head()
+	stashed, err := local.Stash()
+	if err != nil || !stashed {
+		t.Fatalf("Stash = %v, %v", stashed, err)
+	}
+	if err := local.Pull(); err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if err := local.ResetHard(oldHead); err != nil {
+		t.Fatalf("ResetHard failed: %v", err)
+	}
+	if err := local.Unstash(); err != nil {
+		t.Fatalf("Unstash failed: %v", err)
+	}
+	if data, _ := os.ReadFile(zshrc); string(data) != "export A=2\n" {
+		t.Errorf("uncommitted edit after rollback = %q", data)
+	}
+	if head, _ := local.Head(); head != oldHead {
+		t.Errorf("HEAD after rollback = %s, want %s", head, oldHead)
+	}
+	if list, _ := local.git("stash", "list"); strings.TrimSpace(list) != "" {
+		t.Errorf("stash not dropped after restore: %q", list)
+	}
+}
+
+func TestRemotes(t *testing.T) {
+	requireGit(t)
+	repo, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := repo.AddRemote("origin", "/tmp/one.git"); err != nil {
+		t.Fatalf("AddRemote failed: %v", err)
+	}
+	if err := repo.SetRemoteURL("origin", "/tmp/two.git"); err != nil {
+		t.Fatalf("SetRemoteURL failed: %v", err)
+	}
+	remotes, err := repo.Remotes()
+	if err != nil || len(remotes) != 1 || remotes[0].URL != "/tmp/two.git" {
+		t.Fatalf("Remotes = %v, %v", remotes, err)
+	}
+	if err := repo.RemoveRemote("origin"); err != nil {
+		t.Fatalf("RemoveRemote failed: %v", err)
+	}
+	if remotes, _ := repo.Remotes(); len(remotes) != 0 {
+		t.Errorf("remotes after remove = %v", remotes)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	home := t.TempDir()
+	dir := config.DotsDir(home)
+	entry := func(name string) config.FileEntry {
+		return config.FileEntry{Source: filepath.Join(dir, name), Target: filepath.Join(home, name)}
+	}
+	old := &config.Manifest{Files: []config.FileEntry{entry(".bashrc"), entry(".vimrc"), entry(".zshrc")}}
+	encrypted := entry(".zshrc")
+	encrypted.Encrypted = true
+	local := entry(".netrc")
+	local.Local = true
+	current := &config.Manifest{Files: []config.FileEntry{entry(".bashrc"), encrypted, entry(".gitconfig"), local}}
+
+	summary := Summarize(dir, home, old, current, []Change{{Status: 'M', Path: ".bashrc"}})
+	message := summary.Message()
+	subject := strings.SplitN(message, "\n", 2)[0]
+	if want := "Add ~/.gitconfig; Update ~/.bashrc, ~/.zshrc; Remove ~/.vimrc"; subject != want {
+		t.Errorf("subject = %q, want %q", subject, want)
+	}
+	if !strings.Contains(message, "\nD ~/.vimrc") || strings.Contains(message, ".netrc") {
+		t.Errorf("message = %q", message)
+	}
+
+	var many []config.FileEntry
+	for _, name := range []string{".a-long-file-name", ".another-long-file-name", ".yet-another-long-file-name"} {
+		many = append(many, entry(name))
+	}
+	subject = strings.SplitN(Summarize(dir, home, nil, &config.Manifest{Files: many}, nil).Message(), "\n", 2)[0]
+	if subject != "Add 3 files" {
+		t.Errorf("long subject = %q", subject)
+	}
+
+	if got := Summarize(dir, home, old, old, nil).Message(); got != "Update dots configuration" {
+		t.Errorf("empty message = %q", got)
+	}
+}
+
+func TestCompareManifests(t *testing.T) {
+	home := t.TempDir()
+	dir := config.DotsDir(home)
+	entry := func(source, target string) config.FileEntry {
+		return config.FileEntry{Source: filepath.Join(dir, source), Target: filepath.Join(home, target)}
+	}
+	encrypted := entry(".netrc", ".netrc")
+	encrypted.Encrypted = true
+	old := &config.Manifest{Files: []config.FileEntry{entry(".bashrc", ".bashrc"), entry("nvim", ".vimrc"), entry(".zshrc", ".zshrc"), entry(".netrc", ".netrc")}}
+	current := &config.Manifest{Files: []config.FileEntry{entry(".bashrc", ".bashrc"), entry("nvim", ".config/nvim/init.vim"), entry(".gitconfig", ".gitconfig"), encrypted}}
+
+	changes := CompareManifests(old, current)
+	got := map[string]EntryChangeKind{}
+	for _, change := range changes {
+		got[config.ContractTarget(change.Target(), home)] = change.Kind
+	}
+	want := map[string]EntryChangeKind{
+		"~/.config/nvim/init.vim": EntryRetargeted,
+		"~/.gitconfig":            EntryAdded,
+		"~/.netrc":                EntryModified,
+		"~/.zshrc":                EntryRemoved,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for target, kind := range want {
+		if got[target] != kind {
+			t.Errorf("%s: kind = %s, want %s", target, got[target], kind)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	requireGit(t)
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if _, err := Open("").git("init", "--quiet", "--bare", remote); err != nil {
+		t.Fatalf("init bare: %v", err)
+	}
+	repo, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := repo.AddRemote("origin", remote); err != nil {
+		t.Fatalf("AddRemote failed: %v", err)
+	}
+	writeFile(t, filepath.Join(repo.Dir, ".bashrc"), "one\n")
+	writeFile(t, filepath.Join(repo.Dir, ".vimrc"), "one\n")
+	commitAll(t, repo, "initial")
+	if err := repo.Push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	writeFile(t, filepath.Join(repo.Dir, ".zshrc"), "new\n")
+	commitAll(t, repo, "zsh")
+
+	writeFile(t, filepath.Join(repo.Dir, ".bashrc"), "two\n")
+	writeFile(t, filepath.Join(repo.Dir, ".vimrc"), "two\n")
+	if _, err := repo.git("add", ".vimrc"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(repo.Dir, "stray file"), "?\n")
+
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	branch, _ := repo.Branch()
+	if status.Branch != branch || status.Upstream != "origin/"+branch || status.Ahead != 1 || status.Behind != 0 {
+		t.Errorf("branch = %+v", status)
+	}
+	want := map[string]string{".bashrc": "modified", ".vimrc": "staged", "stray file": "untracked"}
+	if len(status.Files) != len(want) {
+		t.Errorf("files = %v", status.Files)
+	}
+	for path, label := range want {
+		if got := strings.Join(status.Files[path].Labels(), ","); got != label {
+			t.Errorf("%s: labels = %q, want %q", path, got, label)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	requireGit(t)
+	repo, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	path := filepath.Join(repo.Dir, ".zshrc")
+	writeFile(t, path, "one\n")
+	t.Setenv("GIT_AUTHOR_DATE", "2026-10-01T10:00:00Z")
+	t.Setenv("GIT_COMMITTER_DATE", "2026-10-01T10:00:00Z")
+	commitAll(t, repo, "first")
+	writeFile(t, path, "two\n")
+	writeFile(t, filepath.Join(repo.Dir, ".vimrc"), "set number\n")
+	t.Setenv("GIT_AUTHOR_DATE", "2026-10-10T10:00:00Z")
+	t.Setenv("GIT_COMMITTER_DATE", "2026-10-10T10:00:00Z")
+	commitAll(t, repo, "second")
+	writeFile(t, filepath.Join(repo.Dir, ".vimrc"), "set nonumber\n")
+	commitAll(t, repo, "third")
+
+	commits, err := repo.Log(".zshrc")
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "second" || commits[1].Subject != "first" {
+		t.Fatalf("Log = %+v", commits)
+	}
+
+	hash, err := repo.Resolve("2026-10-05")
+	if err != nil || hash != commits[1].Hash {
+		t.Errorf("Resolve(date) = %s, %v, want %s", hash, err, commits[1].Hash)
+	}
+	if hash, err := repo.Resolve("HEAD~1"); err != nil || hash != commits[0].Hash {
+		t.Errorf("Resolve(rev) = %s, %v", hash, err)
+	}
+	if _, err := repo.Resolve("2020-01-01"); err == nil {
+		t.Error("Resolve should fail before the first commit")
+	}
+
+	branch, _ := repo.Branch()
+	if err := repo.BeginCheckout(commits[1].Hash); err != nil {
+		t.Fatalf("BeginCheckout failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "one\n" {
+		t.Errorf("checked out content = %q", data)
+	}
+	if original, active := repo.CheckedOut(); !active || original != branch {
+		t.Errorf("CheckedOut = %q, %v", original, active)
+	}
+	if back, err := repo.EndCheckout(); err != nil || back != branch {
+		t.Fatalf("EndCheckout = %q, %v", back, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "two\n" {
+		t.Errorf("content after EndCheckout = %q", data)
+	}
+	if _, active := repo.CheckedOut(); active {
+		t.Error("checkout still active")
+	}
+}
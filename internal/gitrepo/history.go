@@ -0,0 +1,184 @@
+package gitrepo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const checkoutMarker = "dots-checkout"
+
+type Commit struct {
+	Hash    string
+	Author  string
+	Date    time.Time
+	Subject string
+}
+
+func (c Commit) Short() string {
+	if len(c.Hash) > 7 {
+		return c.Hash[:7]
+	}
+	return c.Hash
+}
+
+func (r *Repo) Log(path string) ([]Commit, error) {
+	if head, err := r.Head(); err != nil || head == "" {
+		return nil, err
+	}
+	out, err := r.git("log", "--format=%H%x1f%an%x1f%aI%x1f%s", "--", path)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.SplitN(line, "\x1f", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("parse commit date: %w", err)
+		}
+		commits = append(commits, Commit{Hash: fields[0], Author: fields[1], Date: date, Subject: fields[3]})
+	}
+	return commits, nil
+}
+
+func (r *Repo) Revision(spec string) (string, bool) {
+	out, err := r.git("rev-parse", "--verify", "--quiet", spec+"^{commit}")
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(out), true
+}
+
+func (r *Repo) Resolve(spec string) (string, error) {
+	if hash, ok := r.Revision(spec); ok {
+		return hash, nil
+	}
+	out, err := r.git("rev-list", "-1", "--before="+spec, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("resolve %q: not a revision or date", spec)
+	}
+	hash := strings.TrimSpace(out)
+	if hash == "" {
+		return "", fmt.Errorf("no commit at or before %q", spec)
+	}
+	return hash, nil
+}
+
+func (r *Repo) LastContent(path string) ([]byte, error) {
+	out, err := r.git("rev-list", "-1", "HEAD", "--", path)
+	if err != nil {
+		return nil, err
+	}
+	last := strings.TrimSpace(out)
+	if last == "" {
+		return nil, fmt.Errorf("%s has no history", path)
+	}
+	if content, err := r.Show(last, path); err == nil {
+		return content, nil
+	}
+	return r.Show(last+"^", path)
+}
+
+func (r *Repo) Describe(rev string) (Commit, error) {
+	out, err := r.git("show", "-s", "--format=%H%x1f%an%x1f%aI%x1f%s", rev)
+	if err != nil {
+		return Commit{}, err
+	}
+	fields := strings.SplitN(strings.TrimSpace(out), "\x1f", 4)
+	if len(fields) != 4 {
+		return Commit{}, fmt.Errorf("describe %s: unexpected output", rev)
+	}
+	date, err := time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return Commit{}, fmt.Errorf("parse commit date: %w", err)
+	}
+	return Commit{Hash: fields[0], Author: fields[1], Date: date, Subject: fields[3]}, nil
+}
+
+func (r *Repo) markerPath() string {
+	return filepath.Join(r.Dir, ".git", checkoutMarker)
+}
+
+func (r *Repo) CheckedOut() (string, bool) {
+	data, err := os.ReadFile(r.markerPath())
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+func (r *Repo) Dirty() (bool, error) {
+	status, err := r.Status()
+	if err != nil {
+		return false, err
+	}
+	for _, state := range status.Files {
+		if state.Staged || state.Modified || state.Conflicted {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Repo) BeginCheckout(rev string) error {
+	if dirty, err := r.Dirty(); err != nil || dirty {
+		if err == nil {
+			err = errors.New("the dots repository has uncommitted changes, commit them first")
+		}
+		return err
+	}
+	if _, active := r.CheckedOut(); !active {
+		branch, err := r.Branch()
+		if err != nil {
+			return fmt.Errorf("not on a branch: %w", err)
+		}
+		if err := os.WriteFile(r.markerPath(), []byte(branch+"\n"), 0o644); err != nil {
+			return fmt.Errorf("record branch: %w", err)
+		}
+	}
+	_, err := r.git("checkout", "--quiet", "--detach", rev)
+	return err
+}
+
+func (r *Repo) EndCheckout() (string, error) {
+	branch, active := r.CheckedOut()
+	if !active {
+		return "", errors.New("no checkout in progress")
+	}
+	if dirty, err := r.Dirty(); err != nil || dirty {
+		if err == nil {
+			err = errors.New("the dots repository has uncommitted changes made during the checkout, commit or discard them first")
+		}
+		return "", err
+	}
+	if _, err := r.git("checkout", "--quiet", branch); err != nil {
+		return "", err
+	}
+	if err := os.Remove(r.markerPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("clear checkout marker: %w", err)
+	}
+	return branch, nil
+}
+
+func (r *Repo) AddWorktree(dir, rev string) error {
+	_, err := r.git("worktree", "add", "--quiet", "--detach", dir, rev)
+	return err
+}
+
+func (r *Repo) RemoveWorktree(dir string) error {
+	if _, err := r.git("worktree", "remove", "--force", dir); err != nil {
+		if _, statErr := os.Stat(dir); errors.Is(statErr, fs.ErrNotExist) {
+			_, err = r.git("worktree", "prune")
+		}
+		return err
+	}
+	return nil
+}
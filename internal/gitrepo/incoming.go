@@ -0,0 +1,65 @@
+package gitrepo
+
+import (
+	"sort"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+type EntryChangeKind string
+
+const (
+	EntryAdded      EntryChangeKind = "added"
+	EntryRemoved    EntryChangeKind = "removed"
+	EntryRetargeted EntryChangeKind = "retargeted"
+	EntryModified   EntryChangeKind = "modified"
+)
+
+type EntryChange struct {
+	Kind EntryChangeKind
+	Old  config.FileEntry
+	New  config.FileEntry
+}
+
+func (c EntryChange) Target() string {
+	if c.Kind == EntryRemoved {
+		return c.Old.Target
+	}
+	return c.New.Target
+}
+
+func CompareManifests(old, current *config.Manifest) []EntryChange {
+	before, after := shared(old), shared(current)
+	bySource := map[string]config.FileEntry{}
+	for _, entry := range before {
+		bySource[entry.Source] = entry
+	}
+	var changes []EntryChange
+	moved := map[string]bool{}
+	for target, entry := range after {
+		previous, ok := before[target]
+		switch {
+		case ok && previous != entry:
+			changes = append(changes, EntryChange{Kind: EntryModified, Old: previous, New: entry})
+		case ok:
+		default:
+			if source, found := bySource[entry.Source]; found {
+				if _, kept := after[source.Target]; !kept {
+					moved[source.Target] = true
+					changes = append(changes, EntryChange{Kind: EntryRetargeted, Old: source, New: entry})
+					continue
+				}
+			}
+			changes = append(changes, EntryChange{Kind: EntryAdded, New: entry})
+		}
+	}
+	for target, entry := range before {
+		if _, ok := after[target]; !ok && !moved[target] {
+			changes = append(changes, EntryChange{Kind: EntryRemoved, Old: entry})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Target() < changes[j].Target()
+	})
+	return changes
+}
@@ -0,0 +1,98 @@
+package gitrepo
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+const maxSubject = 72
+
+type Summary struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+func (s Summary) Empty() bool {
+	return len(s.Added)+len(s.Updated)+len(s.Removed) == 0
+}
+
+func Summarize(dir, home string, old, current *config.Manifest, changes []Change) Summary {
+	changed := map[string]bool{}
+	for _, change := range changes {
+		changed[filepath.Join(dir, filepath.FromSlash(change.Path))] = true
+	}
+	before := shared(old)
+	after := shared(current)
+
+	var summary Summary
+	for target, entry := range after {
+		previous, ok := before[target]
+		display := config.ContractTarget(target, home)
+		switch {
+		case !ok:
+			summary.Added = append(summary.Added, display)
+		case previous != entry || changed[entry.Source]:
+			summary.Updated = append(summary.Updated, display)
+		}
+	}
+	for target := range before {
+		if _, ok := after[target]; !ok {
+			summary.Removed = append(summary.Removed, config.ContractTarget(target, home))
+		}
+	}
+	sort.Strings(summary.Added)
+	sort.Strings(summary.Updated)
+	sort.Strings(summary.Removed)
+	return summary
+}
+
+func shared(manifest *config.Manifest) map[string]config.FileEntry {
+	entries := map[string]config.FileEntry{}
+	if manifest == nil {
+		return entries
+	}
+	for _, entry := range manifest.Files {
+		if !entry.Local && entry.Layer == "" {
+			entries[entry.Target] = entry
+		}
+	}
+	return entries
+}
+
+func (s Summary) Message() string {
+	if s.Empty() {
+		return "Update dots configuration"
+	}
+	var parts, counts, body []string
+	add := func(verb string, targets []string, prefix string) {
+		if len(targets) == 0 {
+			return
+		}
+		parts = append(parts, verb+" "+strings.Join(targets, ", "))
+		counts = append(counts, fmt.Sprintf("%s %d %s", verb, len(targets), plural(len(targets))))
+		for _, target := range targets {
+			body = append(body, prefix+" "+target)
+		}
+	}
+	add("Add", s.Added, "A")
+	add("Update", s.Updated, "M")
+	add("Remove", s.Removed, "D")
+
+	subject := strings.Join(parts, "; ")
+	if len(subject) > maxSubject {
+		subject = strings.Join(counts, "; ")
+	}
+	return subject + "\n\n" + strings.Join(body, "\n") + "\n"
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return "file"
+	}
+	return "files"
+}
@@ -0,0 +1,102 @@
+package gitrepo
+
+import (
+	"strconv"
+	"strings"
+)
+
+type FileState struct {
+	Staged     bool
+	Modified   bool
+	Untracked  bool
+	Conflicted bool
+}
+
+func (s FileState) Labels() []string {
+	var labels []string
+	if s.Conflicted {
+		labels = append(labels, "conflicted")
+	}
+	if s.Staged {
+		labels = append(labels, "staged")
+	}
+	if s.Modified {
+		labels = append(labels, "modified")
+	}
+	if s.Untracked {
+		labels = append(labels, "untracked")
+	}
+	return labels
+}
+
+type Status struct {
+	Branch   string
+	Upstream string
+	Ahead    int
+	Behind   int
+	Files    map[string]FileState
+}
+
+func (r *Repo) Status() (*Status, error) {
+	out, err := r.git("status", "--porcelain=v2", "--branch", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(out), nil
+}
+
+func parseStatus(out string) *Status {
+	status := &Status{Files: map[string]FileState{}}
+	records := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if len(record) < 2 {
+			continue
+		}
+		switch record[0] {
+		case '#':
+			parseBranchHeader(status, record)
+		case '?':
+			status.Files[record[2:]] = FileState{Untracked: true}
+		case '1':
+			if fields := strings.SplitN(record, " ", 9); len(fields) == 9 {
+				status.Files[fields[8]] = changeState(fields[1])
+			}
+		case '2':
+			if fields := strings.SplitN(record, " ", 10); len(fields) == 10 {
+				status.Files[fields[9]] = changeState(fields[1])
+			}
+			i++
+		case 'u':
+			if fields := strings.SplitN(record, " ", 11); len(fields) == 11 {
+				status.Files[fields[10]] = FileState{Conflicted: true}
+			}
+		}
+	}
+	return status
+}
+
+func parseBranchHeader(status *Status, record string) {
+	fields := strings.Fields(record)
+	if len(fields) < 3 {
+		return
+	}
+	switch fields[1] {
+	case "branch.head":
+		status.Branch = fields[2]
+	case "branch.upstream":
+		status.Upstream = fields[2]
+	case "branch.ab":
+		if len(fields) == 4 {
+			status.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+			status.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+		}
+	}
+}
+
+func changeState(xy string) FileState {
+	if len(xy) != 2 {
+		return FileState{}
+	}
+	return FileState{Staged: xy[0] != '.', Modified: xy[1] != '.'}
+}
@@ -0,0 +1,166 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+)
+
+type Event string
+
+const (
+	PreApply   Event = "pre_apply"
+	PostApply  Event = "post_apply"
+	PreAdd     Event = "pre_add"
+	PostAdd    Event = "post_add"
+	PreRemove  Event = "pre_remove"
+	PostRemove Event = "post_remove"
+	OnChange   Event = "on_change"
+)
+
+const DefaultTimeout = 30 * time.Second
+
+type Result struct {
+	Event   Event
+	Target  string
+	Command string
+	Output  string
+	Err     error
+}
+
+type Runner struct {
+	Home    string
+	Report  func(Result)
+	hooks   config.Hooks
+	timeout time.Duration
+	failed  []string
+}
+
+func New(home string, hooks config.Hooks) (*Runner, error) {
+	timeout, err := parseTimeout(hooks.Timeout, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range hooks.Files {
+		if _, err := parseTimeout(file.Timeout, timeout); err != nil {
+			return nil, fmt.Errorf("hooks for %s: %w", file.Target, err)
+		}
+	}
+	return &Runner{Home: home, hooks: hooks, timeout: timeout}, nil
+}
+
+func parseTimeout(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid hook timeout %q", value)
+	}
+	return timeout, nil
+}
+
+func (e Event) commands(set config.HookSet) []string {
+	switch e {
+	case PreApply:
+		return set.PreApply
+	case PostApply:
+		return set.PostApply
+	case PreAdd:
+		return set.PreAdd
+	case PostAdd:
+		return set.PostAdd
+	case PreRemove:
+		return set.PreRemove
+	case PostRemove:
+		return set.PostRemove
+	case OnChange:
+		return set.OnChange
+	}
+	return nil
+}
+
+func (r *Runner) Global(event Event, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	env := []string{"DOTS_TARGETS=" + strings.Join(targets, "\n")}
+	return r.run(event, "", event.commands(r.hooks.HookSet), r.timeout, env)
+}
+
+func (r *Runner) Entry(event Event, entry config.FileEntry, status string) error {
+	env := []string{
+		"DOTS_TARGET=" + entry.Target,
+		"DOTS_SOURCE=" + entry.Source,
+		"DOTS_STATUS=" + status,
+	}
+	for _, file := range r.hooks.Files {
+		ok, err := dotfile.MatchPattern(file.Target, entry.Target)
+		if err != nil {
+			err = fmt.Errorf("hook pattern %q: %w", file.Target, err)
+			if r.Report != nil {
+				r.Report(Result{Event: event, Target: entry.Target, Command: file.Target, Err: err})
+			}
+			r.failed = append(r.failed, err.Error())
+			return err
+		}
+		if !ok {
+			continue
+		}
+		timeout, _ := parseTimeout(file.Timeout, r.timeout)
+		if err := r.run(event, entry.Target, event.commands(file.HookSet), timeout, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) Err() error {
+	if len(r.failed) > 0 {
+		return fmt.Errorf("%d hooks failed: %s", len(r.failed), strings.Join(r.failed, "; "))
+	}
+	return nil
+}
+
+func (r *Runner) run(event Event, target string, commands []string, timeout time.Duration, env []string) error {
+	for _, command := range commands {
+		result := Result{Event: event, Target: target, Command: command}
+		result.Output, result.Err = r.exec(command, timeout, append([]string{"DOTS_EVENT=" + string(event), "DOTS_HOME=" + r.Home}, env...))
+		if r.Report != nil {
+			r.Report(result)
+		}
+		if result.Err != nil {
+			err := fmt.Errorf("%s hook %q: %w", event, command, result.Err)
+			r.failed = append(r.failed, err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) exec(command string, timeout time.Duration, env []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Dir = r.Home
+	cmd.Env = append(os.Environ(), env...)
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return string(out), fmt.Errorf("timed out after %s", timeout)
+	}
+	return string(out), err
+}
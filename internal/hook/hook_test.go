@@ -0,0 +1,133 @@
+package hook
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+func requireShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use sh")
+	}
+}
+
+func TestEntryHooksReceiveContext(t *testing.T) {
+	requireShell(t)
+	home := t.TempDir()
+	target := filepath.Join(home, ".config", "systemd", "user", "app.service")
+	runner, err := New(home, config.Hooks{Files: []config.FileHooks{
+		{Target: filepath.Join(home, ".config", "systemd", "user", "*.service"), HookSet: config.HookSet{
+			PostApply: []string{`echo "$DOTS_EVENT $DOTS_TARGET $DOTS_SOURCE $DOTS_STATUS"`},
+		}},
+		{Target: filepath.Join(home, ".tmux.conf"), HookSet: config.HookSet{PostApply: []string{"echo tmux"}}},
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var results []Result
+	runner.Report = func(result Result) { results = append(results, result) }
+
+	entry := config.FileEntry{Source: "/store/app.service", Target: target}
+	if err := runner.Entry(PostApply, entry, "missing"); err != nil {
+		t.Fatalf("Entry failed: %v", err)
+	}
+	if err := runner.Entry(PreApply, entry, "missing"); err != nil {
+		t.Fatalf("Entry failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("results = %+v, want one", results)
+	}
+	want := "post_apply " + target + " /store/app.service missing"
+	if got := strings.TrimSpace(results[0].Output); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if results[0].Target != target || results[0].Event != PostApply {
+		t.Errorf("result = %+v", results[0])
+	}
+}
+
+func TestGlobalHooks(t *testing.T) {
+	requireShell(t)
+	home := t.TempDir()
+	runner, err := New(home, config.Hooks{HookSet: config.HookSet{
+		OnChange: []string{`printf '%s' "$DOTS_TARGETS" > changed`},
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := runner.Global(OnChange, nil); err != nil {
+		t.Fatalf("Global failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "changed")); !os.IsNotExist(err) {
+		t.Fatal("global hook ran without changes")
+	}
+	if err := runner.Global(OnChange, []string{"/a", "/b"}); err != nil {
+		t.Fatalf("Global failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(home, "changed")); string(data) != "/a\n/b" {
+		t.Errorf("DOTS_TARGETS = %q", data)
+	}
+}
+
+func TestFailuresAndTimeouts(t *testing.T) {
+	requireShell(t)
+	home := t.TempDir()
+	runner, err := New(home, config.Hooks{
+		Timeout: "100ms",
+		HookSet: config.HookSet{
+			PreApply:  []string{"exit 3", "echo unreachable"},
+			PostApply: []string{"sleep 5"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var results []Result
+	runner.Report = func(result Result) { results = append(results, result) }
+	if err := runner.Global(PreApply, []string{"/a"}); err == nil {
+		t.Error("failing hook returned no error")
+	}
+	err = runner.Global(PostApply, []string{"/a"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("slow hook error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("results = %+v, want the failing command and the timeout", results)
+	}
+	if err := runner.Err(); err == nil || err.Error() != `2 hooks failed: pre_apply hook "exit 3": exit status 3; post_apply hook "sleep 5": timed out after 100ms` {
+		t.Errorf("Err = %v", err)
+	}
+
+	runner, err = New(home, config.Hooks{Files: []config.FileHooks{
+		{Target: filepath.Join(home, ".zshrc"), HookSet: config.HookSet{OnChange: []string{"exit 4"}}},
+		{Target: "[", HookSet: config.HookSet{OnChange: []string{"true"}}},
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	results = nil
+	runner.Report = func(result Result) { results = append(results, result) }
+	entry := config.FileEntry{Target: filepath.Join(home, ".zshrc"), Source: filepath.Join(home, ".dots", ".zshrc")}
+	if err := runner.Entry(OnChange, entry, "updated"); err == nil {
+		t.Error("failing on_change hook returned no error")
+	}
+	if err := runner.Entry(OnChange, config.FileEntry{Target: filepath.Join(home, ".vimrc")}, "new"); err == nil {
+		t.Error("invalid hook pattern returned no error")
+	}
+	if len(results) != 2 || results[0].Err == nil || results[1].Err == nil {
+		t.Errorf("results = %+v, want both failures reported", results)
+	}
+	if err := runner.Err(); err == nil || !strings.Contains(err.Error(), `on_change hook "exit 4"`) || !strings.Contains(err.Error(), `hook pattern "["`) {
+		t.Errorf("Err = %v", err)
+	}
+
+	if _, err := New(home, config.Hooks{Timeout: "soon"}); err == nil {
+		t.Error("New accepted an invalid timeout")
+	}
+}
@@ -0,0 +1,249 @@
+package layer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+)
+
+const Personal = "personal"
+
+const (
+	RuleOnly     = "only definition"
+	RuleLater    = "later layer overrides earlier"
+	RulePinned   = "pinned by overrides in dots.yaml"
+	RulePersonal = "personal entries override layers"
+	RuleLocked   = "locked by policy"
+)
+
+type Source struct {
+	Name     string
+	Dir      string
+	Manifest *config.Manifest
+}
+
+type Decision struct {
+	Target     string
+	Winner     config.FileEntry
+	Rule       string
+	Candidates []config.FileEntry
+}
+
+type Stack struct {
+	Sources   []Source
+	Decisions map[string]Decision
+	Merged    *config.Manifest
+}
+
+func Name(entry config.FileEntry) string {
+	if entry.Layer == "" {
+		return Personal
+	}
+	return entry.Layer
+}
+
+func Dir(home string, layer config.Layer) string {
+	if layer.Path != "" {
+		return config.ExpandTarget(layer.Path, home)
+	}
+	return filepath.Join(config.DotsDir(home), config.LayersDirName, layer.Name)
+}
+
+func Validate(layers []config.Layer) error {
+	seen := map[string]bool{Personal: true}
+	for _, layer := range layers {
+		if layer.Name == "" || strings.ContainsAny(layer.Name, `/\`) || layer.Name == "." || layer.Name == ".." {
+			return fmt.Errorf("invalid layer name %q", layer.Name)
+		}
+		if seen[layer.Name] {
+			return fmt.Errorf("duplicate layer name %q", layer.Name)
+		}
+		seen[layer.Name] = true
+		if (layer.Path == "") == (layer.URL == "") {
+			return fmt.Errorf("layer %q needs exactly one of path or url", layer.Name)
+		}
+	}
+	return nil
+}
+
+func Sync(home string, layer config.Layer) error {
+	if layer.URL == "" {
+		return nil
+	}
+	dir := Dir(home, layer)
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		if err := git(dir, "fetch", "--quiet", "origin"); err != nil {
+			return fmt.Errorf("update layer %s: %w", layer.Name, err)
+		}
+		ref := "@{upstream}"
+		if layer.Ref != "" {
+			ref = "origin/" + layer.Ref
+			if git(dir, "rev-parse", "--verify", "--quiet", ref) != nil {
+				ref = layer.Ref
+			}
+		}
+		if err := git(dir, "reset", "--quiet", "--hard", ref); err != nil {
+			return fmt.Errorf("update layer %s: %w", layer.Name, err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return fmt.Errorf("create layers directory: %w", err)
+	}
+	args := []string{"clone", "--quiet"}
+	if layer.Ref != "" {
+		args = append(args, "--branch", layer.Ref)
+	}
+	if err := git("", append(args, layer.URL, dir)...); err != nil {
+		return fmt.Errorf("clone layer %s: %w", layer.Name, err)
+	}
+	return nil
+}
+
+func git(dir string, args ...string) error {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %w (%s)", args[len(args)-1], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func Resolve(home string, manifest *config.Manifest) (*Stack, error) {
+	if err := Validate(manifest.Layers); err != nil {
+		return nil, err
+	}
+	stack := &Stack{Decisions: make(map[string]Decision)}
+	for _, layer := range manifest.Layers {
+		dir := Dir(home, layer)
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) && layer.URL != "" {
+			if err := Sync(home, layer); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, config.ManifestName)); err != nil {
+			return nil, fmt.Errorf("layer %s: no %s in %s", layer.Name, config.ManifestName, dir)
+		}
+		layerManifest, err := config.LoadDir(dir, home)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", layer.Name, err)
+		}
+		for i := range layerManifest.Files {
+			layerManifest.Files[i].Layer = layer.Name
+		}
+		stack.Sources = append(stack.Sources, Source{Name: layer.Name, Dir: dir, Manifest: layerManifest})
+	}
+	stack.Sources = append(stack.Sources, Source{Name: Personal, Dir: config.DotsDir(home), Manifest: manifest})
+
+	pinned := make(map[string]string)
+	for _, override := range manifest.Overrides {
+		pinned[override.Target] = override.Layer
+	}
+	var locks []lock
+	for _, source := range stack.Sources {
+		for _, pattern := range source.Manifest.Policy.Locked {
+			locks = append(locks, lock{pattern: pattern, owner: source.Name})
+		}
+	}
+	var order []string
+	for _, source := range stack.Sources {
+		for _, entry := range source.Manifest.Files {
+			decision, seen := stack.Decisions[entry.Target]
+			if !seen {
+				order = append(order, entry.Target)
+			}
+			decision.Target = entry.Target
+			decision.Candidates = append(decision.Candidates, entry)
+			stack.Decisions[entry.Target] = decision
+		}
+	}
+
+	merged := *manifest
+	merged.Files = make([]config.FileEntry, 0, len(order))
+	merged.Filters = mergeFilters(stack.Sources)
+	merged.Providers = nil
+	for i := len(stack.Sources) - 1; i >= 0; i-- {
+		if i < len(manifest.Layers) && !manifest.Layers[i].Trusted {
+			continue
+		}
+		merged.Providers = append(merged.Providers, stack.Sources[i].Manifest.Providers...)
+	}
+	for _, target := range order {
+		decision := stack.Decisions[target]
+		owner, err := lockOwner(locks, target)
+		if err != nil {
+			return nil, err
+		}
+		decision.Winner, decision.Rule = choose(decision.Candidates, pinned[target], owner)
+		stack.Decisions[target] = decision
+		merged.Files = append(merged.Files, decision.Winner)
+	}
+	stack.Merged = &merged
+	return stack, nil
+}
+
+type lock struct {
+	pattern string
+	owner   string
+}
+
+func lockOwner(locks []lock, target string) (string, error) {
+	for _, lock := range locks {
+		ok, err := dotfile.MatchPattern(lock.pattern, target)
+		if err != nil {
+			return "", fmt.Errorf("policy pattern %q: %w", lock.pattern, err)
+		}
+		if ok {
+			return lock.owner, nil
+		}
+	}
+	return "", nil
+}
+
+func choose(candidates []config.FileEntry, pin, owner string) (config.FileEntry, string) {
+	if owner != "" {
+		for _, candidate := range candidates {
+			if Name(candidate) == owner {
+				return candidate, RuleLocked + " in " + owner
+			}
+		}
+	}
+	if pin != "" {
+		for _, candidate := range candidates {
+			if Name(candidate) == pin {
+				return candidate, RulePinned
+			}
+		}
+	}
+	winner := candidates[len(candidates)-1]
+	switch {
+	case len(candidates) == 1:
+		return winner, RuleOnly
+	case winner.Layer == "":
+		return winner, RulePersonal
+	default:
+		return winner, RuleLater
+	}
+}
+
+func mergeFilters(sources []Source) map[string][]config.FilterRule {
+	filters := make(map[string][]config.FilterRule)
+	for _, source := range sources {
+		for name, rules := range source.Manifest.Filters {
+			filters[name] = rules
+		}
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return filters
+}
@@ -0,0 +1,191 @@
+package layer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+func writeLayer(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create layer: %v", err)
+	}
+	var content string
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("failed to write stored file: %v", err)
+		}
+		content += "  - source: " + name + "\n    target: ~/" + name + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(dir, config.ManifestName), []byte("files:\n"+content), 0o644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+}
+
+func setupStack(t *testing.T) (string, *config.Manifest) {
+	t.Helper()
+	home := t.TempDir()
+	writeLayer(t, filepath.Join(home, "team"), ".bashrc", ".gitconfig", ".vimrc")
+	writeLayer(t, filepath.Join(home, "lang"), ".vimrc")
+	writeLayer(t, config.DotsDir(home), ".gitconfig", ".zshrc")
+	manifest, err := config.Load(home)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	manifest.Layers = []config.Layer{
+		{Name: "team", Path: "~/team"},
+		{Name: "lang", Path: filepath.Join(home, "lang")},
+	}
+	return home, manifest
+}
+
+func TestResolveMergesLayers(t *testing.T) {
+	home, manifest := setupStack(t)
+	stack, err := Resolve(home, manifest)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		layer  string
+		source string
+		rule   string
+	}{
+		{".bashrc", "team", filepath.Join(home, "team", ".bashrc"), RuleOnly},
+		{".vimrc", "lang", filepath.Join(home, "lang", ".vimrc"), RuleLater},
+		{".gitconfig", Personal, filepath.Join(config.DotsDir(home), ".gitconfig"), RulePersonal},
+		{".zshrc", Personal, filepath.Join(config.DotsDir(home), ".zshrc"), RuleOnly},
+	}
+	for _, tt := range tests {
+		decision, ok := stack.Decisions[filepath.Join(home, tt.name)]
+		if !ok {
+			t.Errorf("%s: no decision", tt.name)
+			continue
+		}
+		if Name(decision.Winner) != tt.layer || decision.Winner.Source != tt.source || decision.Rule != tt.rule {
+			t.Errorf("%s: winner %s (%s) by %q, want %s (%s) by %q",
+				tt.name, Name(decision.Winner), decision.Winner.Source, decision.Rule, tt.layer, tt.source, tt.rule)
+		}
+	}
+	if len(stack.Merged.Files) != 4 {
+		t.Errorf("merged %d files, want 4", len(stack.Merged.Files))
+	}
+	if len(stack.Sources) != 3 || stack.Sources[2].Name != Personal {
+		t.Errorf("sources = %+v", stack.Sources)
+	}
+}
+
+func TestResolvePinnedOverride(t *testing.T) {
+	home, manifest := setupStack(t)
+	manifest.Overrides = []config.Override{{Target: filepath.Join(home, ".gitconfig"), Layer: "team"}}
+	stack, err := Resolve(home, manifest)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	decision := stack.Decisions[filepath.Join(home, ".gitconfig")]
+	if Name(decision.Winner) != "team" || decision.Rule != RulePinned {
+		t.Errorf("winner %s by %q, want team by %q", Name(decision.Winner), decision.Rule, RulePinned)
+	}
+	if len(decision.Candidates) != 2 {
+		t.Errorf("candidates = %d, want 2", len(decision.Candidates))
+	}
+}
+
+func TestResolveProvidersFromTrustedLayers(t *testing.T) {
+	home, manifest := setupStack(t)
+	for _, name := range []string{"team", "lang"} {
+		content := "files: []\nproviders:\n  - type: command\n    command: echo " + name + "\n"
+		if err := os.WriteFile(filepath.Join(home, name, config.ManifestName), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write manifest: %v", err)
+		}
+	}
+	manifest.Providers = []config.ProviderConfig{{Type: "env"}}
+	manifest.Layers[1].Trusted = true
+
+	stack, err := Resolve(home, manifest)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	providers := stack.Merged.Providers
+	if len(providers) != 2 || providers[0].Type != "env" || providers[1].Command != "echo lang" {
+		t.Errorf("providers = %+v, want personal then trusted lang only", providers)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers []config.Layer
+	}{
+		{"reserved name", []config.Layer{{Name: Personal, Path: "/x"}}},
+		{"duplicate", []config.Layer{{Name: "a", Path: "/x"}, {Name: "a", Path: "/y"}}},
+		{"no source", []config.Layer{{Name: "a"}}},
+		{"both sources", []config.Layer{{Name: "a", Path: "/x", URL: "file:///x"}}},
+		{"path name", []config.Layer{{Name: "../a", Path: "/x"}}},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.layers); err == nil {
+			t.Errorf("%s: Validate should fail", tt.name)
+		}
+	}
+}
+
+func TestResolveMissingLayer(t *testing.T) {
+	home, manifest := setupStack(t)
+	manifest.Layers = append(manifest.Layers, config.Layer{Name: "gone", Path: filepath.Join(home, "gone")})
+	if _, err := Resolve(home, manifest); err == nil {
+		t.Error("Resolve should fail for a layer without a manifest")
+	}
+}
+
+func TestGitLayer(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	home := t.TempDir()
+	repo := filepath.Join(t.TempDir(), "base")
+	writeLayer(t, repo, ".bashrc")
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v (%s)", args, err, output)
+		}
+	}
+	run("init", "--quiet")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "base")
+
+	manifest := &config.Manifest{Layers: []config.Layer{{Name: "base", URL: "file://" + repo}}}
+	stack, err := Resolve(home, manifest)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	decision, ok := stack.Decisions[filepath.Join(home, ".bashrc")]
+	if !ok || decision.Winner.Layer != "base" {
+		t.Fatalf("decision = %+v", decision)
+	}
+	if want := filepath.Join(config.DotsDir(home), config.LayersDirName, "base", ".bashrc"); decision.Winner.Source != want {
+		t.Errorf("source = %s, want %s", decision.Winner.Source, want)
+	}
+
+	writeLayer(t, repo, ".bashrc", ".vimrc")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "vim")
+	if err := Sync(home, manifest.Layers[0]); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	stack, err = Resolve(home, manifest)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if _, ok := stack.Decisions[filepath.Join(home, ".vimrc")]; !ok {
+		t.Error("Sync did not pick up the new commit")
+	}
+}
@@ -0,0 +1,211 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/layer"
+)
+
+const (
+	Required  = "required"
+	Locked    = "locked"
+	Forbidden = "forbidden"
+)
+
+type Rule struct {
+	Kind    string
+	Pattern string
+	Owner   string
+}
+
+type Violation struct {
+	Target   string
+	Kind     string
+	Detail   string
+	Enforced bool
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Target, v.Detail)
+}
+
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	if len(e.Violations) == 1 {
+		return fmt.Sprintf("policy violation: %s", e.Violations[0])
+	}
+	return fmt.Sprintf("%d policy violations", len(e.Violations))
+}
+
+type Set struct {
+	rules []Rule
+}
+
+func Collect(stack *layer.Stack) *Set {
+	set := &Set{}
+	for _, source := range stack.Sources {
+		policy := source.Manifest.Policy
+		for _, pattern := range policy.Required {
+			set.rules = append(set.rules, Rule{Kind: Required, Pattern: pattern, Owner: source.Name})
+		}
+		for _, pattern := range policy.Locked {
+			set.rules = append(set.rules, Rule{Kind: Locked, Pattern: pattern, Owner: source.Name})
+		}
+		for _, pattern := range policy.Forbidden {
+			set.rules = append(set.rules, Rule{Kind: Forbidden, Pattern: pattern, Owner: source.Name})
+		}
+	}
+	return set
+}
+
+func (s *Set) Rules() []Rule {
+	return s.rules
+}
+
+func (s *Set) Match(kind, target string) (Rule, bool, error) {
+	for _, rule := range s.rules {
+		if rule.Kind != kind {
+			continue
+		}
+		ok, err := dotfile.MatchPattern(rule.Pattern, target)
+		if err != nil {
+			return Rule{}, false, fmt.Errorf("policy pattern %q: %w", rule.Pattern, err)
+		}
+		if ok {
+			return rule, true, nil
+		}
+	}
+	return Rule{}, false, nil
+}
+
+func (s *Set) CheckAdd(target string) error {
+	for _, kind := range []string{Forbidden, Locked} {
+		rule, ok, err := s.Match(kind, target)
+		if err != nil {
+			return err
+		}
+		if ok && (kind == Forbidden || rule.Owner != layer.Personal) {
+			return &ViolationError{Violations: []Violation{{Target: target, Kind: kind, Detail: fmt.Sprintf("%s by policy in %s", kind, rule.Owner)}}}
+		}
+	}
+	return nil
+}
+
+func (s *Set) CheckRemove(stack *layer.Stack, target string) error {
+	for _, kind := range []string{Required, Locked} {
+		rule, ok, err := s.Match(kind, target)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		for _, candidate := range stack.Decisions[target].Candidates {
+			if candidate.Layer != "" {
+				return nil
+			}
+		}
+		return &ViolationError{Violations: []Violation{{Target: target, Kind: kind, Detail: fmt.Sprintf("%s by policy in %s", kind, rule.Owner)}}}
+	}
+	return nil
+}
+
+func (s *Set) Check(stack *layer.Stack) ([]Violation, error) {
+	var violations []Violation
+	for target, decision := range stack.Decisions {
+		if rule, ok, err := s.Match(Forbidden, target); err != nil {
+			return nil, err
+		} else if ok {
+			violations = append(violations, Violation{
+				Target: target,
+				Kind:   Forbidden,
+				Detail: fmt.Sprintf("forbidden by policy in %s but tracked by %s", rule.Owner, strings.Join(Owners(decision.Candidates), ", ")),
+			})
+		}
+		rule, ok, err := s.Match(Locked, target)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		provided := false
+		var others []string
+		for _, candidate := range decision.Candidates {
+			if layer.Name(candidate) == rule.Owner {
+				provided = true
+			} else {
+				others = append(others, layer.Name(candidate))
+			}
+		}
+		switch {
+		case len(others) == 0:
+		case provided:
+			violations = append(violations, Violation{
+				Target:   target,
+				Kind:     Locked,
+				Detail:   fmt.Sprintf("locked by policy in %s, entry in %s is ignored", rule.Owner, strings.Join(others, ", ")),
+				Enforced: true,
+			})
+		default:
+			violations = append(violations, Violation{
+				Target: target,
+				Kind:   Locked,
+				Detail: fmt.Sprintf("locked by policy in %s but tracked by %s", rule.Owner, strings.Join(others, ", ")),
+			})
+		}
+	}
+	for _, rule := range s.rules {
+		if rule.Kind != Required {
+			continue
+		}
+		found := false
+		for target := range stack.Decisions {
+			if ok, err := dotfile.MatchPattern(rule.Pattern, target); err != nil {
+				return nil, fmt.Errorf("policy pattern %q: %w", rule.Pattern, err)
+			} else if ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violations = append(violations, Violation{
+				Target: rule.Pattern,
+				Kind:   Required,
+				Detail: fmt.Sprintf("required by policy in %s but not tracked", rule.Owner),
+			})
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Target != violations[j].Target {
+			return violations[i].Target < violations[j].Target
+		}
+		return violations[i].Kind < violations[j].Kind
+	})
+	return violations, nil
+}
+
+func Blocking(violations []Violation) []Violation {
+	var blocking []Violation
+	for _, violation := range violations {
+		if !violation.Enforced {
+			blocking = append(blocking, violation)
+		}
+	}
+	return blocking
+}
+
+func Owners(entries []config.FileEntry) []string {
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, layer.Name(entry))
+	}
+	return names
+}
@@ -0,0 +1,128 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/layer"
+)
+
+func writeRepo(t *testing.T, dir, policy string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create repo: %v", err)
+	}
+	content := policy + "files:\n"
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("failed to write stored file: %v", err)
+		}
+		content += "  - source: " + name + "\n    target: ~/" + name + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(dir, config.ManifestName), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+}
+
+const teamPolicy = `policy:
+  required: [~/.gitconfig, ~/.ssh/ca.conf]
+  locked: [~/.gitconfig]
+  forbidden: ['~/.ssh/id_*']
+`
+
+func resolve(t *testing.T, personal ...string) (string, *layer.Stack) {
+	t.Helper()
+	home := t.TempDir()
+	writeRepo(t, filepath.Join(home, "team"), teamPolicy, ".gitconfig")
+	writeRepo(t, config.DotsDir(home), "", personal...)
+	manifest, err := config.Load(home)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	manifest.Layers = []config.Layer{{Name: "team", Path: "~/team"}}
+	stack, err := layer.Resolve(home, manifest)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	return home, stack
+}
+
+func TestCheck(t *testing.T) {
+	home, stack := resolve(t, ".gitconfig", ".ssh/id_ed25519")
+	violations, err := Collect(stack).Check(stack)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	want := []struct {
+		target   string
+		kind     string
+		enforced bool
+	}{
+		{filepath.Join(home, ".gitconfig"), Locked, true},
+		{filepath.Join(home, ".ssh/ca.conf"), Required, false},
+		{filepath.Join(home, ".ssh/id_ed25519"), Forbidden, false},
+	}
+	if len(violations) != len(want) {
+		t.Fatalf("violations = %+v", violations)
+	}
+	for i, w := range want {
+		got := violations[i]
+		if got.Target != w.target || got.Kind != w.kind || got.Enforced != w.enforced {
+			t.Errorf("violation %d = %+v, want %s %s enforced=%v", i, got, w.target, w.kind, w.enforced)
+		}
+	}
+	if blocking := Blocking(violations); len(blocking) != 2 {
+		t.Errorf("blocking = %+v, want 2", blocking)
+	}
+
+	decision := stack.Decisions[filepath.Join(home, ".gitconfig")]
+	if decision.Winner.Layer != "team" || decision.Rule != layer.RuleLocked+" in team" {
+		t.Errorf("locked entry resolved to %s by %q", layer.Name(decision.Winner), decision.Rule)
+	}
+}
+
+func TestCheckAdd(t *testing.T) {
+	home, stack := resolve(t)
+	rules := Collect(stack)
+	var violation *ViolationError
+	if err := rules.CheckAdd(filepath.Join(home, ".ssh/id_rsa")); !errors.As(err, &violation) || violation.Violations[0].Kind != Forbidden {
+		t.Errorf("adding a forbidden path: %v", err)
+	}
+	if err := rules.CheckAdd(filepath.Join(home, ".gitconfig")); !errors.As(err, &violation) || violation.Violations[0].Kind != Locked {
+		t.Errorf("adding a locked path: %v", err)
+	}
+	if err := rules.CheckAdd(filepath.Join(home, ".zshrc")); err != nil {
+		t.Errorf("adding an unrestricted path: %v", err)
+	}
+}
+
+func TestCheckRemove(t *testing.T) {
+	home := t.TempDir()
+	writeRepo(t, config.DotsDir(home), "policy:\n  required: [~/.ssh/ca.conf]\n", ".ssh/ca.conf", ".zshrc")
+	manifest, err := config.Load(home)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	stack, err := layer.Resolve(home, manifest)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	rules := Collect(stack)
+	if err := rules.CheckRemove(stack, filepath.Join(home, ".ssh/ca.conf")); err == nil {
+		t.Error("removing the only copy of a required entry should fail")
+	}
+	if err := rules.CheckRemove(stack, filepath.Join(home, ".zshrc")); err != nil {
+		t.Errorf("removing an unrestricted entry: %v", err)
+	}
+
+	_, layered := resolve(t, ".gitconfig")
+	if err := Collect(layered).CheckRemove(layered, layered.Sources[1].Manifest.Files[0].Target); err != nil {
+		t.Errorf("removing a personal copy of a layer-provided entry: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+)
+
+const DefaultEnvPrefix = "DOTS_SECRET_"
+
+type Provider interface {
+	Name() string
+	Lookup(name string) (string, bool, error)
+}
+
+type NotFoundError struct {
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("secret %q not found in any provider", e.Name)
+}
+
+type Env struct {
+	Prefix string
+}
+
+func (p Env) Name() string {
+	return "env"
+}
+
+func (p Env) Lookup(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(EnvName(p.Prefix, name))
+	return value, ok, nil
+}
+
+func EnvName(prefix, name string) string {
+	var out strings.Builder
+	out.WriteString(prefix)
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			out.WriteRune(r)
+		} else {
+			out.WriteByte('_')
+		}
+	}
+	return out.String()
+}
+
+type File struct {
+	Path string
+
+	values map[string]string
+}
+
+func (p *File) Name() string {
+	return "file " + p.Path
+}
+
+func (p *File) Lookup(name string) (string, bool, error) {
+	if p.values == nil {
+		values, err := readKeyValues(p.Path)
+		if err != nil {
+			return "", false, err
+		}
+		p.values = values
+	}
+	value, ok := p.values[name]
+	return value, ok, nil
+}
+
+func readKeyValues(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("read secrets file: %w", err)
+	}
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key=value", path, number)
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
+type Command struct {
+	Command string
+}
+
+func (p Command) Name() string {
+	return "command"
+}
+
+func (p Command) Lookup(name string) (string, bool, error) {
+	cmd := exec.Command("sh", "-c", p.Command, "dots", name)
+	cmd.Env = append(os.Environ(), "DOTS_SECRET_NAME="+name)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false, fmt.Errorf("run %q: %w", p.Command, err)
+	}
+	value := strings.TrimSuffix(string(out), "\n")
+	value = strings.TrimSuffix(value, "\r")
+	return value, true, nil
+}
+
+type scoped struct {
+	provider Provider
+	match    string
+}
+
+type Resolver struct {
+	providers []scoped
+	cache     map[string]string
+}
+
+func New(home string, configs []config.ProviderConfig) (*Resolver, error) {
+	if len(configs) == 0 {
+		configs = []config.ProviderConfig{{Type: "env"}}
+	}
+	resolver := &Resolver{cache: make(map[string]string)}
+	for _, cfg := range configs {
+		var p Provider
+		switch cfg.Type {
+		case "env":
+			prefix := cfg.Prefix
+			if prefix == "" {
+				prefix = DefaultEnvPrefix
+			}
+			p = Env{Prefix: prefix}
+		case "file":
+			if cfg.Path == "" {
+				return nil, fmt.Errorf("file provider needs a path")
+			}
+			path := cfg.Path
+			if strings.HasPrefix(path, "~/") {
+				path = filepath.Join(home, path[2:])
+			}
+			p = &File{Path: path}
+		case "command":
+			if cfg.Command == "" {
+				return nil, fmt.Errorf("command provider needs a command")
+			}
+			p = Command{Command: cfg.Command}
+		default:
+			return nil, fmt.Errorf("unknown secret provider type %q", cfg.Type)
+		}
+		resolver.providers = append(resolver.providers, scoped{provider: p, match: cfg.Match})
+	}
+	return resolver, nil
+}
+
+func (r *Resolver) Lookup(name string) (string, error) {
+	if value, ok := r.cache[name]; ok {
+		return value, nil
+	}
+	for _, candidate := range r.providers {
+		if candidate.match != "" {
+			ok, err := dotfile.MatchPattern(candidate.match, name)
+			if err != nil {
+				return "", fmt.Errorf("provider match %q: %w", candidate.match, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		value, found, err := candidate.provider.Lookup(name)
+		if err != nil {
+			return "", fmt.Errorf("secret %q from %s provider: %w", name, candidate.provider.Name(), err)
+		}
+		if found {
+			r.cache[name] = value
+			return value, nil
+		}
+	}
+	return "", &NotFoundError{Name: name}
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"token", "DOTS_SECRET_TOKEN"},
+		{"github/token", "DOTS_SECRET_GITHUB_TOKEN"},
+		{"npm.registry-token", "DOTS_SECRET_NPM_REGISTRY_TOKEN"},
+	}
+	for _, tt := range tests {
+		if got := EnvName(DefaultEnvPrefix, tt.name); got != tt.want {
+			t.Errorf("EnvName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultResolverUsesEnvironment(t *testing.T) {
+	t.Setenv("DOTS_SECRET_GITHUB_TOKEN", "ghp_example")
+	resolver, err := New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	value, err := resolver.Lookup("github/token")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if value != "ghp_example" {
+		t.Errorf("Lookup = %q, want %q", value, "ghp_example")
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	home := t.TempDir()
+	content := "# local secrets\nnpm/token = npm_abc\n\nempty=\n"
+	if err := os.WriteFile(filepath.Join(home, "secrets.env"), []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write secrets file: %v", err)
+	}
+	resolver, err := New(home, []config.ProviderConfig{{Type: "file", Path: "~/secrets.env"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if value, err := resolver.Lookup("npm/token"); err != nil || value != "npm_abc" {
+		t.Errorf("Lookup(npm/token) = %q, %v", value, err)
+	}
+	if value, err := resolver.Lookup("empty"); err != nil || value != "" {
+		t.Errorf("Lookup(empty) = %q, %v", value, err)
+	}
+	var notFound *NotFoundError
+	if _, err := resolver.Lookup("missing"); !errors.As(err, &notFound) {
+		t.Errorf("Lookup(missing) error = %v, want NotFoundError", err)
+	}
+}
+
+func TestFileProviderMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.env")
+	if err := os.WriteFile(path, []byte("not a pair\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secrets file: %v", err)
+	}
+	resolver, err := New(t.TempDir(), []config.ProviderConfig{{Type: "file", Path: path}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := resolver.Lookup("x"); err == nil {
+		t.Error("Lookup should fail on a malformed secrets file")
+	}
+}
+
+func writeStub(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	calls := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "stub")
+	body := "#!/bin/sh\necho \"$1\" >> " + calls + "\n" +
+		"case \"$1\" in\n  fail) exit 3 ;;\n  *) printf 'value-for-%s\\n' \"$DOTS_SECRET_NAME\" ;;\nesac\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatalf("failed to write stub: %v", err)
+	}
+	return script, calls
+}
+
+func TestCommandProviderCachesValues(t *testing.T) {
+	dir := t.TempDir()
+	script, calls := writeStub(t, dir)
+	resolver, err := New(dir, []config.ProviderConfig{{Type: "command", Command: script + ` "$1"`}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		value, err := resolver.Lookup("github/token")
+		if err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		if value != "value-for-github/token" {
+			t.Errorf("Lookup = %q", value)
+		}
+	}
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatalf("failed to read calls: %v", err)
+	}
+	if got := strings.Count(string(data), "\n"); got != 1 {
+		t.Errorf("command ran %d times, want 1", got)
+	}
+}
+
+func TestCommandProviderFailure(t *testing.T) {
+	dir := t.TempDir()
+	script, _ := writeStub(t, dir)
+	resolver, err := New(dir, []config.ProviderConfig{{Type: "command", Command: script + ` "$1"`}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := resolver.Lookup("fail"); err == nil {
+		t.Error("Lookup should fail when the command exits non-zero")
+	}
+}
+
+func TestProviderMatchOrder(t *testing.T) {
+	dir := t.TempDir()
+	script, _ := writeStub(t, dir)
+	t.Setenv("DOTS_SECRET_GITHUB_TOKEN", "from-env")
+	t.Setenv("DOTS_SECRET_OTHER", "other-from-env")
+	resolver, err := New(dir, []config.ProviderConfig{
+		{Type: "command", Match: "github/*", Command: script + ` "$1"`},
+		{Type: "env"},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if value, _ := resolver.Lookup("github/token"); value != "value-for-github/token" {
+		t.Errorf("github/token = %q, want command value", value)
+	}
+	if value, _ := resolver.Lookup("other"); value != "other-from-env" {
+		t.Errorf("other = %q, want env value", value)
+	}
+}
+
+func TestNewRejectsInvalidProviders(t *testing.T) {
+	tests := []config.ProviderConfig{
+		{Type: "vault"},
+		{Type: "file"},
+		{Type: "command"},
+	}
+	for _, cfg := range tests {
+		if _, err := New(t.TempDir(), []config.ProviderConfig{cfg}); err == nil {
+			t.Errorf("New(%+v) should fail", cfg)
+		}
+	}
+}
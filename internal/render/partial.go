@@ -0,0 +1,191 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/subcode-labs/dots/internal/block"
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/structured"
+)
+
+func partialMissing(entry config.FileEntry) string {
+	if entry.Block != "" {
+		return "block " + entry.Block + " missing"
+	}
+	return "target missing"
+}
+
+func readTarget(target string) (string, []byte, os.FileMode, error) {
+	path, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, 0, fmt.Errorf("resolve %s: %w", target, err)
+		}
+		path = target
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return path, nil, 0o644, nil
+		}
+		return "", nil, 0, fmt.Errorf("read target: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("stat target: %w", err)
+	}
+	return path, content, info.Mode().Perm(), nil
+}
+
+func (p *Pipeline) live(entry config.FileEntry) ([]byte, error) {
+	if !entry.IsPartial() {
+		live, err := os.ReadFile(entry.Target)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("read target: %w", err)
+		}
+		return live, err
+	}
+	_, content, _, err := readTarget(entry.Target)
+	if err != nil {
+		return nil, err
+	}
+	if content == nil {
+		return nil, fs.ErrNotExist
+	}
+	if entry.Merge {
+		return p.managedKeys(entry, content)
+	}
+	live, found, err := block.Extract(content, entry.Block)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", entry.Target, err)
+	}
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+	return live, nil
+}
+
+func (p *Pipeline) Managed(entry config.FileEntry) ([]byte, error) {
+	managed, err := p.live(entry)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return managed, err
+}
+
+func (p *Pipeline) normalize(entry config.FileEntry, want []byte) ([]byte, error) {
+	switch {
+	case entry.Merge:
+		format, _, err := mergeOptions(entry)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := structured.Decode(format, want)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Source, err)
+		}
+		return structured.Encode(format, patch, want)
+	case entry.Block != "" && len(want) > 0 && want[len(want)-1] != '\n':
+		return append(want, '\n'), nil
+	}
+	return want, nil
+}
+
+func mergeOptions(entry config.FileEntry) (structured.Format, structured.Arrays, error) {
+	format, err := structured.FormatFor(entry.Target)
+	if err != nil {
+		return "", "", err
+	}
+	arrays, err := structured.ParseArrays(entry.Arrays)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", entry.Target, err)
+	}
+	return format, arrays, nil
+}
+
+func (p *Pipeline) managedKeys(entry config.FileEntry, content []byte) ([]byte, error) {
+	format, arrays, err := mergeOptions(entry)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := p.Plain(entry)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := structured.Decode(format, stored)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", entry.Source, err)
+	}
+	live, err := structured.Decode(format, content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", entry.Target, err)
+	}
+	return structured.Encode(format, structured.Extract(live, patch, arrays), stored)
+}
+
+func (p *Pipeline) applyPartial(entry config.FileEntry, content []byte) error {
+	path, current, perm, err := readTarget(entry.Target)
+	if err != nil {
+		return err
+	}
+	var updated []byte
+	if entry.Merge {
+		updated, err = merge(entry, current, content)
+	} else {
+		updated, err = block.Replace(current, entry.Block, content)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", entry.Target, err)
+	}
+	if current != nil && bytes.Equal(current, updated) {
+		return nil
+	}
+	return dotfile.WriteCopy(path, updated, perm)
+}
+
+func merge(entry config.FileEntry, current, content []byte) ([]byte, error) {
+	format, arrays, err := mergeOptions(entry)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := structured.Decode(format, content)
+	if err != nil {
+		return nil, err
+	}
+	live, err := structured.Decode(format, current)
+	if err != nil {
+		return nil, err
+	}
+	merged := structured.Merge(live, patch, arrays)
+	if structured.Equal(merged, live) && current != nil {
+		return current, nil
+	}
+	if len(bytes.TrimSpace(current)) == 0 {
+		return structured.Encode(format, merged, content)
+	}
+	return structured.Patch(format, current, merged)
+}
+
+func (p *Pipeline) Detach(entry config.FileEntry) (bool, error) {
+	if entry.Block == "" {
+		return false, nil
+	}
+	path, current, perm, err := readTarget(entry.Target)
+	if err != nil || current == nil {
+		return false, err
+	}
+	updated, removed, err := block.Remove(current, entry.Block)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", entry.Target, err)
+	}
+	if !removed {
+		return false, nil
+	}
+	return true, dotfile.WriteCopy(path, updated, perm)
+}
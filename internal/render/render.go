@@ -0,0 +1,373 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/crypt"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/filter"
+	"github.com/subcode-labs/dots/internal/provider"
+)
+
+const copyPerm = 0o600
+
+type Pipeline struct {
+	Home         string
+	Manifest     *config.Manifest
+	IdentityPath string
+	ValuesPath   string
+
+	identity *crypt.Identity
+	values   filter.Values
+	secrets  *provider.Resolver
+}
+
+func New(home string, manifest *config.Manifest) *Pipeline {
+	return &Pipeline{Home: home, Manifest: manifest}
+}
+
+func (p *Pipeline) Identity() (*crypt.Identity, error) {
+	if p.identity != nil {
+		return p.identity, nil
+	}
+	path := p.IdentityPath
+	if path == "" {
+		var err error
+		if path, err = crypt.DefaultIdentityPath(); err != nil {
+			return nil, err
+		}
+	}
+	identity, err := crypt.LoadIdentity(path)
+	if err != nil {
+		return nil, err
+	}
+	p.identity = identity
+	return identity, nil
+}
+
+func (p *Pipeline) Recipients() []string {
+	keys := make([]string, 0, len(p.Manifest.Recipients))
+	for _, recipient := range p.Manifest.Recipients {
+		keys = append(keys, recipient.Key)
+	}
+	return keys
+}
+
+func (p *Pipeline) Values() (filter.Values, error) {
+	if p.values != nil {
+		return p.values, nil
+	}
+	path, err := p.valuesPath()
+	if err != nil {
+		return nil, err
+	}
+	values, err := filter.LoadValues(path)
+	if err != nil {
+		return nil, err
+	}
+	p.values = values
+	return values, nil
+}
+
+func (p *Pipeline) SetValues(values filter.Values) error {
+	current, err := p.Values()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for name, value := range values {
+		if current[name] != value {
+			current[name] = value
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	path, err := p.valuesPath()
+	if err != nil {
+		return err
+	}
+	return filter.SaveValues(path, current)
+}
+
+func (p *Pipeline) Secret(name string) (string, error) {
+	if p.secrets == nil {
+		resolver, err := provider.New(p.Home, p.Manifest.Providers)
+		if err != nil {
+			return "", err
+		}
+		p.secrets = resolver
+	}
+	return p.secrets.Lookup(name)
+}
+
+func (p *Pipeline) valuesPath() (string, error) {
+	if p.ValuesPath != "" {
+		return p.ValuesPath, nil
+	}
+	return filter.DefaultValuesPath()
+}
+
+func (p *Pipeline) filterRules(entry config.FileEntry) ([]config.FilterRule, error) {
+	if entry.Filter == "" {
+		return nil, nil
+	}
+	rules, ok := p.Manifest.Filters[entry.Filter]
+	if !ok {
+		return nil, fmt.Errorf("filter %q used by %s is not defined", entry.Filter, entry.Target)
+	}
+	return rules, nil
+}
+
+func (p *Pipeline) Plain(entry config.FileEntry) ([]byte, error) {
+	stored, err := os.ReadFile(entry.Source)
+	if err != nil {
+		return nil, fmt.Errorf("read stored file: %w", err)
+	}
+	return p.Decode(entry, stored)
+}
+
+func (p *Pipeline) Decode(entry config.FileEntry, stored []byte) ([]byte, error) {
+	if !entry.Encrypted {
+		return stored, nil
+	}
+	identity, err := p.Identity()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := crypt.Decrypt(stored, identity)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", entry.Source, err)
+	}
+	return plaintext, nil
+}
+
+func (p *Pipeline) Render(entry config.FileEntry) ([]byte, error) {
+	rendered, err := p.Plain(entry)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter.Placeholders(rendered)) > 0 {
+		values, err := p.Values()
+		if err != nil {
+			return nil, err
+		}
+		if rendered, err = filter.Smudge(rendered, values); err != nil {
+			return nil, fmt.Errorf("render %s: %w", entry.Target, err)
+		}
+	}
+	if rendered, err = filter.ResolveSecrets(rendered, p.Secret); err != nil {
+		return nil, fmt.Errorf("render %s: %w", entry.Target, err)
+	}
+	return rendered, nil
+}
+
+func (p *Pipeline) Clean(entry config.FileEntry, live []byte) ([]byte, filter.Values, error) {
+	template, err := p.Plain(entry)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, err
+		}
+		template = nil
+	}
+	return p.clean(entry, live, template)
+}
+
+func (p *Pipeline) clean(entry config.FileEntry, live, template []byte) ([]byte, filter.Values, error) {
+	rules, err := p.filterRules(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	cleaned, captured := live, filter.Values(nil)
+	if len(rules) > 0 {
+		if cleaned, captured, err = filter.Clean(live, rules); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cleaned, err = filter.MaskSecrets(cleaned, template, p.Secret); err != nil {
+		return nil, nil, fmt.Errorf("mask secrets in %s: %w", entry.Target, err)
+	}
+	return cleaned, captured, nil
+}
+
+func (p *Pipeline) Capture(entry config.FileEntry, live []byte) ([]byte, error) {
+	cleaned, captured, err := p.Clean(entry, live)
+	if err != nil {
+		return nil, err
+	}
+	if len(captured) > 0 {
+		if err := p.SetValues(captured); err != nil {
+			return nil, err
+		}
+	}
+	if !entry.Encrypted {
+		return cleaned, nil
+	}
+	return crypt.Encrypt(cleaned, p.Recipients())
+}
+
+func (p *Pipeline) Compare(entry config.FileEntry) ([]byte, []byte, error) {
+	want, err := p.Plain(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	live, err := p.live(entry)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, want, nil
+		}
+		return nil, nil, err
+	}
+	if want, err = p.normalize(entry, want); err != nil {
+		return nil, nil, err
+	}
+	have, _, err := p.clean(entry, live, want)
+	if err != nil {
+		return nil, nil, err
+	}
+	return have, want, nil
+}
+
+func (p *Pipeline) Status(entry config.FileEntry) (dotfile.StatusEntry, error) {
+	if !entry.IsCopy() {
+		return dotfile.ContentStatus(entry)
+	}
+	if _, err := os.Stat(entry.Source); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return dotfile.StatusEntry{Entry: entry, Status: dotfile.StatusMissing, Info: "stored file missing"}, nil
+		}
+		return dotfile.StatusEntry{}, fmt.Errorf("stat stored file: %w", err)
+	}
+	if entry.IsPartial() {
+		if _, err := p.live(entry); errors.Is(err, fs.ErrNotExist) {
+			return dotfile.StatusEntry{Entry: entry, Status: dotfile.StatusMissing, Info: partialMissing(entry)}, nil
+		} else if err != nil {
+			return dotfile.StatusEntry{}, err
+		}
+	} else {
+		status, err := dotfile.CopyStatus(entry, nil)
+		if err != nil || status.Status == dotfile.StatusMissing || status.Status == dotfile.StatusConflicts {
+			return status, err
+		}
+	}
+	if entry.Encrypted {
+		if _, err := p.Plain(entry); err != nil {
+			return dotfile.StatusEntry{Entry: entry, Status: dotfile.StatusLocked, Info: err.Error()}, nil
+		}
+	}
+	have, want, err := p.Compare(entry)
+	if err != nil {
+		return dotfile.StatusEntry{}, err
+	}
+	if string(have) == string(want) {
+		return dotfile.StatusEntry{Entry: entry, Status: dotfile.StatusLinked}, nil
+	}
+	return dotfile.StatusEntry{Entry: entry, Status: dotfile.StatusDiverged}, nil
+}
+
+func (p *Pipeline) Apply(entry config.FileEntry) error {
+	if !entry.IsCopy() {
+		return dotfile.EnsureSymlink(entry.Target, entry.Source)
+	}
+	content, err := p.Render(entry)
+	if err != nil {
+		return err
+	}
+	if entry.IsPartial() {
+		return p.applyPartial(entry, content)
+	}
+	return dotfile.WriteCopy(entry.Target, content, copyPerm)
+}
+
+func (p *Pipeline) Adopt(entry config.FileEntry) error {
+	live, err := p.live(entry)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && entry.IsPartial() {
+			return fmt.Errorf("%s in %s", partialMissing(entry), entry.Target)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("read target: %w", err)
+		}
+		return err
+	}
+	stored, err := p.Capture(entry, live)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(entry.Source)
+	perm := os.FileMode(0o644)
+	if err == nil {
+		perm = info.Mode().Perm()
+	}
+	return dotfile.WriteCopy(entry.Source, stored, perm)
+}
+
+func (p *Pipeline) RekeyAll(commit func() error) ([]config.FileEntry, error) {
+	type rekeyed struct {
+		entry    config.FileEntry
+		previous []byte
+		perm     os.FileMode
+		tmp      string
+	}
+	var files []*rekeyed
+	defer func() {
+		for _, file := range files {
+			if file.tmp != "" {
+				os.Remove(file.tmp)
+			}
+		}
+	}()
+	for _, entry := range p.Manifest.Files {
+		if !entry.Encrypted {
+			continue
+		}
+		info, err := os.Stat(entry.Source)
+		if err != nil {
+			return nil, fmt.Errorf("stat stored file: %w", err)
+		}
+		previous, err := os.ReadFile(entry.Source)
+		if err != nil {
+			return nil, fmt.Errorf("read stored file: %w", err)
+		}
+		plaintext, err := p.Decode(entry, previous)
+		if err != nil {
+			return nil, err
+		}
+		stored, err := crypt.Encrypt(plaintext, p.Recipients())
+		if err != nil {
+			return nil, err
+		}
+		file := &rekeyed{entry: entry, previous: previous, perm: info.Mode().Perm()}
+		files = append(files, file)
+		if file.tmp, err = dotfile.WriteTemp(entry.Source, stored, file.perm); err != nil {
+			return nil, err
+		}
+	}
+	rollback := func(err error, replaced []*rekeyed) error {
+		for _, file := range replaced {
+			if restoreErr := dotfile.WriteCopy(file.entry.Source, file.previous, file.perm); restoreErr != nil {
+				return fmt.Errorf("%w (restoring %s failed: %v)", err, file.entry.Source, restoreErr)
+			}
+		}
+		return err
+	}
+	for i, file := range files {
+		if err := os.Rename(file.tmp, file.entry.Source); err != nil {
+			return nil, rollback(fmt.Errorf("replace stored file: %w", err), files[:i])
+		}
+		file.tmp = ""
+	}
+	if err := commit(); err != nil {
+		return nil, rollback(err, files)
+	}
+	entries := make([]config.FileEntry, len(files))
+	for i, file := range files {
+		entries[i] = file.entry
+	}
+	return entries, nil
+}
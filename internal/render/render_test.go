@@ -0,0 +1,484 @@
+package render
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/crypt"
+	"github.com/subcode-labs/dots/internal/dotfile"
+)
+
+func setupEncrypted(t *testing.T, plaintext string) (*Pipeline, config.FileEntry) {
+	t.Helper()
+	home := t.TempDir()
+	if _, err := dotfile.Init(home); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	identity, err := crypt.GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity failed: %v", err)
+	}
+	identityPath := filepath.Join(home, "identity")
+	if err := crypt.SaveIdentity(identityPath, identity); err != nil {
+		t.Fatalf("SaveIdentity failed: %v", err)
+	}
+	manifest := &config.Manifest{Recipients: []config.Recipient{{Name: "me", Key: identity.Recipient()}}}
+	pipeline := New(home, manifest)
+	pipeline.IdentityPath = identityPath
+
+	entry := config.FileEntry{
+		Source:    filepath.Join(config.DotsDir(home), ".netrc"),
+		Target:    filepath.Join(home, ".netrc"),
+		Encrypted: true,
+	}
+	stored, err := pipeline.Capture(entry, []byte(plaintext))
+	if err != nil {
+		t.Fatalf("Capture failed: %v", err)
+	}
+	if err := os.WriteFile(entry.Source, stored, 0o644); err != nil {
+		t.Fatalf("failed to write stored file: %v", err)
+	}
+	manifest.Files = []config.FileEntry{entry}
+	return pipeline, entry
+}
+
+func TestApplyEncryptedWritesPrivateCopy(t *testing.T) {
+	pipeline, entry := setupEncrypted(t, "password hunter2\n")
+
+	if err := pipeline.Apply(entry); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	info, err := os.Lstat(entry.Target)
+	if err != nil {
+		t.Fatalf("target not written: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		t.Error("encrypted entries should be materialised as regular files")
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("target permissions = %v, want 0600", info.Mode().Perm())
+	}
+	got, _ := os.ReadFile(entry.Target)
+	if string(got) != "password hunter2\n" {
+		t.Errorf("target content = %q", got)
+	}
+}
+
+func TestStatusEncrypted(t *testing.T) {
+	pipeline, entry := setupEncrypted(t, "password hunter2\n")
+
+	status, err := pipeline.Status(entry)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Status != dotfile.StatusMissing {
+		t.Errorf("status before apply = %v, want %v", status.Status, dotfile.StatusMissing)
+	}
+
+	if err := pipeline.Apply(entry); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if status, _ = pipeline.Status(entry); status.Status != dotfile.StatusLinked {
+		t.Errorf("status after apply = %v, want %v", status.Status, dotfile.StatusLinked)
+	}
+
+	if err := os.WriteFile(entry.Target, []byte("password changed\n"), 0o600); err != nil {
+		t.Fatalf("failed to edit target: %v", err)
+	}
+	if status, _ = pipeline.Status(entry); status.Status != dotfile.StatusDiverged {
+		t.Errorf("status after edit = %v, want %v", status.Status, dotfile.StatusDiverged)
+	}
+
+	locked := New(pipeline.Home, pipeline.Manifest)
+	locked.IdentityPath = filepath.Join(t.TempDir(), "missing")
+	if status, err = locked.Status(entry); err != nil || status.Status != dotfile.StatusLocked {
+		t.Errorf("status without identity = %+v, %v, want %v", status, err, dotfile.StatusLocked)
+	}
+}
+
+func TestAdoptReencrypts(t *testing.T) {
+	pipeline, entry := setupEncrypted(t, "old\n")
+	if err := os.WriteFile(entry.Target, []byte("new\n"), 0o600); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+
+	if err := pipeline.Adopt(entry); err != nil {
+		t.Fatalf("Adopt failed: %v", err)
+	}
+	stored, _ := os.ReadFile(entry.Source)
+	if !crypt.IsEncrypted(stored) {
+		t.Fatal("adopted content should be stored encrypted")
+	}
+	got, err := pipeline.Render(entry)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if string(got) != "new\n" {
+		t.Errorf("rendered content = %q, want %q", got, "new\n")
+	}
+}
+
+func TestRekeyAddsRecipient(t *testing.T) {
+	pipeline, entry := setupEncrypted(t, "shared secret\n")
+	teammate, err := crypt.GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity failed: %v", err)
+	}
+	pipeline.Manifest.Recipients = append(pipeline.Manifest.Recipients, config.Recipient{Name: "teammate", Key: teammate.Recipient()})
+
+	before, _ := os.ReadFile(entry.Source)
+	failed := errors.New("save failed")
+	if _, err := pipeline.RekeyAll(func() error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("RekeyAll with a failing commit = %v", err)
+	}
+	if stored, _ := os.ReadFile(entry.Source); string(stored) != string(before) {
+		t.Error("stored file not restored after a failed commit")
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(entry.Source), ".*.dots-*")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+
+	entries, err := pipeline.RekeyAll(func() error { return nil })
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("RekeyAll = %v, %v", entries, err)
+	}
+	stored, _ := os.ReadFile(entry.Source)
+	got, err := crypt.Decrypt(stored, teammate)
+	if err != nil {
+		t.Fatalf("teammate cannot decrypt after rekey: %v", err)
+	}
+	if string(got) != "shared secret\n" {
+		t.Errorf("decrypted content = %q", got)
+	}
+}
+
+func TestPlainEntriesAreLinked(t *testing.T) {
+	home := t.TempDir()
+	if _, err := dotfile.Init(home); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	entry := config.FileEntry{Source: filepath.Join(config.DotsDir(home), ".bashrc"), Target: filepath.Join(home, ".bashrc")}
+	if err := os.WriteFile(entry.Source, []byte("x"), 0o644); err != nil {
+		t.Fatalf("failed to write stored file: %v", err)
+	}
+	pipeline := New(home, &config.Manifest{Files: []config.FileEntry{entry}})
+
+	if err := pipeline.Apply(entry); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	status, err := pipeline.Status(entry)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Status != dotfile.StatusLinked {
+		t.Errorf("status = %v, want %v", status.Status, dotfile.StatusLinked)
+	}
+}
+
+func setupFiltered(t *testing.T, live string) (*Pipeline, config.FileEntry) {
+	t.Helper()
+	home := t.TempDir()
+	if _, err := dotfile.Init(home); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	manifest := &config.Manifest{Filters: map[string][]config.FilterRule{
+		"gitconfig": {{Pattern: `signingkey = (\S+)`, Placeholder: "signing_key"}},
+	}}
+	pipeline := New(home, manifest)
+	pipeline.ValuesPath = filepath.Join(home, "values.yaml")
+	entry := config.FileEntry{
+		Source: filepath.Join(config.DotsDir(home), ".gitconfig"),
+		Target: filepath.Join(home, ".gitconfig"),
+		Filter: "gitconfig",
+	}
+	if err := os.WriteFile(entry.Target, []byte(live), 0o644); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+	stored, err := pipeline.Capture(entry, []byte(live))
+	if err != nil {
+		t.Fatalf("Capture failed: %v", err)
+	}
+	if err := os.WriteFile(entry.Source, stored, 0o644); err != nil {
+		t.Fatalf("failed to write stored file: %v", err)
+	}
+	manifest.Files = []config.FileEntry{entry}
+	return pipeline, entry
+}
+
+func TestFilteredEntryStoresPlaceholder(t *testing.T) {
+	pipeline, entry := setupFiltered(t, "signingkey = ABC123\n")
+
+	stored, _ := os.ReadFile(entry.Source)
+	if string(stored) != "signingkey = {{ value \"signing_key\" }}\n" {
+		t.Errorf("stored content = %q", stored)
+	}
+	values, err := pipeline.Values()
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if values["signing_key"] != "ABC123" {
+		t.Errorf("captured value = %q, want %q", values["signing_key"], "ABC123")
+	}
+
+	status, err := pipeline.Status(entry)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Status != dotfile.StatusLinked {
+		t.Errorf("status = %v, want %v", status.Status, dotfile.StatusLinked)
+	}
+}
+
+func TestFilteredEntryApplyFillsValues(t *testing.T) {
+	pipeline, entry := setupFiltered(t, "signingkey = ABC123\n")
+	if err := os.Remove(entry.Target); err != nil {
+		t.Fatalf("failed to remove target: %v", err)
+	}
+
+	if err := pipeline.Apply(entry); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	got, _ := os.ReadFile(entry.Target)
+	if string(got) != "signingkey = ABC123\n" {
+		t.Errorf("target content = %q", got)
+	}
+}
+
+func TestFilteredEntryStatusIgnoresValueOnlyChanges(t *testing.T) {
+	pipeline, entry := setupFiltered(t, "signingkey = ABC123\n")
+
+	if err := os.WriteFile(entry.Target, []byte("signingkey = OTHERKEY\n"), 0o644); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+	if status, _ := pipeline.Status(entry); status.Status != dotfile.StatusLinked {
+		t.Errorf("value-only change status = %v, want %v", status.Status, dotfile.StatusLinked)
+	}
+
+	if err := os.WriteFile(entry.Target, []byte("signingkey = ABC123\n[core]\n"), 0o644); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+	if status, _ := pipeline.Status(entry); status.Status != dotfile.StatusDiverged {
+		t.Errorf("content change status = %v, want %v", status.Status, dotfile.StatusDiverged)
+	}
+}
+
+func TestUndefinedFilter(t *testing.T) {
+	pipeline, entry := setupFiltered(t, "signingkey = ABC123\n")
+	entry.Filter = "missing"
+	if _, err := pipeline.Capture(entry, []byte("x")); err == nil {
+		t.Error("Capture should fail for an undefined filter")
+	}
+}
+
+func TestTemplateEntryResolvesSecrets(t *testing.T) {
+	home := t.TempDir()
+	if _, err := dotfile.Init(home); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Setenv("DOTS_SECRET_NPM_TOKEN", "npm_resolved")
+	entry := config.FileEntry{
+		Source:   filepath.Join(config.DotsDir(home), ".npmrc"),
+		Target:   filepath.Join(home, ".npmrc"),
+		Template: true,
+	}
+	template := "registry=x\n_authToken={{ secret \"npm/token\" }}\n"
+	if err := os.WriteFile(entry.Source, []byte(template), 0o644); err != nil {
+		t.Fatalf("failed to write stored file: %v", err)
+	}
+	pipeline := New(home, &config.Manifest{Files: []config.FileEntry{entry}})
+
+	if err := pipeline.Apply(entry); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	got, _ := os.ReadFile(entry.Target)
+	if string(got) != "registry=x\n_authToken=npm_resolved\n" {
+		t.Errorf("target content = %q", got)
+	}
+	if status, _ := pipeline.Status(entry); status.Status != dotfile.StatusLinked {
+		t.Errorf("status = %v, want %v", status.Status, dotfile.StatusLinked)
+	}
+
+	if err := os.WriteFile(entry.Target, []byte("registry=y\n_authToken=npm_resolved\n"), 0o600); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+	have, _, err := pipeline.Compare(entry)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if strings.Contains(string(have), "npm_resolved") {
+		t.Errorf("Compare leaked a resolved secret: %q", have)
+	}
+	if err := pipeline.Adopt(entry); err != nil {
+		t.Fatalf("Adopt failed: %v", err)
+	}
+	stored, _ := os.ReadFile(entry.Source)
+	if string(stored) != "registry=y\n_authToken={{ secret \"npm/token\" }}\n" {
+		t.Errorf("stored content = %q", stored)
+	}
+}
+
+func TestBlockEntryManagesOnlyItsRegion(t *testing.T) {
+	home := t.TempDir()
+	if _, err := dotfile.Init(home); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	entry := config.FileEntry{
+		Source: filepath.Join(config.DotsDir(home), "ssh-hosts"),
+		Target: filepath.Join(home, ".ssh", "config"),
+		Block:  "hosts",
+	}
+	if err := os.WriteFile(entry.Source, []byte("Host box\n  User me\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.Target), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entry.Target, []byte("Host vpn\n  ProxyCommand vpn\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pipeline := New(home, &config.Manifest{})
+
+	if status, err := pipeline.Status(entry); err != nil || status.Status != dotfile.StatusMissing {
+		t.Errorf("Status before apply = %+v, %v", status, err)
+	}
+	if err := pipeline.Apply(entry); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if status, err := pipeline.Status(entry); err != nil || status.Status != dotfile.StatusLinked {
+		t.Errorf("Status after apply = %+v, %v", status, err)
+	}
+	info, err := os.Stat(entry.Target)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("target mode = %v, %v", info, err)
+	}
+
+	content, _ := os.ReadFile(entry.Target)
+	edited := strings.Replace(string(content), "ProxyCommand vpn", "ProxyCommand vpn2", 1)
+	if err := os.WriteFile(entry.Target, []byte(edited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := pipeline.Status(entry); err != nil || status.Status != dotfile.StatusLinked {
+		t.Errorf("Status after an edit outside the block = %+v, %v", status, err)
+	}
+	edited = strings.Replace(edited, "User me", "User you", 1)
+	if err := os.WriteFile(entry.Target, []byte(edited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := pipeline.Status(entry); err != nil || status.Status != dotfile.StatusDiverged {
+		t.Errorf("Status after an edit inside the block = %+v, %v", status, err)
+	}
+	if err := pipeline.Adopt(entry); err != nil {
+		t.Fatalf("Adopt failed: %v", err)
+	}
+	if stored, _ := os.ReadFile(entry.Source); string(stored) != "Host box\n  User you\n" {
+		t.Errorf("adopted = %q", stored)
+	}
+
+	if removed, err := pipeline.Detach(entry); err != nil || !removed {
+		t.Fatalf("Detach = %v, %v", removed, err)
+	}
+	if content, _ := os.ReadFile(entry.Target); string(content) != "Host vpn\n  ProxyCommand vpn2\n" {
+		t.Errorf("target after detach = %q", content)
+	}
+}
+
+func TestMergeEntryManagesOnlyStoredKeys(t *testing.T) {
+	home := t.TempDir()
+	if _, err := dotfile.Init(home); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	entry := config.FileEntry{
+		Source: filepath.Join(config.DotsDir(home), "settings.json"),
+		Target: filepath.Join(home, ".config", "Code", "User", "settings.json"),
+		Merge:  true,
+		Arrays: "union",
+	}
+	if err := os.WriteFile(entry.Source, []byte(`{"editor.tabSize": 2, "files.exclude": ["dist"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.Target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entry.Target, []byte("{\n\t\"window.zoomLevel\": 1,\n\t\"files.exclude\": [\"node_modules\"]\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pipeline := New(home, &config.Manifest{})
+
+	if status, err := pipeline.Status(entry); err != nil || status.Status != dotfile.StatusDiverged {
+		t.Errorf("Status before apply = %+v, %v", status, err)
+	}
+	if err := pipeline.Apply(entry); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	content, _ := os.ReadFile(entry.Target)
+	want := "{\n\t\"window.zoomLevel\": 1,\n\t\"files.exclude\": [\n\t\t\"node_modules\",\n\t\t\"dist\"\n\t],\n\t\"editor.tabSize\": 2\n}\n"
+	if string(content) != want {
+		t.Errorf("merged target =\n%s\nwant\n%s", content, want)
+	}
+	if status, err := pipeline.Status(entry); err != nil || status.Status != dotfile.StatusLinked {
+		t.Errorf("Status after apply = %+v, %v", status, err)
+	}
+
+	edited := strings.Replace(string(content), `"window.zoomLevel": 1`, `"window.zoomLevel": 3`, 1)
+	if err := os.WriteFile(entry.Target, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := pipeline.Status(entry); err != nil || status.Status != dotfile.StatusLinked {
+		t.Errorf("Status after an unmanaged edit = %+v, %v", status, err)
+	}
+	edited = strings.Replace(edited, `"editor.tabSize": 2`, `"editor.tabSize": 4`, 1)
+	if err := os.WriteFile(entry.Target, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := pipeline.Status(entry); err != nil || status.Status != dotfile.StatusDiverged {
+		t.Errorf("Status after a managed edit = %+v, %v", status, err)
+	}
+	if err := pipeline.Adopt(entry); err != nil {
+		t.Fatalf("Adopt failed: %v", err)
+	}
+	stored, _ := os.ReadFile(entry.Source)
+	if strings.Contains(string(stored), "zoomLevel") || !strings.Contains(string(stored), `"editor.tabSize": 4`) {
+		t.Errorf("adopted = %s", stored)
+	}
+}
+
+func TestMergeEntryKeepsTargetComments(t *testing.T) {
+	home := t.TempDir()
+	if _, err := dotfile.Init(home); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	pipeline := New(home, &config.Manifest{})
+	for _, name := range []string{"settings.json", "config.toml"} {
+		entry := config.FileEntry{
+			Source: filepath.Join(config.DotsDir(home), name),
+			Target: filepath.Join(home, name),
+			Merge:  true,
+		}
+		stored, live := `{"theme": "dark"}`, "{\n  // set by the app\n  \"zoom\": 1\n}\n"
+		if name == "config.toml" {
+			stored, live = "theme = \"dark\"\n", "# set by the app\nzoom = 1\n"
+		}
+		if err := os.WriteFile(entry.Source, []byte(stored), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(entry.Target, []byte(live), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := pipeline.Apply(entry); err != nil {
+			t.Fatalf("Apply(%s) failed: %v", name, err)
+		}
+		content, _ := os.ReadFile(entry.Target)
+		want := "{\n  // set by the app\n  \"zoom\": 1,\n  \"theme\": \"dark\"\n}\n"
+		if name == "config.toml" {
+			want = "# set by the app\nzoom = 1\ntheme = \"dark\"\n"
+		}
+		if string(content) != want {
+			t.Errorf("merged target =\n%s\nwant\n%s", content, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package script
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/state"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusChanged Status = "changed"
+	StatusDone    Status = "up to date"
+	StatusAlways  Status = "always"
+)
+
+type Plan struct {
+	Script config.Script
+	Hash   string
+	Status Status
+	Last   state.ScriptRun
+}
+
+func (p Plan) Due() bool {
+	return p.Status != StatusDone
+}
+
+func Hash(script config.Script) (string, error) {
+	digest := sha256.New()
+	if script.Path != "" {
+		content, err := os.ReadFile(script.Path)
+		if err != nil {
+			return "", fmt.Errorf("read script %s: %w", script.Name, err)
+		}
+		fmt.Fprintf(digest, "path\x00%d\x00", len(content))
+		digest.Write(content)
+	} else {
+		fmt.Fprintf(digest, "command\x00%d\x00%s", len(script.Command), script.Command)
+	}
+	for _, path := range script.Watch {
+		content, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			fmt.Fprintf(digest, "\x00watch\x00%s\x00missing", path)
+		case err != nil:
+			return "", fmt.Errorf("read watched file for script %s: %w", script.Name, err)
+		default:
+			fmt.Fprintf(digest, "\x00watch\x00%s\x00%d\x00", path, len(content))
+			digest.Write(content)
+		}
+	}
+	return fmt.Sprintf("%x", digest.Sum(nil)), nil
+}
+
+func PlanAll(scripts []config.Script, runs map[string]state.ScriptRun) ([]Plan, error) {
+	if err := config.ValidateScripts(scripts); err != nil {
+		return nil, err
+	}
+	plans := make([]Plan, 0, len(scripts))
+	for _, script := range scripts {
+		hash, err := Hash(script)
+		if err != nil {
+			return nil, err
+		}
+		last, ran := runs[script.Name]
+		plan := Plan{Script: script, Hash: hash, Last: last}
+		switch {
+		case script.Mode() == config.RunAlways:
+			plan.Status = StatusAlways
+		case !ran:
+			plan.Status = StatusPending
+		case script.Mode() == config.RunOnce && last.Ran(hash):
+			plan.Status = StatusDone
+		case script.Mode() == config.RunOnChange && last.Hash == hash:
+			plan.Status = StatusDone
+		default:
+			plan.Status = StatusChanged
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+func Run(home string, script config.Script, stdout, stderr io.Writer) error {
+	ctx := context.Background()
+	var timeout time.Duration
+	if script.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(script.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("script %s: invalid timeout %q", script.Name, script.Timeout)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := command(ctx, script)
+	cmd.Dir = home
+	cmd.Env = append(os.Environ(), "DOTS_HOME="+home, "DOTS_DIR="+config.DotsDir(home), "DOTS_SCRIPT="+script.Name)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("script %s timed out after %s", script.Name, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("script %s: %w", script.Name, err)
+	}
+	return nil
+}
+
+func command(ctx context.Context, script config.Script) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		if script.Path != "" {
+			return exec.CommandContext(ctx, "cmd", "/C", script.Path)
+		}
+		return exec.CommandContext(ctx, "cmd", "/C", script.Command)
+	}
+	if script.Path == "" {
+		return exec.CommandContext(ctx, "sh", "-c", script.Command)
+	}
+	if info, err := os.Stat(script.Path); err == nil && info.Mode().Perm()&0o111 != 0 {
+		return exec.CommandContext(ctx, script.Path)
+	}
+	return exec.CommandContext(ctx, "sh", script.Path)
+}
+
+func Record(runs map[string]state.ScriptRun, plan Plan) {
+	run := runs[plan.Script.Name]
+	run.Name = plan.Script.Name
+	run.Hash = plan.Hash
+	run.RanAt = time.Now().UTC()
+	switch {
+	case plan.Script.Mode() != config.RunOnce:
+		run.Hashes = nil
+	case !slices.Contains(run.Hashes, plan.Hash):
+		run.Hashes = append(run.Hashes, plan.Hash)
+	}
+	runs[plan.Script.Name] = run
+}
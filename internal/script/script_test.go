@@ -0,0 +1,105 @@
+package script
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/state"
+)
+
+func TestPlanAll(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "install.sh")
+	watched := filepath.Join(dir, "Brewfile")
+	if err := os.WriteFile(path, []byte("echo install\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(watched, []byte("brew \"git\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scripts := []config.Script{
+		{Name: "install", Path: path, Run: config.RunOnce},
+		{Name: "brew", Command: "brew bundle", Watch: []string{watched}},
+		{Name: "refresh", Command: "true", Run: config.RunAlways},
+	}
+	runs := map[string]state.ScriptRun{}
+	plans, err := PlanAll(scripts, runs)
+	if err != nil {
+		t.Fatalf("PlanAll failed: %v", err)
+	}
+	for i, want := range []Status{StatusPending, StatusPending, StatusAlways} {
+		if plans[i].Status != want {
+			t.Errorf("%s status = %s, want %s", plans[i].Script.Name, plans[i].Status, want)
+		}
+	}
+	first := plans[0].Hash
+	for _, plan := range plans {
+		Record(runs, plan)
+	}
+	if plans, _ = PlanAll(scripts, runs); plans[0].Due() || plans[1].Due() || !plans[2].Due() {
+		t.Errorf("statuses after recording = %s, %s, %s", plans[0].Status, plans[1].Status, plans[2].Status)
+	}
+
+	if err := os.WriteFile(watched, []byte("brew \"git\"\nbrew \"jq\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("echo install v2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plans, _ = PlanAll(scripts, runs)
+	if plans[0].Status != StatusChanged || plans[1].Status != StatusChanged {
+		t.Errorf("statuses after edits = %s, %s", plans[0].Status, plans[1].Status)
+	}
+	Record(runs, plans[0])
+
+	if err := os.WriteFile(path, []byte("echo install\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plans, _ = PlanAll(scripts, runs)
+	if plans[0].Hash != first || plans[0].Due() {
+		t.Errorf("once script reverted to content that already ran is %s", plans[0].Status)
+	}
+}
+
+func TestPlanAllRejectsInvalidScripts(t *testing.T) {
+	for _, scripts := range [][]config.Script{
+		{{Name: "a"}},
+		{{Name: "a", Command: "true", Path: "/x"}},
+		{{Name: "a", Command: "true", Run: "daily"}},
+		{{Name: "a", Command: "true"}, {Name: "a", Command: "false"}},
+	} {
+		if _, err := PlanAll(scripts, nil); err == nil {
+			t.Errorf("PlanAll(%+v) succeeded", scripts)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("script tests use sh")
+	}
+	home := t.TempDir()
+	path := filepath.Join(home, "setup.sh")
+	if err := os.WriteFile(path, []byte("echo \"$DOTS_SCRIPT in $PWD\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := Run(home, config.Script{Name: "setup", Path: path}, &out, &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "setup in "+home {
+		t.Errorf("output = %q", got)
+	}
+	if err := Run(home, config.Script{Name: "fail", Command: "exit 2"}, &out, &out); err == nil {
+		t.Error("failing script returned no error")
+	}
+	err := Run(home, config.Script{Name: "slow", Command: "sleep 5", Timeout: "100ms"}, &out, &out)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("slow script error = %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/subcode-labs/dots/internal/config"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/filter"
+)
+
+const AllowMarker = "dots:allow-secret"
+
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+type Finding struct {
+	Path string
+	Line int
+	Rule string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s", f.Path, f.Line, f.Rule)
+}
+
+type FoundError struct {
+	Findings []Finding
+}
+
+func (e *FoundError) Error() string {
+	lines := make([]string, 0, len(e.Findings))
+	for _, finding := range e.Findings {
+		lines = append(lines, fmt.Sprintf("line %d (%s)", finding.Line, finding.Rule))
+	}
+	return fmt.Sprintf("possible secrets found: %s", strings.Join(lines, ", "))
+}
+
+var builtinRules = []Rule{
+	{"private-key", regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|ENCRYPTED|PGP) )?PRIVATE KEY( BLOCK)?-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_secret_access_key\s*[=:]\s*["']?[A-Za-z0-9/+]{40}`)},
+	{"github-token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`)},
+	{"gitlab-token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"stripe-key", regexp.MustCompile(`\b[sr]k_live_[A-Za-z0-9]{20,}\b`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"npm-token", regexp.MustCompile(`(_authToken\s*=\s*\S+|\bnpm_[A-Za-z0-9]{36}\b)`)},
+	{"netrc-password", regexp.MustCompile(`^\s*(machine\s+\S+\s+)?(login\s+\S+\s+)?password\s+\S+`)},
+	{"basic-auth-url", regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@]+:[^/\s:@]{3,}@`)},
+}
+
+var assignmentPattern = regexp.MustCompile(`(?i)[\w.-]*(key|token|secret|passw(or)?d|pwd|credential|auth)[\w.-]*["']?\s*[:=]\s*["']?([A-Za-z0-9+/=_\-.]{20,})`)
+
+const minEntropy = 3.5
+
+type Scanner struct {
+	rules      []Rule
+	allow      []*regexp.Regexp
+	allowPaths []string
+}
+
+func New(home string, cfg config.SecretsConfig) (*Scanner, error) {
+	scanner := &Scanner{rules: append([]Rule{}, builtinRules...)}
+	for _, pattern := range cfg.AllowPaths {
+		if strings.HasPrefix(pattern, "~/") {
+			pattern = filepath.Join(home, pattern[2:])
+		}
+		scanner.allowPaths = append(scanner.allowPaths, pattern)
+	}
+	for _, rule := range cfg.Rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret rule %q: %w", rule.Name, err)
+		}
+		name := rule.Name
+		if name == "" {
+			name = "custom"
+		}
+		scanner.rules = append(scanner.rules, Rule{Name: name, Pattern: pattern})
+	}
+	for _, allow := range cfg.Allow {
+		pattern, err := regexp.Compile(allow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret allowlist pattern %q: %w", allow, err)
+		}
+		scanner.allow = append(scanner.allow, pattern)
+	}
+	return scanner, nil
+}
+
+func (s *Scanner) ScanFile(path string) ([]Finding, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	return s.Scan(path, content), nil
+}
+
+func (s *Scanner) Scan(path string, content []byte) []Finding {
+	if s.pathAllowed(path) || bytes.IndexByte(content, 0) >= 0 {
+		return nil
+	}
+	var findings []Finding
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+	for number := 1; scanner.Scan(); number++ {
+		line := filter.StripPlaceholders(scanner.Text())
+		if strings.Contains(line, AllowMarker) || s.lineAllowed(line) {
+			continue
+		}
+		if rule := s.matchLine(line); rule != "" {
+			findings = append(findings, Finding{Path: path, Line: number, Rule: rule})
+		}
+	}
+	return findings
+}
+
+func (s *Scanner) matchLine(line string) string {
+	for _, rule := range s.rules {
+		if rule.Pattern.MatchString(line) {
+			return rule.Name
+		}
+	}
+	for _, match := range assignmentPattern.FindAllStringSubmatch(line, -1) {
+		value := match[3]
+		if strings.HasPrefix(value, "/") || strings.HasPrefix(value, ".") {
+			continue
+		}
+		if Entropy(value) >= minEntropy {
+			return "high-entropy-assignment"
+		}
+	}
+	return ""
+}
+
+func (s *Scanner) lineAllowed(line string) bool {
+	for _, pattern := range s.allow {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scanner) pathAllowed(path string) bool {
+	for _, pattern := range s.allowPaths {
+		name := path
+		if !strings.ContainsRune(pattern, '/') {
+			name = filepath.Base(path)
+		}
+		if ok, _ := dotfile.MatchPattern(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func Entropy(value string) float64 {
+	if value == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range value {
+		counts[r]++
+	}
+	var entropy float64
+	length := float64(len([]rune(value)))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
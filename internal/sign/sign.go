@@ -0,0 +1,398 @@
+package sign
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+const (
+	PublicKeyPrefix = "dotssig1"
+	SecretKeyPrefix = "DOTSSIGKEY1"
+
+	header = "dots-signature v1"
+)
+
+var (
+	ErrUnsigned     = errors.New("dots repository is not signed, run 'dots sign'")
+	ErrBadSignature = errors.New("signature does not match its contents")
+)
+
+var encoding = base64.RawURLEncoding
+
+type TrustedKey struct {
+	Name string
+	Key  string
+}
+
+type UntrustedError struct {
+	Key string
+}
+
+func (e *UntrustedError) Error() string {
+	return fmt.Sprintf("signed by untrusted key %s, add it with 'dots trust add'", e.Key)
+}
+
+type Change struct {
+	Path string
+	Kind string
+}
+
+type ChangedError struct {
+	Signer  string
+	Changes []Change
+}
+
+func (e *ChangedError) Error() string {
+	return fmt.Sprintf("%d files changed since the signature by %s", len(e.Changes), e.Signer)
+}
+
+type Statement struct {
+	Key      string
+	Manifest string
+	Files    map[string]string
+}
+
+func GenerateKey() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+	return key, nil
+}
+
+func FormatPublicKey(key ed25519.PublicKey) string {
+	return PublicKeyPrefix + encoding.EncodeToString(key)
+}
+
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, PublicKeyPrefix) {
+		return nil, fmt.Errorf("invalid signing key %q: missing %s prefix", value, PublicKeyPrefix)
+	}
+	raw, err := encoding.DecodeString(strings.TrimPrefix(value, PublicKeyPrefix))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid signing key %q", value)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+func FormatSecretKey(key ed25519.PrivateKey) string {
+	return SecretKeyPrefix + encoding.EncodeToString(key.Seed())
+}
+
+func ParseSecretKey(value string) (ed25519.PrivateKey, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, SecretKeyPrefix) {
+		return nil, fmt.Errorf("invalid signing key: missing %s prefix", SecretKeyPrefix)
+	}
+	raw, err := encoding.DecodeString(strings.TrimPrefix(value, SecretKeyPrefix))
+	if err != nil || len(raw) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid signing key")
+	}
+	return ed25519.NewKeyFromSeed(raw), nil
+}
+
+func PublicKey(key ed25519.PrivateKey) string {
+	return FormatPublicKey(key.Public().(ed25519.PublicKey))
+}
+
+func configPath(env, name string) (string, error) {
+	if path := os.Getenv(env); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve config directory: %w", err)
+	}
+	return filepath.Join(dir, "dots", name), nil
+}
+
+func DefaultKeyPath() (string, error) {
+	return configPath("DOTS_SIGNING_KEY", "signing.key")
+}
+
+func DefaultTrustPath() (string, error) {
+	return configPath("DOTS_TRUSTED_KEYS", "trusted_keys")
+}
+
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("signing key %s not found, run 'dots sign --generate'", path)
+		}
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return ParseSecretKey(line)
+	}
+	return nil, fmt.Errorf("signing key file %s is empty", path)
+}
+
+func SaveKey(path string, key ed25519.PrivateKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create key directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("signing key %s already exists", path)
+		}
+		return fmt.Errorf("create signing key: %w", err)
+	}
+	defer file.Close()
+	content := fmt.Sprintf("# public key: %s\n%s\n", PublicKey(key), FormatSecretKey(key))
+	if _, err := file.WriteString(content); err != nil {
+		return fmt.Errorf("write signing key: %w", err)
+	}
+	return nil
+}
+
+func LoadTrusted(path string) ([]TrustedKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read trusted keys: %w", err)
+	}
+	var keys []TrustedKey
+	for number, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, name, _ := strings.Cut(line, " ")
+		if _, err := ParsePublicKey(key); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, number+1, err)
+		}
+		keys = append(keys, TrustedKey{Name: strings.TrimSpace(name), Key: key})
+	}
+	return keys, nil
+}
+
+func SaveTrusted(path string, keys []TrustedKey) error {
+	var out strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&out, "%s %s\n", key.Key, key.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create trust directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(out.String()), 0o644); err != nil {
+		return fmt.Errorf("write trusted keys: %w", err)
+	}
+	return nil
+}
+
+func SignaturePath(dir string) string {
+	return filepath.Join(dir, config.SignatureName)
+}
+
+func Digest(dir string, manifest *config.Manifest) (*Statement, error) {
+	data, err := os.ReadFile(filepath.Join(dir, config.ManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	statement := &Statement{Manifest: hash(data), Files: make(map[string]string)}
+	for _, entry := range manifest.Files {
+		if entry.Local {
+			continue
+		}
+		rel, ok := within(dir, entry.Source)
+		if !ok {
+			return nil, fmt.Errorf("stored file %s is outside the dots directory", entry.Source)
+		}
+		if err := statement.add(rel, entry.Source); err != nil {
+			return nil, err
+		}
+	}
+	for _, script := range manifest.Scripts {
+		paths := script.Watch
+		if script.Path != "" {
+			paths = append([]string{script.Path}, paths...)
+		}
+		for _, path := range paths {
+			rel, ok := within(dir, path)
+			if !ok {
+				continue
+			}
+			if err := statement.add(rel, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return statement, nil
+}
+
+func within(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (s *Statement) add(rel, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read stored file: %w", err)
+	}
+	s.Files[rel] = hash(content)
+	return nil
+}
+
+func Sign(dir string, manifest *config.Manifest, key ed25519.PrivateKey) error {
+	statement, err := Digest(dir, manifest)
+	if err != nil {
+		return err
+	}
+	statement.Key = PublicKey(key)
+	body := statement.encode()
+	signature := ed25519.Sign(key, body)
+	content := append(body, "signature "+encoding.EncodeToString(signature)+"\n"...)
+	if err := os.WriteFile(SignaturePath(dir), content, 0o644); err != nil {
+		return fmt.Errorf("write signature: %w", err)
+	}
+	return nil
+}
+
+func Verify(dir string, manifest *config.Manifest, trusted []TrustedKey) (TrustedKey, error) {
+	data, err := os.ReadFile(SignaturePath(dir))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return TrustedKey{}, ErrUnsigned
+		}
+		return TrustedKey{}, fmt.Errorf("read signature: %w", err)
+	}
+	signed, err := parseSignature(data)
+	if err != nil {
+		return TrustedKey{}, err
+	}
+	var signer TrustedKey
+	found := false
+	for _, key := range trusted {
+		if key.Key == signed.Key {
+			signer, found = key, true
+			break
+		}
+	}
+	if !found {
+		return TrustedKey{}, &UntrustedError{Key: signed.Key}
+	}
+
+	current, err := Digest(dir, manifest)
+	if err != nil {
+		return signer, err
+	}
+	var changes []Change
+	if current.Manifest != signed.Manifest {
+		changes = append(changes, Change{Path: config.ManifestName, Kind: "modified"})
+	}
+	for path, sum := range current.Files {
+		previous, ok := signed.Files[path]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: path, Kind: "added"})
+		case previous != sum:
+			changes = append(changes, Change{Path: path, Kind: "modified"})
+		}
+	}
+	for path := range signed.Files {
+		if _, ok := current.Files[path]; !ok {
+			changes = append(changes, Change{Path: path, Kind: "removed"})
+		}
+	}
+	if len(changes) > 0 {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+		name := signer.Name
+		if name == "" {
+			name = signer.Key
+		}
+		return signer, &ChangedError{Signer: name, Changes: changes}
+	}
+	return signer, nil
+}
+
+func parseSignature(data []byte) (*Statement, error) {
+	index := bytes.LastIndex(data, []byte("\nsignature "))
+	if !bytes.HasPrefix(data, []byte(header+"\n")) || index < 0 {
+		return nil, fmt.Errorf("malformed signature file")
+	}
+	body := data[:index+1]
+	signature, err := encoding.DecodeString(strings.TrimSpace(string(data[index+len("\nsignature "):])))
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	statement := &Statement{Files: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Scan()
+	for scanner.Scan() {
+		kind, value, _ := strings.Cut(scanner.Text(), " ")
+		switch kind {
+		case "key":
+			statement.Key = value
+		case "manifest":
+			statement.Manifest = value
+		case "file":
+			sum, path, ok := strings.Cut(value, " ")
+			if !ok {
+				return nil, fmt.Errorf("malformed signature line %q", scanner.Text())
+			}
+			statement.Files[path] = sum
+		default:
+			return nil, fmt.Errorf("malformed signature line %q", scanner.Text())
+		}
+	}
+	publicKey, err := ParsePublicKey(statement.Key)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(publicKey, body, signature) {
+		return nil, ErrBadSignature
+	}
+	return statement, nil
+}
+
+func (s *Statement) encode() []byte {
+	var out bytes.Buffer
+	out.WriteString(header + "\n")
+	fmt.Fprintf(&out, "key %s\n", s.Key)
+	fmt.Fprintf(&out, "manifest %s\n", s.Manifest)
+	paths := make([]string, 0, len(s.Files))
+	for path := range s.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&out, "file %s %s\n", s.Files[path], path)
+	}
+	return out.Bytes()
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,210 @@
+package sign
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+func setupRepo(t *testing.T) (string, *config.Manifest) {
+	t.Helper()
+	home := t.TempDir()
+	if _, err := config.EnsureDotsDir(home); err != nil {
+		t.Fatalf("EnsureDotsDir failed: %v", err)
+	}
+	manifest := &config.Manifest{}
+	for _, name := range []string{".bashrc", ".vimrc", "my notes"} {
+		source := filepath.Join(config.DotsDir(home), name)
+		if err := os.WriteFile(source, []byte("content of "+name), 0o644); err != nil {
+			t.Fatalf("failed to write stored file: %v", err)
+		}
+		manifest.Files = append(manifest.Files, config.FileEntry{Source: source, Target: filepath.Join(home, name)})
+	}
+	if err := config.Save(home, manifest); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	return home, manifest
+}
+
+func signRepo(t *testing.T, home string, manifest *config.Manifest) []TrustedKey {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if err := Sign(config.DotsDir(home), manifest, key); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return []TrustedKey{{Name: "maintainer", Key: PublicKey(key)}}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	home, manifest := setupRepo(t)
+	trusted := signRepo(t, home, manifest)
+
+	signer, err := Verify(config.DotsDir(home), manifest, trusted)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if signer.Name != "maintainer" {
+		t.Errorf("signer = %+v", signer)
+	}
+}
+
+func TestVerifyReportsChanges(t *testing.T) {
+	home, manifest := setupRepo(t)
+	trusted := signRepo(t, home, manifest)
+
+	if err := os.WriteFile(manifest.Files[0].Source, []byte("tampered"), 0o644); err != nil {
+		t.Fatalf("failed to modify stored file: %v", err)
+	}
+	if err := os.Remove(manifest.Files[1].Source); err != nil {
+		t.Fatalf("failed to remove stored file: %v", err)
+	}
+	extra := filepath.Join(config.DotsDir(home), ".zshrc")
+	if err := os.WriteFile(extra, []byte("new"), 0o644); err != nil {
+		t.Fatalf("failed to write stored file: %v", err)
+	}
+	manifest.Files = append(manifest.Files, config.FileEntry{Source: extra, Target: filepath.Join(home, ".zshrc")})
+	if err := config.Save(home, manifest); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	_, err := Verify(config.DotsDir(home), manifest, trusted)
+	var changed *ChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Verify error = %v, want ChangedError", err)
+	}
+	want := []Change{
+		{Path: ".bashrc", Kind: "modified"},
+		{Path: ".vimrc", Kind: "removed"},
+		{Path: ".zshrc", Kind: "added"},
+		{Path: config.ManifestName, Kind: "modified"},
+	}
+	if !reflect.DeepEqual(changed.Changes, want) {
+		t.Errorf("changes = %+v, want %+v", changed.Changes, want)
+	}
+}
+
+func TestVerifyCoversScripts(t *testing.T) {
+	home, manifest := setupRepo(t)
+	dir := config.DotsDir(home)
+	for _, name := range []string{"setup.sh", "packages.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("content of "+name), 0o644); err != nil {
+			t.Fatalf("failed to write script: %v", err)
+		}
+	}
+	manifest.Scripts = []config.Script{{
+		Name:  "setup",
+		Path:  filepath.Join(dir, "setup.sh"),
+		Watch: []string{filepath.Join(dir, "packages.txt"), filepath.Join(home, ".profile")},
+	}}
+	if err := config.Save(home, manifest); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	trusted := signRepo(t, home, manifest)
+
+	for _, name := range []string{"setup.sh", "packages.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("tampered"), 0o644); err != nil {
+			t.Fatalf("failed to modify script: %v", err)
+		}
+	}
+	_, err := Verify(dir, manifest, trusted)
+	var changed *ChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Verify error = %v, want ChangedError", err)
+	}
+	want := []Change{
+		{Path: "packages.txt", Kind: "modified"},
+		{Path: "setup.sh", Kind: "modified"},
+	}
+	if !reflect.DeepEqual(changed.Changes, want) {
+		t.Errorf("changes = %+v, want %+v", changed.Changes, want)
+	}
+}
+
+func TestVerifyIgnoresLocalEntries(t *testing.T) {
+	home, manifest := setupRepo(t)
+	trusted := signRepo(t, home, manifest)
+
+	local := filepath.Join(config.DotsDir(home), ".bashrc.local")
+	if err := os.WriteFile(local, []byte("local"), 0o644); err != nil {
+		t.Fatalf("failed to write stored file: %v", err)
+	}
+	manifest.Files = append(manifest.Files, config.FileEntry{Source: local, Target: filepath.Join(home, ".bashrc.local"), Local: true})
+	if err := config.Save(home, manifest); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := Verify(config.DotsDir(home), manifest, trusted); err != nil {
+		t.Errorf("local entries should not affect verification: %v", err)
+	}
+}
+
+func TestVerifyRejectsUntrustedAndTampered(t *testing.T) {
+	home, manifest := setupRepo(t)
+	if _, err := Verify(config.DotsDir(home), manifest, nil); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned repo error = %v, want ErrUnsigned", err)
+	}
+
+	signRepo(t, home, manifest)
+	other, _ := GenerateKey()
+	var untrusted *UntrustedError
+	if _, err := Verify(config.DotsDir(home), manifest, []TrustedKey{{Name: "other", Key: PublicKey(other)}}); !errors.As(err, &untrusted) {
+		t.Errorf("untrusted key error = %v, want UntrustedError", err)
+	}
+
+	trusted := signRepo(t, home, manifest)
+	data, _ := os.ReadFile(SignaturePath(config.DotsDir(home)))
+	forged := []byte(string(data[:len(header)+1]) + "manifest 00\n" + string(data[len(header)+1:]))
+	if err := os.WriteFile(SignaturePath(config.DotsDir(home)), forged, 0o644); err != nil {
+		t.Fatalf("failed to write signature: %v", err)
+	}
+	if _, err := Verify(config.DotsDir(home), manifest, trusted); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("tampered signature error = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	keyPath := filepath.Join(dir, "signing.key")
+	if err := SaveKey(keyPath, key); err != nil {
+		t.Fatalf("SaveKey failed: %v", err)
+	}
+	if err := SaveKey(keyPath, key); err == nil {
+		t.Error("SaveKey should not overwrite an existing key")
+	}
+	loaded, err := LoadKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadKey failed: %v", err)
+	}
+	if PublicKey(loaded) != PublicKey(key) {
+		t.Error("loaded key does not match the saved key")
+	}
+
+	trustPath := filepath.Join(dir, "trusted_keys")
+	trusted := []TrustedKey{{Name: "alice", Key: PublicKey(key)}}
+	if err := SaveTrusted(trustPath, trusted); err != nil {
+		t.Fatalf("SaveTrusted failed: %v", err)
+	}
+	got, err := LoadTrusted(trustPath)
+	if err != nil {
+		t.Fatalf("LoadTrusted failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, trusted) {
+		t.Errorf("LoadTrusted = %+v, want %+v", got, trusted)
+	}
+	if err := os.WriteFile(trustPath, []byte("not-a-key alice\n"), 0o644); err != nil {
+		t.Fatalf("failed to write trusted keys: %v", err)
+	}
+	if _, err := LoadTrusted(trustPath); err == nil {
+		t.Error("LoadTrusted should reject invalid keys")
+	}
+}
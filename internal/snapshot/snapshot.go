@@ -0,0 +1,456 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/subcode-labs/dots/internal/state"
+)
+
+const (
+	dirName   = "snapshots"
+	extension = ".tar.gz"
+	indexName = ".dots-snapshot.yaml"
+
+	DefaultThreshold = 10
+)
+
+type Kind string
+
+const (
+	KindAbsent  Kind = "absent"
+	KindFile    Kind = "file"
+	KindSymlink Kind = "symlink"
+)
+
+type Path struct {
+	Path     string `yaml:"path"`
+	Kind     Kind   `yaml:"kind"`
+	Resolved string `yaml:"resolved,omitempty"`
+}
+
+type Snapshot struct {
+	ID        string    `yaml:"id"`
+	CreatedAt time.Time `yaml:"created_at"`
+	Reason    string    `yaml:"reason,omitempty"`
+	Paths     []Path    `yaml:"paths"`
+	Size      int64     `yaml:"-"`
+}
+
+func Threshold(setting int) int {
+	switch {
+	case setting < 0:
+		return 0
+	case setting == 0:
+		return DefaultThreshold
+	}
+	return setting
+}
+
+func Dir() (string, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, dirName), nil
+}
+
+func archivePath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid snapshot id %q", id)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+extension), nil
+}
+
+func Create(targets []string, store, reason string) (Snapshot, error) {
+	dir, err := Dir()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return Snapshot{}, fmt.Errorf("create snapshot directory: %w", err)
+	}
+	now := time.Now().UTC()
+	snap := Snapshot{ID: now.Format("20060102T150405"), CreatedAt: now, Reason: reason}
+	for n := 1; ; n++ {
+		if _, err := os.Stat(filepath.Join(dir, snap.ID+extension)); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		snap.ID = fmt.Sprintf("%s-%d", now.Format("20060102T150405"), n)
+	}
+
+	seen := map[string]bool{}
+	var infos []os.FileInfo
+	for _, target := range targets {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		info, err := os.Lstat(target)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			snap.Paths = append(snap.Paths, Path{Path: target, Kind: KindAbsent})
+			infos = append(infos, nil)
+			continue
+		case err != nil:
+			return Snapshot{}, fmt.Errorf("stat %s: %w", target, err)
+		case info.Mode()&os.ModeSymlink != 0:
+			snap.Paths = append(snap.Paths, Path{Path: target, Kind: KindSymlink, Resolved: resolveInto(target, store)})
+		case info.Mode().IsRegular():
+			snap.Paths = append(snap.Paths, Path{Path: target, Kind: KindFile})
+		default:
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	path := filepath.Join(dir, snap.ID+extension)
+	if err := writeArchive(path, snap, infos); err != nil {
+		os.Remove(path)
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+func writeArchive(path string, snap Snapshot, infos []os.FileInfo) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer file.Close()
+	compressed := gzip.NewWriter(file)
+	archive := tar.NewWriter(compressed)
+
+	index, err := yaml.Marshal(&snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot index: %w", err)
+	}
+	if err := archive.WriteHeader(&tar.Header{Name: indexName, Mode: 0o600, Size: int64(len(index)), ModTime: snap.CreatedAt}); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if _, err := archive.Write(index); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	resolved := map[string]bool{}
+	for i, entry := range snap.Paths {
+		if entry.Kind == KindAbsent {
+			continue
+		}
+		if err := addPath(archive, entry.Path, infos[i]); err != nil {
+			return err
+		}
+		if entry.Resolved == "" || resolved[entry.Resolved] {
+			continue
+		}
+		resolved[entry.Resolved] = true
+		info, err := os.Stat(entry.Resolved)
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", entry.Resolved, err)
+		}
+		if err := addPath(archive, entry.Resolved, info); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := compressed.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+func addPath(archive *tar.Writer, path string, info os.FileInfo) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return fmt.Errorf("read symlink: %w", err)
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	header.Name = memberName(path)
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	source, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	defer source.Close()
+	if _, err := io.Copy(archive, source); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+func resolveInto(link, store string) string {
+	if store == "" {
+		return ""
+	}
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return ""
+	}
+	if real, err := filepath.EvalSymlinks(store); err == nil {
+		store = real
+	}
+	rel, err := filepath.Rel(store, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	return resolved
+}
+
+func memberName(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(path, filepath.VolumeName(path))), "/")
+}
+
+func List() ([]Snapshot, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read snapshot directory: %w", err)
+	}
+	var snaps []Snapshot
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), extension) {
+			continue
+		}
+		snap, err := Load(strings.TrimSuffix(file.Name(), extension))
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].CreatedAt.Before(snaps[j].CreatedAt)
+	})
+	return snaps, nil
+}
+
+func Load(id string) (Snapshot, error) {
+	var snap Snapshot
+	err := walk(id, func(header *tar.Header, content io.Reader) error {
+		if header.Name != indexName {
+			return nil
+		}
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return fmt.Errorf("read snapshot index: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &snap); err != nil {
+			return fmt.Errorf("parse snapshot index: %w", err)
+		}
+		return errStop
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	path, _ := archivePath(id)
+	if info, err := os.Stat(path); err == nil {
+		snap.Size = info.Size()
+	}
+	return snap, nil
+}
+
+var errStop = errors.New("stop")
+
+func walk(id string, visit func(*tar.Header, io.Reader) error) error {
+	path, err := archivePath(id)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("snapshot %s not found", id)
+		}
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+	defer file.Close()
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("read snapshot %s: %w", id, err)
+	}
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read snapshot %s: %w", id, err)
+		}
+		if err := visit(header, archive); err != nil {
+			if errors.Is(err, errStop) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func Restore(id string) (Snapshot, error) {
+	snap, err := Load(id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	members := map[string]string{}
+	for _, entry := range snap.Paths {
+		for _, path := range []string{entry.Path, entry.Resolved} {
+			if path == "" || members[memberName(path)] != "" {
+				continue
+			}
+			if err := replaceable(path); err != nil {
+				return Snapshot{}, err
+			}
+			members[memberName(path)] = path
+		}
+	}
+	staged := map[string]string{}
+	discard := func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}
+	err = walk(id, func(header *tar.Header, content io.Reader) error {
+		target, ok := members[header.Name]
+		if !ok || staged[target] != "" {
+			return nil
+		}
+		if header.Typeflag != tar.TypeSymlink && header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		tmp, err := stage(target, header, content)
+		if err != nil {
+			return fmt.Errorf("restore %s: %w", target, err)
+		}
+		staged[target] = tmp
+		return nil
+	})
+	if err != nil {
+		discard()
+		return Snapshot{}, err
+	}
+	for _, target := range members {
+		tmp, ok := staged[target]
+		if !ok {
+			if err := clear(target); err != nil {
+				discard()
+				return Snapshot{}, err
+			}
+			continue
+		}
+		if err := os.Rename(tmp, target); err != nil {
+			discard()
+			return Snapshot{}, fmt.Errorf("restore %s: %w", target, err)
+		}
+		delete(staged, target)
+	}
+	return snap, nil
+}
+
+func stage(target string, header *tar.Header, content io.Reader) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", fmt.Errorf("create parent directory: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".dots-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := file.Name()
+	if header.Typeflag == tar.TypeSymlink {
+		file.Close()
+		if err := os.Remove(tmp); err != nil {
+			return "", err
+		}
+		if err := os.Symlink(header.Linkname, tmp); err != nil {
+			return "", err
+		}
+		return tmp, nil
+	}
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, header.FileInfo().Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, header.ModTime, header.ModTime)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+func replaceable(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is now a directory, move it away before restoring", path)
+	}
+	return nil
+}
+
+func clear(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	return nil
+}
+
+func Delete(id string) error {
+	path, err := archivePath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("snapshot %s not found", id)
+		}
+		return fmt.Errorf("delete snapshot: %w", err)
+	}
+	return nil
+}
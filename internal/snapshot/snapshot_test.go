@@ -0,0 +1,168 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateRestoreDelete(t *testing.T) {
+	t.Setenv("DOTS_STATE", t.TempDir())
+	home := t.TempDir()
+	file := filepath.Join(home, ".zshrc")
+	link := filepath.Join(home, ".vimrc")
+	absent := filepath.Join(home, ".config", "app", "config")
+	if err := os.WriteFile(file, []byte("mine\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/vimrc", link); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := Create([]string{file, link, absent, file}, filepath.Join(home, ".dots"), "test")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if len(snap.Paths) != 3 {
+		t.Fatalf("Paths = %+v, want 3 entries", snap.Paths)
+	}
+
+	os.Remove(file)
+	if err := os.Symlink("/elsewhere", file); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(link)
+	if err := os.WriteFile(link, []byte("replaced\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(absent), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(absent, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(snap.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	info, err := os.Lstat(file)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm() != 0o640 {
+		t.Errorf("file after restore = %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "mine\n" {
+		t.Errorf("file content = %q", data)
+	}
+	if target, err := os.Readlink(link); err != nil || target != "/etc/vimrc" {
+		t.Errorf("link after restore = %q, %v", target, err)
+	}
+	if _, err := os.Lstat(absent); !os.IsNotExist(err) {
+		t.Errorf("absent path exists after restore: %v", err)
+	}
+
+	snaps, err := List()
+	if err != nil || len(snaps) != 1 || snaps[0].ID != snap.ID || snaps[0].Reason != "test" || snaps[0].Size == 0 {
+		t.Fatalf("List = %+v, %v", snaps, err)
+	}
+	if err := Delete(snap.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if snaps, err := List(); err != nil || len(snaps) != 0 {
+		t.Errorf("List after delete = %+v, %v", snaps, err)
+	}
+	if err := Delete(snap.ID); err == nil {
+		t.Error("Delete of a missing snapshot succeeded")
+	}
+	if err := Delete("../applied"); err == nil {
+		t.Error("Delete accepted a path")
+	}
+}
+
+func TestRestoreKeepsFilesWhenExtractionFails(t *testing.T) {
+	t.Setenv("DOTS_STATE", t.TempDir())
+	home := t.TempDir()
+	file := filepath.Join(home, ".zshrc")
+	if err := os.WriteFile(file, make([]byte, 1<<16), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := Create([]string{file}, filepath.Join(home, ".dots"), "test")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	archive, err := archivePath(snap.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archive, data[:len(data)-16], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(snap.ID); err == nil {
+		t.Fatal("Restore of a truncated snapshot succeeded")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "edited\n" {
+		t.Errorf("file after failed restore = %.20q", data)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(home, ".*.dots-*")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestCreateKeepsStoredContentOfLinks(t *testing.T) {
+	t.Setenv("DOTS_STATE", t.TempDir())
+	home := t.TempDir()
+	store := filepath.Join(home, ".dots")
+	stored := filepath.Join(store, "vimrc")
+	if err := os.MkdirAll(store, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stored, []byte("set number\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	links := []string{filepath.Join(home, ".vimrc"), filepath.Join(home, ".nvimrc")}
+	for _, link := range links {
+		if err := os.Symlink(stored, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := Create(links, store, "pull")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if snap.Paths[0].Resolved != stored {
+		t.Fatalf("Paths = %+v, want resolved %s", snap.Paths, stored)
+	}
+	if err := os.WriteFile(stored, []byte("pulled\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(snap.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	for _, link := range links {
+		if target, err := os.Readlink(link); err != nil || target != stored {
+			t.Errorf("link after restore = %q, %v", target, err)
+		}
+	}
+	if data, err := os.ReadFile(stored); err != nil || string(data) != "set number\n" {
+		t.Errorf("stored content = %q, %v", data, err)
+	}
+	if info, err := os.Stat(stored); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("stored mode = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	for setting, want := range map[int]int{-1: 0, 0: DefaultThreshold, 3: 3} {
+		if got := Threshold(setting); got != want {
+			t.Errorf("Threshold(%d) = %d, want %d", setting, got, want)
+		}
+	}
+}
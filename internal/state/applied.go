@@ -0,0 +1,103 @@
+package state
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const appliedFileName = "applied.yaml"
+
+type Mode string
+
+const (
+	ModeLink Mode = "link"
+	ModeCopy Mode = "copy"
+)
+
+type Applied struct {
+	Target    string    `yaml:"target"`
+	Source    string    `yaml:"source"`
+	Mode      Mode      `yaml:"mode"`
+	Block     string    `yaml:"block,omitempty"`
+	Merge     bool      `yaml:"merge,omitempty"`
+	Arrays    string    `yaml:"arrays,omitempty"`
+	Hash      string    `yaml:"hash,omitempty"`
+	Revision  string    `yaml:"revision,omitempty"`
+	AppliedAt time.Time `yaml:"applied_at"`
+}
+
+type appliedFile struct {
+	Home    string    `yaml:"home"`
+	Entries []Applied `yaml:"entries"`
+}
+
+func Hash(content []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
+
+func appliedPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appliedFileName), nil
+}
+
+func LoadApplied(home string) (map[string]Applied, error) {
+	path, err := appliedPath()
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]Applied{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, fmt.Errorf("read applied state: %w", err)
+	}
+	var file appliedFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse applied state: %w", err)
+	}
+	if file.Home != home {
+		return entries, nil
+	}
+	for _, entry := range file.Entries {
+		entries[entry.Target] = entry
+	}
+	return entries, nil
+}
+
+func SaveApplied(home string, entries map[string]Applied) error {
+	path, err := appliedPath()
+	if err != nil {
+		return err
+	}
+	file := appliedFile{Home: home, Entries: make([]Applied, 0, len(entries))}
+	for _, entry := range entries {
+		file.Entries = append(file.Entries, entry)
+	}
+	sort.Slice(file.Entries, func(i, j int) bool {
+		return file.Entries[i].Target < file.Entries[j].Target
+	})
+	data, err := yaml.Marshal(&file)
+	if err != nil {
+		return fmt.Errorf("encode applied state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write applied state: %w", err)
+	}
+	return nil
+}
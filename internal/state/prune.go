@@ -0,0 +1,129 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/subcode-labs/dots/internal/block"
+	"github.com/subcode-labs/dots/internal/dotfile"
+	"github.com/subcode-labs/dots/internal/structured"
+)
+
+type PruneResult string
+
+const (
+	PruneUnlinked PruneResult = "unlinked"
+	PruneRestored PruneResult = "restored"
+	PruneRemoved  PruneResult = "removed"
+	PruneDetached PruneResult = "detached"
+	PruneKept     PruneResult = "kept"
+)
+
+func Prune(entry Applied, content func() ([]byte, bool)) (PruneResult, error) {
+	if entry.Mode == ModeCopy {
+		return pruneCopy(entry, content)
+	}
+	if entry.Mode != ModeLink {
+		return PruneKept, nil
+	}
+	link, err := os.Readlink(entry.Target)
+	if err != nil || link != entry.Source {
+		return PruneKept, nil
+	}
+	data, ok := content()
+	if err := os.Remove(entry.Target); err != nil {
+		return "", fmt.Errorf("remove stale link: %w", err)
+	}
+	if !ok {
+		return PruneUnlinked, nil
+	}
+	if err := dotfile.WriteCopy(entry.Target, data, 0o644); err != nil {
+		return "", err
+	}
+	return PruneRestored, nil
+}
+
+func pruneCopy(entry Applied, content func() ([]byte, bool)) (PruneResult, error) {
+	path := entry.Target
+	if entry.Block != "" || entry.Merge {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return PruneRemoved, nil
+		}
+		return "", fmt.Errorf("stat %s: %w", entry.Target, err)
+	}
+	if !info.Mode().IsRegular() {
+		return PruneKept, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", entry.Target, err)
+	}
+	var updated []byte
+	switch {
+	case entry.Block != "":
+		managed, found, err := block.Extract(data, entry.Block)
+		if err != nil || !found || Hash(managed) != entry.Hash {
+			return PruneKept, nil
+		}
+		if updated, _, err = block.Remove(data, entry.Block); err != nil {
+			return PruneKept, nil
+		}
+	case entry.Merge:
+		stored, ok := content()
+		if !ok {
+			return PruneKept, nil
+		}
+		if updated, ok = unmerge(entry, data, stored); !ok {
+			return PruneKept, nil
+		}
+	default:
+		if Hash(data) != entry.Hash {
+			return PruneKept, nil
+		}
+		if err := os.Remove(path); err != nil {
+			return "", fmt.Errorf("remove %s: %w", entry.Target, err)
+		}
+		return PruneRemoved, nil
+	}
+	if err := dotfile.WriteCopy(path, updated, info.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return PruneDetached, nil
+}
+
+func unmerge(entry Applied, data, stored []byte) ([]byte, bool) {
+	format, err := structured.FormatFor(entry.Target)
+	if err != nil {
+		return nil, false
+	}
+	arrays, err := structured.ParseArrays(entry.Arrays)
+	if err != nil {
+		return nil, false
+	}
+	patch, err := structured.Decode(format, stored)
+	if err != nil {
+		return nil, false
+	}
+	live, err := structured.Decode(format, data)
+	if err != nil {
+		return nil, false
+	}
+	managed, err := structured.Encode(format, structured.Extract(live, patch, arrays), stored)
+	if err != nil || Hash(managed) != entry.Hash {
+		return nil, false
+	}
+	updated, err := structured.Patch(format, data, structured.Unmerge(live, patch, arrays))
+	if err != nil {
+		return nil, false
+	}
+	return updated, true
+}
@@ -0,0 +1,91 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const scriptsFileName = "scripts.yaml"
+
+type ScriptRun struct {
+	Name   string    `yaml:"name"`
+	Hash   string    `yaml:"hash"`
+	Hashes []string  `yaml:"hashes,omitempty"`
+	RanAt  time.Time `yaml:"ran_at"`
+}
+
+func (r ScriptRun) Ran(hash string) bool {
+	return r.Hash == hash || slices.Contains(r.Hashes, hash)
+}
+
+type scriptsFile struct {
+	Home    string      `yaml:"home"`
+	Scripts []ScriptRun `yaml:"scripts"`
+}
+
+func scriptsPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, scriptsFileName), nil
+}
+
+func LoadScriptRuns(home string) (map[string]ScriptRun, error) {
+	path, err := scriptsPath()
+	if err != nil {
+		return nil, err
+	}
+	runs := map[string]ScriptRun{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return runs, nil
+		}
+		return nil, fmt.Errorf("read script state: %w", err)
+	}
+	var file scriptsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse script state: %w", err)
+	}
+	if file.Home != home {
+		return runs, nil
+	}
+	for _, run := range file.Scripts {
+		runs[run.Name] = run
+	}
+	return runs, nil
+}
+
+func SaveScriptRuns(home string, runs map[string]ScriptRun) error {
+	path, err := scriptsPath()
+	if err != nil {
+		return err
+	}
+	file := scriptsFile{Home: home, Scripts: make([]ScriptRun, 0, len(runs))}
+	for _, run := range runs {
+		file.Scripts = append(file.Scripts, run)
+	}
+	sort.Slice(file.Scripts, func(i, j int) bool {
+		return file.Scripts[i].Name < file.Scripts[j].Name
+	})
+	data, err := yaml.Marshal(&file)
+	if err != nil {
+		return fmt.Errorf("encode script state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write script state: %w", err)
+	}
+	return nil
+}
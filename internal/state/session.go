@@ -0,0 +1,239 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/subcode-labs/dots/internal/dotfile"
+)
+
+const (
+	sessionDirName  = "try"
+	sessionFileName = "session.yaml"
+	backupsDirName  = "backups"
+	bootIDPath      = "/proc/sys/kernel/random/boot_id"
+)
+
+type PriorKind string
+
+const (
+	PriorAbsent PriorKind = "absent"
+	PriorLink   PriorKind = "link"
+	PriorFile   PriorKind = "file"
+)
+
+type Prior struct {
+	Target string    `yaml:"target"`
+	Kind   PriorKind `yaml:"kind"`
+	Link   string    `yaml:"link,omitempty"`
+	Backup string    `yaml:"backup,omitempty"`
+}
+
+type Session struct {
+	Source    string    `yaml:"source"`
+	Revision  string    `yaml:"revision,omitempty"`
+	Tree      string    `yaml:"tree"`
+	Worktree  bool      `yaml:"worktree,omitempty"`
+	StartedAt time.Time `yaml:"started_at"`
+	BootID    string    `yaml:"boot_id,omitempty"`
+	Priors    []Prior   `yaml:"priors"`
+
+	dir string
+}
+
+func SessionDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sessionDirName), nil
+}
+
+func NewSession(source string) (*Session, error) {
+	dir, err := SessionDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, sessionFileName)); err == nil {
+		return nil, fmt.Errorf("a try session is already active, run 'dots try --end' first")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create session directory: %w", err)
+	}
+	return &Session{Source: source, StartedAt: time.Now().UTC(), BootID: bootID(), dir: dir}, nil
+}
+
+func LoadSession() (*Session, error) {
+	dir, err := SessionDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, sessionFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+	var session Session
+	if err := yaml.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("parse session: %w", err)
+	}
+	session.dir = dir
+	return &session, nil
+}
+
+func (s *Session) Dir() string {
+	return s.dir
+}
+
+func (s *Session) Save() error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, sessionFileName), data, 0o600); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	return nil
+}
+
+func (s *Session) SurvivedReboot() bool {
+	current := bootID()
+	return s.BootID != "" && current != "" && s.BootID != current
+}
+
+func (s *Session) Capture(target string) error {
+	return s.capture(target, false)
+}
+
+func (s *Session) CaptureCopy(target string) error {
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	return s.capture(target, true)
+}
+
+func (s *Session) capture(target string, keep bool) error {
+	for _, prior := range s.Priors {
+		if prior.Target == target {
+			return nil
+		}
+	}
+	prior := Prior{Target: target, Kind: PriorAbsent}
+	info, err := os.Lstat(target)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("stat target: %w", err)
+	case info.Mode()&os.ModeSymlink != 0:
+		if prior.Link, err = os.Readlink(target); err != nil {
+			return fmt.Errorf("read symlink: %w", err)
+		}
+		prior.Kind = PriorLink
+	case info.IsDir():
+		return fmt.Errorf("target %s is a directory", target)
+	default:
+		prior.Kind = PriorFile
+		prior.Backup = filepath.Join(backupsDirName, fmt.Sprintf("%d-%s", len(s.Priors), filepath.Base(target)))
+		backup := filepath.Join(s.dir, prior.Backup)
+		if err := os.MkdirAll(filepath.Dir(backup), 0o700); err != nil {
+			return fmt.Errorf("create backup directory: %w", err)
+		}
+		if keep {
+			err = dotfile.CopyFile(target, backup)
+		} else {
+			err = move(target, backup)
+		}
+		if err != nil {
+			return fmt.Errorf("back up %s: %w", target, err)
+		}
+	}
+	s.Priors = append(s.Priors, prior)
+	return s.Save()
+}
+
+func (s *Session) Restore() error {
+	var failed []string
+	var kept []Prior
+	for i := len(s.Priors) - 1; i >= 0; i-- {
+		if err := s.restore(s.Priors[i]); err != nil {
+			failed = append(failed, err.Error())
+			kept = append([]Prior{s.Priors[i]}, kept...)
+		}
+	}
+	s.Priors = kept
+	if len(failed) > 0 {
+		if err := s.Save(); err != nil {
+			return err
+		}
+		return fmt.Errorf("restore failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+var rename = os.Rename
+
+func move(src, dst string) error {
+	err := rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := dotfile.CopyFile(src, dst); err != nil {
+		return err
+	}
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (s *Session) restore(prior Prior) error {
+	if info, err := os.Lstat(prior.Target); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s is now a directory", prior.Target)
+		}
+		if err := os.Remove(prior.Target); err != nil {
+			return fmt.Errorf("remove %s: %w", prior.Target, err)
+		}
+	}
+	switch prior.Kind {
+	case PriorLink:
+		if err := os.Symlink(prior.Link, prior.Target); err != nil {
+			return fmt.Errorf("relink %s: %w", prior.Target, err)
+		}
+	case PriorFile:
+		if err := move(filepath.Join(s.dir, prior.Backup), prior.Target); err != nil {
+			return fmt.Errorf("restore %s: %w", prior.Target, err)
+		}
+	}
+	return nil
+}
+
+func (s *Session) Close() error {
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("remove session: %w", err)
+	}
+	return nil
+}
+
+func bootID() string {
+	data, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,21 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func Dir() (string, error) {
+	if dir := os.Getenv("DOTS_STATE"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "dots"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve state directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "dots"), nil
+}
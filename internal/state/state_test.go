@@ -0,0 +1,313 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	t.Setenv("DOTS_STATE", "")
+	t.Setenv("XDG_STATE_HOME", "/xdg/state")
+	if dir, err := Dir(); err != nil || dir != filepath.Join("/xdg/state", "dots") {
+		t.Errorf("Dir = %s, %v", dir, err)
+	}
+	t.Setenv("DOTS_STATE", "/custom")
+	if dir, err := Dir(); err != nil || dir != "/custom" {
+		t.Errorf("Dir with DOTS_STATE = %s, %v", dir, err)
+	}
+}
+
+func TestSessionRestoresPriorState(t *testing.T) {
+	t.Setenv("DOTS_STATE", t.TempDir())
+	home := t.TempDir()
+	file := filepath.Join(home, ".zshrc")
+	link := filepath.Join(home, ".vimrc")
+	absent := filepath.Join(home, ".inputrc")
+	if err := os.WriteFile(file, []byte("mine\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/vimrc", link); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewSession("feature")
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	for _, target := range []string{file, link, absent, file} {
+		if err := session.Capture(target); err != nil {
+			t.Fatalf("Capture(%s) failed: %v", target, err)
+		}
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte("trial\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewSession("other"); err == nil {
+		t.Error("NewSession should refuse a second session")
+	}
+
+	loaded, err := LoadSession()
+	if err != nil || loaded == nil {
+		t.Fatalf("LoadSession = %v, %v", loaded, err)
+	}
+	if len(loaded.Priors) != 3 || loaded.Source != "feature" {
+		t.Fatalf("session = %+v", loaded)
+	}
+	if err := loaded.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if err := loaded.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if data, err := os.ReadFile(file); err != nil || string(data) != "mine\n" {
+		t.Errorf("file = %q, %v", data, err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("file mode = %v, %v", info.Mode(), err)
+	}
+	if dest, err := os.Readlink(link); err != nil || dest != "/etc/vimrc" {
+		t.Errorf("link = %q, %v", dest, err)
+	}
+	if _, err := os.Lstat(absent); !os.IsNotExist(err) {
+		t.Errorf("absent target was left behind: %v", err)
+	}
+	if session, err := LoadSession(); err != nil || session != nil {
+		t.Errorf("session after Close = %v, %v", session, err)
+	}
+}
+
+func TestSessionKeepsFailedPriors(t *testing.T) {
+	t.Setenv("DOTS_STATE", t.TempDir())
+	home := t.TempDir()
+	a := filepath.Join(home, "a")
+	b := filepath.Join(home, "b")
+	for _, target := range []string{a, b} {
+		if err := os.WriteFile(target, []byte("mine "+filepath.Base(target)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session, err := NewSession("feature")
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	for _, target := range []string{a, b} {
+		if err := session.Capture(target); err != nil {
+			t.Fatalf("Capture(%s) failed: %v", target, err)
+		}
+	}
+	if err := os.Mkdir(b, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Restore(); err == nil {
+		t.Fatal("Restore should fail while b is a directory")
+	}
+	if data, err := os.ReadFile(a); err != nil || string(data) != "mine a" {
+		t.Errorf("a = %q, %v", data, err)
+	}
+
+	loaded, err := LoadSession()
+	if err != nil || loaded == nil {
+		t.Fatalf("LoadSession = %v, %v", loaded, err)
+	}
+	if len(loaded.Priors) != 1 || loaded.Priors[0].Target != b {
+		t.Fatalf("priors = %+v, want only b", loaded.Priors)
+	}
+	if err := os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if data, err := os.ReadFile(b); err != nil || string(data) != "mine b" {
+		t.Errorf("b = %q, %v", data, err)
+	}
+}
+
+func TestSessionMovesAcrossFilesystems(t *testing.T) {
+	t.Setenv("DOTS_STATE", t.TempDir())
+	rename = func(src, dst string) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { rename = os.Rename })
+	file := filepath.Join(t.TempDir(), ".zshrc")
+	if err := os.WriteFile(file, []byte("mine\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewSession("feature")
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	if err := session.Capture(file); err != nil {
+		t.Fatalf("Capture failed: %v", err)
+	}
+	if _, err := os.Lstat(file); !os.IsNotExist(err) {
+		t.Fatalf("target left in place after capture: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("trial\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "mine\n" {
+		t.Errorf("file = %q, %v", data, err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("file mode = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestSessionCaptureCopyLeavesTarget(t *testing.T) {
+	t.Setenv("DOTS_STATE", t.TempDir())
+	home := t.TempDir()
+	real := filepath.Join(home, "settings.json")
+	link := filepath.Join(home, ".bashrc")
+	if err := os.WriteFile(real, []byte("mine\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewSession("feature")
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	if err := session.CaptureCopy(link); err != nil {
+		t.Fatalf("CaptureCopy failed: %v", err)
+	}
+	if data, err := os.ReadFile(link); err != nil || string(data) != "mine\n" {
+		t.Fatalf("target after capture = %q, %v", data, err)
+	}
+	if err := os.WriteFile(link, []byte("mine\ntrial\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if dest, err := os.Readlink(link); err != nil || dest != real {
+		t.Errorf("link = %q, %v", dest, err)
+	}
+	if data, err := os.ReadFile(real); err != nil || string(data) != "mine\n" {
+		t.Errorf("file = %q, %v", data, err)
+	}
+	if info, err := os.Stat(real); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestAppliedRoundTrip(t *testing.T) {
+	t.Setenv("DOTS_STATE", t.TempDir())
+	entries := map[string]Applied{
+		"/home/a/.zshrc": {Target: "/home/a/.zshrc", Source: "/home/a/.dots/.zshrc", Mode: ModeLink, Hash: Hash([]byte("x"))},
+	}
+	if err := SaveApplied("/home/a", entries); err != nil {
+		t.Fatalf("SaveApplied failed: %v", err)
+	}
+	loaded, err := LoadApplied("/home/a")
+	if err != nil || loaded["/home/a/.zshrc"].Hash != entries["/home/a/.zshrc"].Hash {
+		t.Fatalf("LoadApplied = %v, %v", loaded, err)
+	}
+	if other, err := LoadApplied("/home/b"); err != nil || len(other) != 0 {
+		t.Errorf("state leaked to another home: %v, %v", other, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	home := t.TempDir()
+	source := filepath.Join(home, ".dots", ".vimrc")
+	target := filepath.Join(home, ".vimrc")
+	if err := os.Symlink(source, target); err != nil {
+		t.Fatal(err)
+	}
+	entry := Applied{Target: target, Source: source, Mode: ModeLink}
+
+	result, err := Prune(entry, func() ([]byte, bool) { return []byte("set number\n"), true })
+	if err != nil || result != PruneRestored {
+		t.Fatalf("Prune = %s, %v", result, err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "set number\n" {
+		t.Errorf("restored content = %q, %v", data, err)
+	}
+
+	if result, err := Prune(entry, func() ([]byte, bool) { return nil, false }); err != nil || result != PruneKept {
+		t.Errorf("Prune of a regular file = %s, %v", result, err)
+	}
+
+	if err := os.Remove(target); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(source, target); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := Prune(entry, func() ([]byte, bool) { return nil, false }); err != nil || result != PruneUnlinked {
+		t.Errorf("Prune without content = %s, %v", result, err)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("stale link left behind: %v", err)
+	}
+
+	if err := os.WriteFile(target, []byte("rendered\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	copied := Applied{Target: target, Source: source, Mode: ModeCopy, Hash: Hash([]byte("rendered\n"))}
+	if err := os.WriteFile(target, []byte("edited\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := Prune(copied, func() ([]byte, bool) { return nil, false }); err != nil || result != PruneKept {
+		t.Errorf("Prune of an edited copy = %s, %v", result, err)
+	}
+	if err := os.WriteFile(target, []byte("rendered\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := Prune(copied, func() ([]byte, bool) { return nil, false }); err != nil || result != PruneRemoved {
+		t.Errorf("Prune of an unchanged copy = %s, %v", result, err)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("unchanged copy left behind: %v", err)
+	}
+}
+
+func TestPrunePartialEntries(t *testing.T) {
+	home := t.TempDir()
+	bashrc := filepath.Join(home, ".bashrc")
+	settings := filepath.Join(home, "settings.json")
+	if err := os.WriteFile(bashrc, []byte("export A=1\n# BEGIN dots:team\nalias ll=ls\n# END dots:team\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(settings, []byte("{\n  // app\n  \"zoom\": 1,\n  \"theme\": \"dark\"\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stored := []byte(`{"theme": "dark"}`)
+	tests := []struct {
+		entry Applied
+		want  string
+	}{
+		{Applied{Target: bashrc, Mode: ModeCopy, Block: "team", Hash: Hash([]byte("alias ll=ls\n"))}, "export A=1\n"},
+		{Applied{Target: settings, Mode: ModeCopy, Merge: true, Hash: Hash([]byte("{\n  \"theme\": \"dark\"\n}\n"))}, "{\n  // app\n  \"zoom\": 1\n}\n"},
+	}
+	for _, tt := range tests {
+		edited := tt.entry
+		edited.Hash = Hash([]byte("something else"))
+		if result, err := Prune(edited, func() ([]byte, bool) { return stored, true }); err != nil || result != PruneKept {
+			t.Errorf("Prune of edited %s = %s, %v", tt.entry.Target, result, err)
+		}
+		if result, err := Prune(tt.entry, func() ([]byte, bool) { return stored, true }); err != nil || result != PruneDetached {
+			t.Errorf("Prune of %s = %s, %v", tt.entry.Target, result, err)
+		}
+		if data, err := os.ReadFile(tt.entry.Target); err != nil || string(data) != tt.want {
+			t.Errorf("%s after prune = %q, %v", tt.entry.Target, data, err)
+		}
+	}
+	if info, err := os.Stat(bashrc); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("mode after prune = %v, %v", info.Mode(), err)
+	}
+}
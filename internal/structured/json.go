@@ -0,0 +1,216 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func decodeJSON(data []byte) (*Object, error) {
+	decoder := json.NewDecoder(bytes.NewReader(stripJSONComments(data)))
+	decoder.UseNumber()
+	value, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("parse JSON: %w", err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse JSON: unexpected content after the document")
+	}
+	doc, ok := value.(*Object)
+	if !ok {
+		return nil, fmt.Errorf("parse JSON: top level is not an object")
+	}
+	return doc, nil
+}
+
+func decodeJSONValue(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		switch token {
+		case '{':
+			doc := NewObject()
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				doc.Set(key.(string), value)
+			}
+			_, err := decoder.Token()
+			return doc, err
+		case '[':
+			items := []any{}
+			for decoder.More() {
+				item, err := decodeJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			_, err := decoder.Token()
+			return items, err
+		}
+		return nil, fmt.Errorf("unexpected %v", token)
+	}
+	return token, nil
+}
+
+func stripJSONComments(data []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out.WriteByte(data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			out.WriteByte('\n')
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+			out.WriteByte(' ')
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return stripTrailingCommas(out.Bytes())
+}
+
+func stripTrailingCommas(data []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out.WriteByte(data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == ',':
+			j := i + 1
+			for j < len(data) && strings.ContainsRune(" \t\r\n", rune(data[j])) {
+				j++
+			}
+			if j < len(data) && (data[j] == '}' || data[j] == ']') {
+				continue
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+func encodeJSON(doc *Object, indent string) ([]byte, error) {
+	var out bytes.Buffer
+	if err := writeJSON(&out, doc, indent, ""); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+func writeJSON(out *bytes.Buffer, value any, indent, prefix string) error {
+	inner := prefix + indent
+	switch value := value.(type) {
+	case *Object:
+		if value.Len() == 0 {
+			out.WriteString("{}")
+			return nil
+		}
+		out.WriteString("{\n")
+		for i, key := range value.keys {
+			out.WriteString(inner)
+			writeJSONString(out, key)
+			out.WriteString(": ")
+			if err := writeJSON(out, value.values[key], indent, inner); err != nil {
+				return err
+			}
+			if i < value.Len()-1 {
+				out.WriteByte(',')
+			}
+			out.WriteByte('\n')
+		}
+		out.WriteString(prefix + "}")
+	case []any:
+		if len(value) == 0 {
+			out.WriteString("[]")
+			return nil
+		}
+		out.WriteString("[\n")
+		for i, item := range value {
+			out.WriteString(inner)
+			if err := writeJSON(out, item, indent, inner); err != nil {
+				return err
+			}
+			if i < len(value)-1 {
+				out.WriteByte(',')
+			}
+			out.WriteByte('\n')
+		}
+		out.WriteString(prefix + "]")
+	case string:
+		writeJSONString(out, value)
+	case Datetime:
+		writeJSONString(out, string(value))
+	case json.Number:
+		out.WriteString(value.String())
+	case int:
+		out.WriteString(strconv.Itoa(value))
+	case int64:
+		out.WriteString(strconv.FormatInt(value, 10))
+	case float64:
+		out.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	case bool:
+		out.WriteString(strconv.FormatBool(value))
+	case nil:
+		out.WriteString("null")
+	default:
+		return fmt.Errorf("cannot encode %T as JSON", value)
+	}
+	return nil
+}
+
+func writeJSONString(out *bytes.Buffer, value string) {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	out.Write(bytes.TrimRight(encoded.Bytes(), "\n"))
+}
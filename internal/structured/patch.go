@@ -0,0 +1,329 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrComments = errors.New("merging would drop its comments, remove them from the file first")
+
+func Patch(format Format, current []byte, want *Object) ([]byte, error) {
+	if strings.TrimSpace(string(current)) == "" {
+		return Encode(format, want, current)
+	}
+	live, err := Decode(format, current)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case JSON:
+		return patchJSON(current, live, want)
+	case YAML:
+		return patchYAML(current, live, want)
+	case TOML:
+		return patchTOML(current, want)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+type jsonMember struct {
+	key        string
+	keyStart   int
+	start, end int
+}
+
+func patchJSON(data []byte, live, want *Object) ([]byte, error) {
+	scan := &jsonScanner{data: data}
+	scan.skip()
+	var edits []textEdit
+	if err := scan.patch(live, want, detectIndent(data), "", &edits); err != nil {
+		return nil, fmt.Errorf("parse JSON: %w", err)
+	}
+	return applyEdits(data, edits), nil
+}
+
+func applyEdits(data []byte, edits []textEdit) []byte {
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start > edits[j].start
+		}
+		return edits[i].end > edits[j].end
+	})
+	out := append([]byte(nil), data...)
+	for _, edit := range edits {
+		out = append(out[:edit.start], append([]byte(edit.text), out[edit.end:]...)...)
+	}
+	return out
+}
+
+type jsonScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *jsonScanner) patch(live, want *Object, unit, prefix string, edits *[]textEdit) error {
+	open := s.pos
+	members, closing, err := s.object()
+	if err != nil {
+		return err
+	}
+	indent := prefix + unit
+	if len(members) > 0 {
+		indent = s.lineIndent(members[0].keyStart, indent)
+	}
+	spans := map[string]jsonMember{}
+	var removed []textEdit
+	last := -1
+	for i, member := range members {
+		spans[member.key] = member
+		if _, ok := want.values[member.key]; ok {
+			last = i
+		} else {
+			removed = append(removed, s.removal(member))
+		}
+	}
+	var added bytes.Buffer
+	for _, key := range want.keys {
+		value := want.values[key]
+		have, ok := live.values[key]
+		if ok && Equal(have, value) {
+			continue
+		}
+		if ok {
+			member := spans[key]
+			haveObject, haveIsObject := have.(*Object)
+			wantObject, wantIsObject := value.(*Object)
+			if haveIsObject && wantIsObject {
+				nested := &jsonScanner{data: s.data, pos: member.start}
+				if err := nested.patch(haveObject, wantObject, unit, indent, edits); err != nil {
+					return err
+				}
+				continue
+			}
+			var text bytes.Buffer
+			if err := writeJSON(&text, value, unit, indent); err != nil {
+				return err
+			}
+			*edits = append(*edits, textEdit{start: member.start, end: member.end, text: text.String()})
+			continue
+		}
+		if last >= 0 || added.Len() > 0 {
+			added.WriteByte(',')
+		}
+		added.WriteString("\n" + indent)
+		writeJSONString(&added, key)
+		added.WriteString(": ")
+		if err := writeJSON(&added, value, unit, indent); err != nil {
+			return err
+		}
+	}
+	if last < 0 {
+		if added.Len() > 0 {
+			added.WriteString("\n" + s.lineIndent(open, prefix))
+		}
+		if added.Len() > 0 || len(removed) > 0 {
+			*edits = append(*edits, textEdit{start: open + 1, end: closing, text: added.String()})
+		}
+		return nil
+	}
+	*edits = append(*edits, removed...)
+	end := members[last].end
+	if last < len(members)-1 && s.commaAfter(members[len(members)-1].end) < 0 {
+		if comma := s.commaAfter(end); comma >= 0 {
+			*edits = append(*edits, textEdit{start: comma, end: comma + 1})
+		}
+	}
+	if added.Len() > 0 {
+		*edits = append(*edits, textEdit{start: end, end: end, text: added.String()})
+	}
+	return nil
+}
+
+func (s *jsonScanner) removal(member jsonMember) textEdit {
+	lineStart := bytes.LastIndexByte(s.data[:member.keyStart], '\n') + 1
+	ownLine := len(bytes.TrimLeft(s.data[lineStart:member.keyStart], " \t")) == 0
+	edit := textEdit{start: member.keyStart, end: s.skipSpaces(member.end)}
+	if edit.end < len(s.data) && s.data[edit.end] == ',' {
+		edit.end++
+	}
+	if !ownLine {
+		return edit
+	}
+	edit.start = lineStart
+	rest := s.skipSpaces(edit.end)
+	if bytes.HasPrefix(s.data[rest:], []byte("//")) {
+		for rest < len(s.data) && s.data[rest] != '\n' {
+			rest++
+		}
+	}
+	if rest < len(s.data) && s.data[rest] == '\r' {
+		rest++
+	}
+	if rest < len(s.data) && s.data[rest] == '\n' {
+		edit.end = rest + 1
+	}
+	return edit
+}
+
+func (s *jsonScanner) skipSpaces(pos int) int {
+	for pos < len(s.data) && (s.data[pos] == ' ' || s.data[pos] == '\t') {
+		pos++
+	}
+	return pos
+}
+
+func (s *jsonScanner) commaAfter(pos int) int {
+	scan := &jsonScanner{data: s.data, pos: pos}
+	scan.skip()
+	if scan.peek() == ',' {
+		return scan.pos
+	}
+	return -1
+}
+
+func (s *jsonScanner) lineIndent(pos int, fallback string) string {
+	start := bytes.LastIndexByte(s.data[:pos], '\n') + 1
+	indent := s.data[start:pos]
+	if len(bytes.TrimLeft(indent, " \t")) > 0 {
+		return fallback
+	}
+	return string(indent)
+}
+
+func (s *jsonScanner) object() ([]jsonMember, int, error) {
+	if s.peek() != '{' {
+		return nil, 0, fmt.Errorf("expected object at offset %d", s.pos)
+	}
+	s.pos++
+	var members []jsonMember
+	for {
+		s.skip()
+		switch s.peek() {
+		case '}':
+			closing := s.pos
+			s.pos++
+			return members, closing, nil
+		case ',':
+			s.pos++
+			continue
+		case '"':
+		default:
+			return nil, 0, fmt.Errorf("expected key at offset %d", s.pos)
+		}
+		keyStart := s.pos
+		if err := s.skipString(); err != nil {
+			return nil, 0, err
+		}
+		var key string
+		if err := json.Unmarshal(s.data[keyStart:s.pos], &key); err != nil {
+			return nil, 0, err
+		}
+		s.skip()
+		if s.peek() != ':' {
+			return nil, 0, fmt.Errorf("expected : at offset %d", s.pos)
+		}
+		s.pos++
+		s.skip()
+		start := s.pos
+		if err := s.skipValue(); err != nil {
+			return nil, 0, err
+		}
+		members = append(members, jsonMember{key: key, keyStart: keyStart, start: start, end: s.pos})
+	}
+}
+
+func (s *jsonScanner) peek() byte {
+	if s.pos < len(s.data) {
+		return s.data[s.pos]
+	}
+	return 0
+}
+
+func (s *jsonScanner) skip() {
+	for s.pos < len(s.data) {
+		switch {
+		case strings.IndexByte(" \t\r\n", s.data[s.pos]) >= 0:
+			s.pos++
+		case bytes.HasPrefix(s.data[s.pos:], []byte("//")):
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' {
+				s.pos++
+			}
+		case bytes.HasPrefix(s.data[s.pos:], []byte("/*")):
+			end := bytes.Index(s.data[s.pos+2:], []byte("*/"))
+			if end < 0 {
+				s.pos = len(s.data)
+			} else {
+				s.pos += end + 4
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *jsonScanner) skipString() error {
+	for s.pos++; s.pos < len(s.data); s.pos++ {
+		switch s.data[s.pos] {
+		case '\\':
+			s.pos++
+		case '"':
+			s.pos++
+			return nil
+		}
+	}
+	return fmt.Errorf("unterminated string")
+}
+
+func (s *jsonScanner) skipValue() error {
+	switch s.peek() {
+	case '"':
+		return s.skipString()
+	case '{', '[':
+		depth := 0
+		for s.pos < len(s.data) {
+			switch s.data[s.pos] {
+			case '"':
+				if err := s.skipString(); err != nil {
+					return err
+				}
+				continue
+			case '/':
+				before := s.pos
+				s.skip()
+				if s.pos > before {
+					continue
+				}
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					s.pos++
+					return nil
+				}
+			}
+			s.pos++
+		}
+		return fmt.Errorf("unterminated value")
+	}
+	start := s.pos
+	for s.pos < len(s.data) && strings.IndexByte(",}] \t\r\n/", s.data[s.pos]) < 0 {
+		s.pos++
+	}
+	if s.pos == start {
+		return fmt.Errorf("expected value at offset %d", s.pos)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package structured
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+	TOML Format = "toml"
+)
+
+type Arrays string
+
+const (
+	ArraysReplace Arrays = "replace"
+	ArraysUnion   Arrays = "union"
+)
+
+func ParseArrays(value string) (Arrays, error) {
+	switch Arrays(value) {
+	case "", ArraysReplace:
+		return ArraysReplace, nil
+	case ArraysUnion:
+		return ArraysUnion, nil
+	}
+	return "", fmt.Errorf("unknown array strategy %q, use replace or union", value)
+}
+
+func FormatFor(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonc", ".code-workspace":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".toml":
+		return TOML, nil
+	}
+	return "", fmt.Errorf("cannot merge %s, only .json, .yaml, .yml and .toml files are supported", filepath.Base(path))
+}
+
+type Object struct {
+	keys   []string
+	values map[string]any
+}
+
+func NewObject() *Object {
+	return &Object{values: map[string]any{}}
+}
+
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+func (o *Object) Get(key string) (any, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+func (o *Object) Set(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *Object) Delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, candidate := range o.keys {
+		if candidate == key {
+			o.keys = append(o.keys[:i:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func Decode(format Format, data []byte) (*Object, error) {
+	if strings.TrimSpace(string(data)) == "" {
+		return NewObject(), nil
+	}
+	switch format {
+	case JSON:
+		return decodeJSON(data)
+	case YAML:
+		return decodeYAML(data)
+	case TOML:
+		return decodeTOML(data)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func Encode(format Format, doc *Object, like []byte) ([]byte, error) {
+	switch format {
+	case JSON:
+		return encodeJSON(doc, detectIndent(like))
+	case YAML:
+		return encodeYAML(doc)
+	case TOML:
+		return encodeTOML(doc)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func Merge(target, patch *Object, arrays Arrays) *Object {
+	merged := copyValue(target).(*Object)
+	for _, key := range patch.keys {
+		want := patch.values[key]
+		have, ok := merged.values[key]
+		if !ok {
+			merged.Set(key, copyValue(want))
+			continue
+		}
+		haveObject, haveIsObject := have.(*Object)
+		wantObject, wantIsObject := want.(*Object)
+		haveList, haveIsList := have.([]any)
+		wantList, wantIsList := want.([]any)
+		switch {
+		case haveIsObject && wantIsObject:
+			merged.Set(key, Merge(haveObject, wantObject, arrays))
+		case haveIsList && wantIsList && arrays == ArraysUnion:
+			union := copyValue(haveList).([]any)
+			for _, item := range wantList {
+				if !contains(union, item) {
+					union = append(union, copyValue(item))
+				}
+			}
+			merged.Set(key, union)
+		default:
+			merged.Set(key, copyValue(want))
+		}
+	}
+	return merged
+}
+
+func Unmerge(target, patch *Object, arrays Arrays) *Object {
+	remaining := copyValue(target).(*Object)
+	for _, key := range patch.keys {
+		have, ok := remaining.values[key]
+		if !ok {
+			continue
+		}
+		want := patch.values[key]
+		haveObject, haveIsObject := have.(*Object)
+		wantObject, wantIsObject := want.(*Object)
+		haveList, haveIsList := have.([]any)
+		wantList, wantIsList := want.([]any)
+		switch {
+		case haveIsObject && wantIsObject:
+			nested := Unmerge(haveObject, wantObject, arrays)
+			if nested.Len() == 0 {
+				remaining.Delete(key)
+			} else {
+				remaining.Set(key, nested)
+			}
+		case haveIsList && wantIsList && arrays == ArraysUnion:
+			kept := []any{}
+			for _, item := range haveList {
+				if !contains(wantList, item) {
+					kept = append(kept, item)
+				}
+			}
+			remaining.Set(key, kept)
+		default:
+			remaining.Delete(key)
+		}
+	}
+	return remaining
+}
+
+func Extract(live, patch *Object, arrays Arrays) *Object {
+	managed := NewObject()
+	for _, key := range patch.keys {
+		have, ok := live.values[key]
+		if !ok {
+			continue
+		}
+		want := patch.values[key]
+		haveObject, haveIsObject := have.(*Object)
+		wantObject, wantIsObject := want.(*Object)
+		haveList, haveIsList := have.([]any)
+		wantList, wantIsList := want.([]any)
+		switch {
+		case haveIsObject && wantIsObject:
+			managed.Set(key, Extract(haveObject, wantObject, arrays))
+		case haveIsList && wantIsList && arrays == ArraysUnion:
+			present := []any{}
+			for _, item := range wantList {
+				if contains(haveList, item) {
+					present = append(present, copyValue(item))
+				}
+			}
+			managed.Set(key, present)
+		default:
+			managed.Set(key, copyValue(have))
+		}
+	}
+	return managed
+}
+
+func Equal(a, b any) bool {
+	switch a := a.(type) {
+	case *Object:
+		b, ok := b.(*Object)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for _, key := range a.keys {
+			value, ok := b.values[key]
+			if !ok || !Equal(a.values[key], value) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !Equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func contains(items []any, item any) bool {
+	for _, candidate := range items {
+		if Equal(candidate, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyValue(value any) any {
+	switch value := value.(type) {
+	case *Object:
+		copied := NewObject()
+		for _, key := range value.keys {
+			copied.Set(key, copyValue(value.values[key]))
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for i, item := range value {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	}
+	return value
+}
+
+func detectIndent(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
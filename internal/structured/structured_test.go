@@ -0,0 +1,294 @@
+package structured
+
+import (
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, format Format, data string) *Object {
+	t.Helper()
+	doc, err := Decode(format, []byte(data))
+	if err != nil {
+		t.Fatalf("Decode(%s) failed: %v", format, err)
+	}
+	return doc
+}
+
+func encode(t *testing.T, format Format, doc *Object, like string) string {
+	t.Helper()
+	data, err := Encode(format, doc, []byte(like))
+	if err != nil {
+		t.Fatalf("Encode(%s) failed: %v", format, err)
+	}
+	return string(data)
+}
+
+func TestJSONMergeKeepsUnmanagedKeys(t *testing.T) {
+	live := `{
+    // written by the editor
+    "window.zoomLevel": 1,
+    "editor": {"fontSize": 12, "tabSize": 8},
+    "files.exclude": ["node_modules"],
+}`
+	patch := `{"editor": {"tabSize": 2}, "files.exclude": ["dist"], "theme": "dark"}`
+	target, stored := decode(t, JSON, live), decode(t, JSON, patch)
+
+	merged := Merge(target, stored, ArraysReplace)
+	want := `{
+    "window.zoomLevel": 1,
+    "editor": {
+        "fontSize": 12,
+        "tabSize": 2
+    },
+    "files.exclude": [
+        "dist"
+    ],
+    "theme": "dark"
+}
+`
+	if got := encode(t, JSON, merged, live); got != want {
+		t.Errorf("merged =\n%s\nwant\n%s", got, want)
+	}
+	if !Equal(Extract(merged, stored, ArraysReplace), stored) {
+		t.Error("managed keys differ after merge")
+	}
+
+	union := Merge(target, stored, ArraysUnion)
+	list, _ := union.Get("files.exclude")
+	if len(list.([]any)) != 2 {
+		t.Errorf("union = %v", list)
+	}
+	if !Equal(Extract(union, stored, ArraysUnion), stored) {
+		t.Error("managed keys differ after union merge")
+	}
+	if again := Merge(union, stored, ArraysUnion); !Equal(again, union) {
+		t.Error("union merge is not idempotent")
+	}
+}
+
+func TestExtractReportsManagedDivergence(t *testing.T) {
+	stored := decode(t, YAML, "editor:\n  tabSize: 2\ntheme: dark\n")
+	live := decode(t, YAML, "theme: light\nzoom: 3\neditor:\n  tabSize: 2\n  font: mono\n")
+	managed := Extract(live, stored, ArraysReplace)
+	if got := encode(t, YAML, managed, ""); got != "editor:\n  tabSize: 2\ntheme: light\n" {
+		t.Errorf("managed = %q", got)
+	}
+	if Equal(managed, stored) {
+		t.Error("divergent managed key reported equal")
+	}
+	live.Set("theme", "dark")
+	if !Equal(Extract(live, stored, ArraysReplace), stored) {
+		t.Error("edits to unmanaged keys reported as divergence")
+	}
+}
+
+func TestYAMLPreservesOrderAndTypes(t *testing.T) {
+	source := "b: 1\na:\n  - x\n  - 2.5\nc: true\nd: null\ne: \"007\"\nf: 2024-01-02\n"
+	if got := encode(t, YAML, decode(t, YAML, source), ""); got != source {
+		t.Errorf("round trip =\n%s\nwant\n%s", got, source)
+	}
+}
+
+func TestTOMLRoundTrip(t *testing.T) {
+	source := `# comment
+title = "dots"
+count = 1_000
+ratio = 0.5
+enabled = true
+when = 1979-05-27T07:32:00Z
+list = [
+  1,
+  2, # two
+]
+inline = { name = "x", nested = { deep = 'lit' } }
+multi = """
+line one
+line two"""
+
+[server]
+host = "localhost"
+"quoted key" = "v"
+
+[server.tls]
+cert = 'C:\certs\a.pem'
+
+[[plugins]]
+name = "a"
+
+[[plugins]]
+name = "b"
+options.verbose = true
+`
+	doc := decode(t, TOML, source)
+	want := `title = "dots"
+count = 1000
+ratio = 0.5
+enabled = true
+when = 1979-05-27T07:32:00Z
+list = [1, 2]
+multi = "line one\nline two"
+
+[inline]
+name = "x"
+
+[inline.nested]
+deep = "lit"
+
+[server]
+host = "localhost"
+"quoted key" = "v"
+
+[server.tls]
+cert = "C:\\certs\\a.pem"
+
+[[plugins]]
+name = "a"
+
+[[plugins]]
+name = "b"
+
+[plugins.options]
+verbose = true
+`
+	got := encode(t, TOML, doc, "")
+	if got != want {
+		t.Errorf("encoded =\n%s\nwant\n%s", got, want)
+	}
+	if again := decode(t, TOML, got); !Equal(again, doc) {
+		t.Error("re-decoded document differs")
+	}
+}
+
+func TestJSONCommentBeforeClosingBrace(t *testing.T) {
+	source := "{\n  \"a\": [1, /* last */],\n  \"b\": \"//, not a comment\", // note\n}\n"
+	doc := decode(t, JSON, source)
+	if got := encode(t, JSON, doc, source); got != "{\n  \"a\": [\n    1\n  ],\n  \"b\": \"//, not a comment\"\n}\n" {
+		t.Errorf("decoded = %q", got)
+	}
+}
+
+func TestPatchKeepsComments(t *testing.T) {
+	tests := []struct {
+		format  Format
+		current string
+		patch   string
+		want    string
+	}{
+		{
+			JSON,
+			"{\n  // font\n  \"editor\": {\"fontSize\": 12, /* keep */ \"tabSize\": 8},\n  \"zoom\": 1, // note\n}\n",
+			`{"editor": {"tabSize": 2}, "theme": "dark", "empty": {}}`,
+			"{\n  // font\n  \"editor\": {\"fontSize\": 12, /* keep */ \"tabSize\": 2},\n  \"zoom\": 1,\n  \"theme\": \"dark\",\n  \"empty\": {}, // note\n}\n",
+		},
+		{
+			JSON,
+			"{\n\t\"nested\": {}\n}",
+			`{"nested": {"a": [1]}}`,
+			"{\n\t\"nested\": {\n\t\t\"a\": [\n\t\t\t1\n\t\t]\n\t}\n}",
+		},
+		{
+			YAML,
+			"# editor settings\neditor:\n  tabSize: 8 # too wide\n  font: mono\n",
+			"editor:\n  tabSize: 2\ntheme: dark\n",
+			"# editor settings\neditor:\n  tabSize: 2 # too wide\n  font: mono\ntheme: dark\n",
+		},
+		{
+			TOML,
+			"# owned by the app\ntheme = \"light\"\npath = 'C:\\tmp'\npoint = { x = 1, y = 2 }\nmotd = \"\"\"\nhello\n\"\"\"\n\n[editor]\ntab = 8 # too wide\nfont = \"mono\"\n",
+			"theme = \"dark\"\n[editor]\ntab = 2\nsize = 12\n[new]\na = 1\n",
+			"# owned by the app\ntheme = \"dark\"\npath = 'C:\\tmp'\npoint = { x = 1, y = 2 }\nmotd = \"\"\"\nhello\n\"\"\"\n\n[editor]\ntab = 2 # too wide\nfont = \"mono\"\nsize = 12\n\n[new]\na = 1\n",
+		},
+	}
+	for _, tt := range tests {
+		current := decode(t, tt.format, tt.current)
+		merged := Merge(current, decode(t, tt.format, tt.patch), ArraysReplace)
+		got, err := Patch(tt.format, []byte(tt.current), merged)
+		if err != nil {
+			t.Errorf("Patch(%s) failed: %v", tt.format, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Patch(%s) =\n%s\nwant\n%s", tt.format, got, tt.want)
+		}
+		if !Equal(decode(t, tt.format, string(got)), merged) {
+			t.Errorf("Patch(%s) does not decode to the merged document", tt.format)
+		}
+	}
+
+	current := "a.b = 1\na.c = 2\n\n[[srv]]\nname = \"x\"\n\n[[srv]]\nname = \"y\"\n"
+	want := "a.b = 1\na.d = 3\n\n[[srv]]\nname = \"x\"\nport = 1\n"
+	got, err := Patch(TOML, []byte(current), decode(t, TOML, "a = { b = 1, d = 3 }\nsrv = [{ name = \"x\", port = 1 }]\n"))
+	if err != nil || string(got) != want {
+		t.Errorf("Patch(toml) = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestUnmergeRemovesManagedKeys(t *testing.T) {
+	tests := []struct {
+		format  Format
+		current string
+		patch   string
+		want    string
+	}{
+		{
+			JSON,
+			"{\n  // zoom\n  \"zoom\": 1, // app\n  \"theme\": \"dark\", // ours\n  \"editor\": {\"tabSize\": 2},\n  \"files\": [\"a\", \"dist\"]\n}\n",
+			`{"theme": "dark", "editor": {"tabSize": 2}, "files": ["dist"]}`,
+			"{\n  // zoom\n  \"zoom\": 1, // app\n  \"files\": [\n    \"a\"\n  ]\n}\n",
+		},
+		{
+			JSON,
+			"{\n  \"zoom\": 1,\n  \"theme\": \"dark\"\n}\n",
+			`{"theme": "dark"}`,
+			"{\n  \"zoom\": 1\n}\n",
+		},
+		{
+			JSON,
+			`{"theme": "dark"}`,
+			`{"theme": "dark"}`,
+			`{}`,
+		},
+		{
+			YAML,
+			"# app settings\nzoom: 1 # app\ntheme: dark\neditor:\n  tabSize: 2\n",
+			"theme: dark\neditor:\n  tabSize: 2\n",
+			"# app settings\nzoom: 1 # app\n",
+		},
+	}
+	for _, tt := range tests {
+		current := decode(t, tt.format, tt.current)
+		remaining := Unmerge(current, decode(t, tt.format, tt.patch), ArraysUnion)
+		got, err := Patch(tt.format, []byte(tt.current), remaining)
+		if err != nil {
+			t.Errorf("Patch(%s) failed: %v", tt.format, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Patch(%s) =\n%s\nwant\n%s", tt.format, got, tt.want)
+		}
+		if !Equal(decode(t, tt.format, string(got)), remaining) {
+			t.Errorf("Patch(%s) does not decode to the remaining document", tt.format)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for format, data := range map[Format]string{
+		JSON: `["not", "an", "object"]`,
+		YAML: "- a\n- b\n",
+		TOML: "a = 1\na = 2\n",
+	} {
+		if _, err := Decode(format, []byte(data)); err == nil {
+			t.Errorf("Decode(%s, %q) succeeded", format, data)
+		}
+	}
+	if _, err := Decode(TOML, []byte("a = \"unterminated\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("unterminated string error = %v", err)
+	}
+	if _, err := FormatFor("/home/me/.bashrc"); err == nil {
+		t.Error("FormatFor accepted a shell file")
+	}
+	if _, err := ParseArrays("append"); err == nil {
+		t.Error("ParseArrays accepted append")
+	}
+}
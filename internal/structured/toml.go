@@ -0,0 +1,971 @@
+package structured
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Datetime string
+
+var (
+	bareKey     = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	datePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+)
+
+type tomlParser struct {
+	data   []byte
+	pos    int
+	line   int
+	root   *Object
+	table  *Object
+	arrays map[*Object]map[string]bool
+	layout *tomlLayout
+}
+
+type tomlLayout struct {
+	sections   []tomlSection
+	statements []tomlStatement
+	parent     map[*Object]*Object
+	name       map[*Object]string
+	dotted     map[*Object]bool
+}
+
+type tomlSection struct {
+	table            *Object
+	start, body, end int
+}
+
+type tomlStatement struct {
+	table                *Object
+	key                  string
+	start, end           int
+	valueStart, valueEnd int
+}
+
+func decodeTOML(data []byte) (*Object, error) {
+	p := &tomlParser{data: data, line: 1, root: NewObject(), arrays: map[*Object]map[string]bool{}}
+	p.table = p.root
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("parse TOML: line %d: %w", p.line, err)
+	}
+	return p.root, nil
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.data) {
+			return nil
+		}
+		start := bytes.LastIndexByte(p.data[:p.pos], '\n') + 1
+		var statement tomlStatement
+		var err error
+		switch {
+		case p.hasPrefix("[["):
+			err = p.arrayTable()
+		case p.peek() == '[':
+			err = p.tableHeader()
+		default:
+			statement, err = p.keyValue(p.table)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+		if p.layout == nil {
+			continue
+		}
+		if statement.table == nil {
+			p.layout.sections = append(p.layout.sections, tomlSection{table: p.table, start: start, body: p.pos, end: p.pos})
+			continue
+		}
+		statement.start, statement.end = start, p.pos
+		p.layout.statements = append(p.layout.statements, statement)
+		if n := len(p.layout.sections); n > 0 {
+			p.layout.sections[n-1].end = p.pos
+		}
+	}
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.data) {
+		return p.data[p.pos]
+	}
+	return 0
+}
+
+func (p *tomlParser) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(p.data[p.pos:], []byte(prefix))
+}
+
+func (p *tomlParser) advance(n int) {
+	for i := 0; i < n && p.pos < len(p.data); i++ {
+		if p.data[p.pos] == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) skipSpace() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	if p.peek() == '#' {
+		for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) skipBlank() {
+	for p.pos < len(p.data) {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.advance(1)
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	p.skipComment()
+	if p.peek() == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.peek() != '\n' {
+		return fmt.Errorf("unexpected %q", p.peek())
+	}
+	p.advance(1)
+	return nil
+}
+
+func (p *tomlParser) tableHeader() error {
+	p.advance(1)
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if p.peek() != ']' {
+		return fmt.Errorf("expected ] after table name")
+	}
+	p.advance(1)
+	table, err := p.descend(p.root, keys, false)
+	if err != nil {
+		return err
+	}
+	p.table = table
+	return nil
+}
+
+func (p *tomlParser) arrayTable() error {
+	p.advance(2)
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if !p.hasPrefix("]]") {
+		return fmt.Errorf("expected ]] after array table name")
+	}
+	p.advance(2)
+	parent, err := p.descend(p.root, keys[:len(keys)-1], false)
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	table := NewObject()
+	p.created(table, parent, last, false)
+	switch existing, ok := parent.Get(last); {
+	case !ok:
+		parent.Set(last, []any{table})
+	case p.arrays[parent][last]:
+		parent.Set(last, append(existing.([]any), table))
+	default:
+		return fmt.Errorf("%s is already defined", strings.Join(keys, "."))
+	}
+	if p.arrays[parent] == nil {
+		p.arrays[parent] = map[string]bool{}
+	}
+	p.arrays[parent][last] = true
+	p.table = table
+	return nil
+}
+
+func (p *tomlParser) created(table, parent *Object, key string, dotted bool) {
+	if p.layout == nil {
+		return
+	}
+	p.layout.parent[table] = parent
+	p.layout.name[table] = key
+	p.layout.dotted[table] = dotted
+}
+
+func (p *tomlParser) descend(table *Object, keys []string, dotted bool) (*Object, error) {
+	for _, key := range keys {
+		value, ok := table.Get(key)
+		if !ok {
+			child := NewObject()
+			table.Set(key, child)
+			p.created(child, table, key, dotted)
+			table = child
+			continue
+		}
+		switch value := value.(type) {
+		case *Object:
+			table = value
+		case []any:
+			if !p.arrays[table][key] || len(value) == 0 {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			table = value[len(value)-1].(*Object)
+		default:
+			return nil, fmt.Errorf("%s is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		var part string
+		switch p.peek() {
+		case '"':
+			value, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			part = value
+		case '\'':
+			value, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			part = value
+		default:
+			start := p.pos
+			for p.pos < len(p.data) && isBareKeyChar(p.data[p.pos]) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, fmt.Errorf("expected a key")
+			}
+			part = string(p.data[start:p.pos])
+		}
+		keys = append(keys, part)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.advance(1)
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) keyValue(table *Object) (tomlStatement, error) {
+	keys, err := p.key()
+	if err != nil {
+		return tomlStatement{}, err
+	}
+	if p.peek() != '=' {
+		return tomlStatement{}, fmt.Errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.advance(1)
+	p.skipSpace()
+	start := p.pos
+	value, err := p.value()
+	if err != nil {
+		return tomlStatement{}, err
+	}
+	parent, err := p.descend(table, keys[:len(keys)-1], true)
+	if err != nil {
+		return tomlStatement{}, err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent.Get(last); ok {
+		return tomlStatement{}, fmt.Errorf("%s is already defined", strings.Join(keys, "."))
+	}
+	parent.Set(last, value)
+	return tomlStatement{table: parent, key: last, valueStart: start, valueEnd: p.pos}, nil
+}
+
+func (p *tomlParser) value() (any, error) {
+	switch {
+	case p.hasPrefix(`"""`):
+		return p.multilineString(`"""`, true)
+	case p.hasPrefix("'''"):
+		return p.multilineString("'''", false)
+	case p.peek() == '"':
+		return p.basicString()
+	case p.peek() == '\'':
+		return p.literalString()
+	case p.peek() == '[':
+		return p.array()
+	case p.peek() == '{':
+		return p.inlineTable()
+	case p.hasPrefix("true"):
+		p.advance(4)
+		return true, nil
+	case p.hasPrefix("false"):
+		p.advance(5)
+		return false, nil
+	}
+	return p.scalar()
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.advance(1)
+	var out strings.Builder
+	for {
+		if p.pos >= len(p.data) || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.advance(1)
+			return out.String(), nil
+		case '\\':
+			if err := p.escape(&out); err != nil {
+				return "", err
+			}
+		default:
+			out.WriteByte(c)
+			p.advance(1)
+		}
+	}
+}
+
+func (p *tomlParser) escape(out *strings.Builder) error {
+	p.advance(1)
+	c := p.peek()
+	p.advance(1)
+	switch c {
+	case 'b':
+		out.WriteByte('\b')
+	case 't':
+		out.WriteByte('\t')
+	case 'n':
+		out.WriteByte('\n')
+	case 'f':
+		out.WriteByte('\f')
+	case 'r':
+		out.WriteByte('\r')
+	case '"', '\\':
+		out.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.data) {
+			return fmt.Errorf("short unicode escape")
+		}
+		code, err := strconv.ParseUint(string(p.data[p.pos:p.pos+size]), 16, 32)
+		if err != nil {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		out.WriteRune(rune(code))
+		p.advance(size)
+	default:
+		return fmt.Errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	p.advance(1)
+	end := bytes.IndexAny(p.data[p.pos:], "'\n")
+	if end < 0 || p.data[p.pos+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+	value := string(p.data[p.pos : p.pos+end])
+	p.advance(end + 1)
+	return value, nil
+}
+
+func (p *tomlParser) multilineString(delimiter string, escapes bool) (string, error) {
+	p.advance(3)
+	if p.hasPrefix("\r\n") {
+		p.advance(2)
+	} else if p.peek() == '\n' {
+		p.advance(1)
+	}
+	var out strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			return "", fmt.Errorf("unterminated multi-line string")
+		}
+		if p.hasPrefix(delimiter) {
+			for p.hasPrefix(delimiter + delimiter[:1]) {
+				out.WriteByte(delimiter[0])
+				p.advance(1)
+			}
+			p.advance(3)
+			return out.String(), nil
+		}
+		c := p.peek()
+		if escapes && c == '\\' {
+			rest := p.pos + 1
+			for rest < len(p.data) && (p.data[rest] == ' ' || p.data[rest] == '\t' || p.data[rest] == '\r') {
+				rest++
+			}
+			if rest < len(p.data) && p.data[rest] == '\n' {
+				p.advance(rest - p.pos)
+				p.skipBlankLines()
+				continue
+			}
+			if err := p.escape(&out); err != nil {
+				return "", err
+			}
+			continue
+		}
+		out.WriteByte(c)
+		p.advance(1)
+	}
+}
+
+func (p *tomlParser) skipBlankLines() {
+	for p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r' || p.peek() == '\n' {
+		p.advance(1)
+	}
+}
+
+func (p *tomlParser) array() (any, error) {
+	p.advance(1)
+	items := []any{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.advance(1)
+			return items, nil
+		}
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.advance(1)
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (any, error) {
+	p.advance(1)
+	table := NewObject()
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.advance(1)
+		return table, nil
+	}
+	for {
+		p.skipSpace()
+		if _, err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.advance(1)
+		case '}':
+			p.advance(1)
+			return table, nil
+		default:
+			return nil, fmt.Errorf("expected , or } in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) scalar() (any, error) {
+	start := p.pos
+	for p.pos < len(p.data) && strings.IndexByte("0123456789abcdefxoABCDEFinTZ:+-._", p.data[p.pos]) >= 0 {
+		p.pos++
+	}
+	if datePattern.Match(p.data[start:p.pos]) && p.pos+1 < len(p.data) && p.data[p.pos] == ' ' && p.data[p.pos+1] >= '0' && p.data[p.pos+1] <= '9' {
+		p.pos++
+		for p.pos < len(p.data) && strings.IndexByte("0123456789Z:+-.", p.data[p.pos]) >= 0 {
+			p.pos++
+		}
+	}
+	token := string(p.data[start:p.pos])
+	if token == "" {
+		return nil, fmt.Errorf("expected a value")
+	}
+	switch {
+	case datePattern.MatchString(token) || strings.Count(token, ":") >= 2:
+		return Datetime(token), nil
+	case strings.HasSuffix(token, "inf"):
+		if strings.HasPrefix(token, "-") {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	case strings.HasSuffix(token, "nan"):
+		return math.NaN(), nil
+	}
+	digits := strings.ReplaceAll(token, "_", "")
+	if !strings.ContainsAny(digits, ".eE") || strings.HasPrefix(digits, "0x") {
+		if value, err := strconv.ParseInt(digits, 0, 64); err == nil {
+			return value, nil
+		}
+	}
+	if value, err := strconv.ParseFloat(digits, 64); err == nil {
+		return value, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", token)
+}
+
+type tomlPatcher struct {
+	data       []byte
+	root       *Object
+	layout     *tomlLayout
+	edits      []textEdit
+	sections   map[*Object]string
+	order      []*Object
+	terminated bool
+}
+
+func patchTOML(data []byte, want *Object) ([]byte, error) {
+	layout := &tomlLayout{parent: map[*Object]*Object{}, name: map[*Object]string{}, dotted: map[*Object]bool{}}
+	p := &tomlParser{data: data, line: 1, root: NewObject(), arrays: map[*Object]map[string]bool{}, layout: layout}
+	p.table = p.root
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("parse TOML: line %d: %w", p.line, err)
+	}
+	patcher := &tomlPatcher{data: data, root: p.root, layout: layout, sections: map[*Object]string{}}
+	if err := patcher.table(p.root, want); err != nil {
+		return nil, err
+	}
+	for _, table := range patcher.order {
+		start := len(data)
+		for _, section := range layout.sections {
+			if patcher.contains(table, section.table) && section.start < start {
+				start = section.start
+			}
+		}
+		header := "[" + tomlPath(patcher.path(table)) + "]\n"
+		patcher.insert(start, header+patcher.sections[table]+"\n")
+	}
+	return applyEdits(data, patcher.edits), nil
+}
+
+func (t *tomlPatcher) table(live, want *Object) error {
+	for _, key := range live.keys {
+		if _, ok := want.values[key]; !ok {
+			t.remove(live, key)
+		}
+	}
+	for _, key := range want.keys {
+		value := want.values[key]
+		have, ok := live.values[key]
+		if ok && Equal(have, value) {
+			continue
+		}
+		if !ok {
+			if err := t.add(live, key, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if statement := t.statement(live, key); statement != nil {
+			var text bytes.Buffer
+			if err := writeTOMLValue(&text, value); err != nil {
+				return fmt.Errorf("%s: %w", tomlPath(append(t.path(live), key)), err)
+			}
+			t.edits = append(t.edits, textEdit{start: statement.valueStart, end: statement.valueEnd, text: text.String()})
+			continue
+		}
+		haveObject, haveIsObject := have.(*Object)
+		wantObject, wantIsObject := value.(*Object)
+		if haveIsObject && wantIsObject {
+			if err := t.table(haveObject, wantObject); err != nil {
+				return err
+			}
+			continue
+		}
+		if isTableArray(have) && isTableArray(value) {
+			haveItems, wantItems := have.([]any), value.([]any)
+			for i, item := range haveItems {
+				if i >= len(wantItems) {
+					t.removeTree(item.(*Object))
+					continue
+				}
+				if err := t.table(item.(*Object), wantItems[i].(*Object)); err != nil {
+					return err
+				}
+			}
+			if len(wantItems) > len(haveItems) {
+				if err := t.addSections(live, key, wantItems[len(haveItems):], true); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		t.remove(live, key)
+		if err := t.add(live, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tomlPatcher) statement(table *Object, key string) *tomlStatement {
+	for i, statement := range t.layout.statements {
+		if statement.table == table && statement.key == key {
+			return &t.layout.statements[i]
+		}
+	}
+	return nil
+}
+
+func (t *tomlPatcher) section(table *Object) *tomlSection {
+	for i, section := range t.layout.sections {
+		if section.table == table {
+			return &t.layout.sections[i]
+		}
+	}
+	return nil
+}
+
+func (t *tomlPatcher) contains(table, child *Object) bool {
+	for ; child != nil; child = t.layout.parent[child] {
+		if child == table {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tomlPatcher) path(table *Object) []string {
+	var path []string
+	for ; table != t.root && table != nil; table = t.layout.parent[table] {
+		path = append([]string{t.layout.name[table]}, path...)
+	}
+	return path
+}
+
+func (t *tomlPatcher) insert(pos int, text string) {
+	if pos > 0 && t.data[pos-1] != '\n' && !t.terminated {
+		text = "\n" + text
+		t.terminated = true
+	}
+	t.edits = append(t.edits, textEdit{start: pos, end: pos, text: text})
+}
+
+func (t *tomlPatcher) add(table *Object, key string, value any) error {
+	if isTable(value) || isTableArray(value) {
+		items, array := value.([]any)
+		if !array {
+			items = []any{value}
+		}
+		return t.addSections(table, key, items, array)
+	}
+	var text bytes.Buffer
+	if err := writeTOMLValue(&text, value); err != nil {
+		return fmt.Errorf("%s: %w", tomlPath(append(t.path(table), key)), err)
+	}
+	t.addKey(table, []string{key}, text.String())
+	return nil
+}
+
+func (t *tomlPatcher) addKey(table *Object, keys []string, value string) {
+	line := tomlPath(keys) + " = " + value + "\n"
+	if t.layout.dotted[table] {
+		t.addKey(t.layout.parent[table], append([]string{t.layout.name[table]}, keys...), value)
+		return
+	}
+	start, end := 0, len(t.data)
+	if section := t.section(table); section != nil {
+		start, end = section.body, section.end
+	} else if table != t.root {
+		if _, ok := t.sections[table]; !ok {
+			t.order = append(t.order, table)
+		}
+		t.sections[table] += line
+		return
+	} else if len(t.layout.sections) > 0 {
+		end = t.layout.sections[0].start
+	}
+	var last *tomlStatement
+	for i, statement := range t.layout.statements {
+		if statement.start >= start && statement.end <= end {
+			last = &t.layout.statements[i]
+		}
+	}
+	if last == nil {
+		t.insert(start, line)
+		return
+	}
+	lineStart := t.data[last.start:]
+	indent := lineStart[:len(lineStart)-len(bytes.TrimLeft(lineStart, " \t"))]
+	t.insert(last.end, string(indent)+line)
+}
+
+func (t *tomlPatcher) addSections(table *Object, key string, items []any, array bool) error {
+	end := 0
+	for _, section := range t.layout.sections {
+		if t.contains(table, section.table) && section.end > end {
+			end = section.end
+		}
+	}
+	for owner := table; end == 0; owner = t.layout.parent[owner] {
+		if owner == t.root || owner == nil {
+			end = len(t.data)
+		} else if section := t.section(owner); section != nil {
+			end = section.end
+		}
+	}
+	path := append(t.path(table), key)
+	var out bytes.Buffer
+	for _, item := range items {
+		if err := writeTOMLTable(&out, item.(*Object), path, array); err != nil {
+			return err
+		}
+	}
+	t.insert(end, "\n"+string(bytes.TrimLeft(out.Bytes(), "\n")))
+	return nil
+}
+
+func (t *tomlPatcher) remove(table *Object, key string) {
+	if statement := t.statement(table, key); statement != nil {
+		t.edits = append(t.edits, textEdit{start: statement.start, end: statement.end})
+		return
+	}
+	switch value := table.values[key].(type) {
+	case *Object:
+		t.removeTree(value)
+	case []any:
+		for _, item := range value {
+			if item, ok := item.(*Object); ok {
+				t.removeTree(item)
+			}
+		}
+	}
+}
+
+func (t *tomlPatcher) removeTree(table *Object) {
+	var removed []tomlSection
+	for _, section := range t.layout.sections {
+		if !t.contains(table, section.table) {
+			continue
+		}
+		start := section.start
+		if start >= 2 && t.data[start-1] == '\n' && t.data[start-2] == '\n' {
+			start--
+		}
+		t.edits = append(t.edits, textEdit{start: start, end: section.end})
+		removed = append(removed, section)
+	}
+	for _, statement := range t.layout.statements {
+		if !t.contains(table, statement.table) {
+			continue
+		}
+		inside := false
+		for _, section := range removed {
+			inside = inside || statement.start >= section.body && statement.end <= section.end
+		}
+		if !inside {
+			t.edits = append(t.edits, textEdit{start: statement.start, end: statement.end})
+		}
+	}
+}
+
+func encodeTOML(doc *Object) ([]byte, error) {
+	var out bytes.Buffer
+	if err := writeTOMLTable(&out, doc, nil, false); err != nil {
+		return nil, err
+	}
+	return bytes.TrimLeft(out.Bytes(), "\n"), nil
+}
+
+func isTable(value any) bool {
+	_, ok := value.(*Object)
+	return ok
+}
+
+func isTableArray(value any) bool {
+	items, ok := value.([]any)
+	if !ok || len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if !isTable(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeTOMLTable(out *bytes.Buffer, table *Object, path []string, array bool) error {
+	var scalars, tables []string
+	for _, key := range table.keys {
+		value := table.values[key]
+		if isTable(value) || isTableArray(value) {
+			tables = append(tables, key)
+		} else {
+			scalars = append(scalars, key)
+		}
+	}
+	if path != nil && (array || len(scalars) > 0 || len(tables) == 0) {
+		if out.Len() > 0 {
+			out.WriteByte('\n')
+		}
+		if array {
+			fmt.Fprintf(out, "[[%s]]\n", tomlPath(path))
+		} else {
+			fmt.Fprintf(out, "[%s]\n", tomlPath(path))
+		}
+	}
+	for _, key := range scalars {
+		out.WriteString(tomlKey(key) + " = ")
+		if err := writeTOMLValue(out, table.values[key]); err != nil {
+			return fmt.Errorf("%s: %w", tomlPath(append(path, key)), err)
+		}
+		out.WriteByte('\n')
+	}
+	for _, key := range tables {
+		child := append(append([]string(nil), path...), key)
+		switch value := table.values[key].(type) {
+		case *Object:
+			if err := writeTOMLTable(out, value, child, false); err != nil {
+				return err
+			}
+		case []any:
+			for _, item := range value {
+				if err := writeTOMLTable(out, item.(*Object), child, true); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
+
+func tomlKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+func tomlString(value string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+				fmt.Fprintf(&out, `\u%04X`, r)
+			} else {
+				out.WriteRune(r)
+			}
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+func writeTOMLValue(out *bytes.Buffer, value any) error {
+	switch value := value.(type) {
+	case string:
+		out.WriteString(tomlString(value))
+	case Datetime:
+		out.WriteString(string(value))
+	case bool:
+		out.WriteString(strconv.FormatBool(value))
+	case int:
+		out.WriteString(strconv.Itoa(value))
+	case int64:
+		out.WriteString(strconv.FormatInt(value, 10))
+	case float64:
+		out.WriteString(tomlFloat(value))
+	case []any:
+		out.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			if err := writeTOMLValue(out, item); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+	case *Object:
+		out.WriteByte('{')
+		for i, key := range value.keys {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			out.WriteString(" " + tomlKey(key) + " = ")
+			if err := writeTOMLValue(out, value.values[key]); err != nil {
+				return err
+			}
+		}
+		if value.Len() > 0 {
+			out.WriteByte(' ')
+		}
+		out.WriteByte('}')
+	case nil:
+		return fmt.Errorf("TOML has no null value")
+	default:
+		return fmt.Errorf("cannot encode %T as TOML", value)
+	}
+	return nil
+}
+
+func tomlFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.ContainsAny(formatted, ".eE") {
+		formatted += ".0"
+	}
+	return formatted
+}
@@ -0,0 +1,179 @@
+package structured
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+func decodeYAML(data []byte) (*Object, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parse YAML: %w", err)
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return NewObject(), nil
+	}
+	value, err := fromYAMLNode(root.Content[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse YAML: %w", err)
+	}
+	doc, ok := value.(*Object)
+	if !ok {
+		return nil, fmt.Errorf("parse YAML: top level is not a mapping")
+	}
+	return doc, nil
+}
+
+func fromYAMLNode(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return fromYAMLNode(node.Alias)
+	case yaml.MappingNode:
+		doc := NewObject()
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := fromYAMLNode(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			doc.Set(node.Content[i].Value, value)
+		}
+		return doc, nil
+	case yaml.SequenceNode:
+		items := []any{}
+		for _, child := range node.Content {
+			item, err := fromYAMLNode(child)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!timestamp":
+			return Datetime(node.Value), nil
+		case "!!str", "!!binary":
+			return node.Value, nil
+		}
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("unsupported YAML node at line %d", node.Line)
+}
+
+func encodeYAML(doc *Object) ([]byte, error) {
+	node, err := toYAMLNode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return writeYAML(node)
+}
+
+func patchYAML(data []byte, live, want *Object) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parse YAML: %w", err)
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return encodeYAML(want)
+	}
+	if err := patchYAMLNode(root.Content[0], live, want); err != nil {
+		return nil, err
+	}
+	return writeYAML(&root)
+}
+
+func patchYAMLNode(node *yaml.Node, live, want *Object) error {
+	for i := 0; i+1 < len(node.Content); {
+		if _, ok := want.values[node.Content[i].Value]; ok {
+			i += 2
+			continue
+		}
+		node.Content = append(node.Content[:i], node.Content[i+2:]...)
+	}
+	for _, key := range want.keys {
+		value := want.values[key]
+		have, ok := live.values[key]
+		if ok && Equal(have, value) {
+			continue
+		}
+		replacement, err := toYAMLNode(value)
+		if err != nil {
+			return err
+		}
+		index := -1
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				index = i + 1
+			}
+		}
+		if index < 0 {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, replacement)
+			continue
+		}
+		existing := node.Content[index]
+		haveObject, haveIsObject := have.(*Object)
+		wantObject, wantIsObject := value.(*Object)
+		if haveIsObject && wantIsObject && existing.Kind == yaml.MappingNode {
+			if err := patchYAMLNode(existing, haveObject, wantObject); err != nil {
+				return err
+			}
+			continue
+		}
+		replacement.HeadComment = existing.HeadComment
+		replacement.LineComment = existing.LineComment
+		replacement.FootComment = existing.FootComment
+		node.Content[index] = replacement
+	}
+	return nil
+}
+
+func writeYAML(node *yaml.Node) ([]byte, error) {
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, fmt.Errorf("encode YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("encode YAML: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+func toYAMLNode(value any) (*yaml.Node, error) {
+	switch value := value.(type) {
+	case *Object:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range value.keys {
+			child, err := toYAMLNode(value.values[key])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		}
+		return node, nil
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range value {
+			child, err := toYAMLNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case Datetime:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: string(value)}, nil
+	}
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, fmt.Errorf("encode YAML: %w", err)
+	}
+	return &node, nil
+}
@@ -0,0 +1,172 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+const metaName = "meta.yaml"
+
+type Item struct {
+	ID        string    `yaml:"id"`
+	Source    string    `yaml:"source"`
+	Target    string    `yaml:"target"`
+	Encrypted bool      `yaml:"encrypted,omitempty"`
+	Filter    string    `yaml:"filter,omitempty"`
+	Template  bool      `yaml:"template,omitempty"`
+	Block     string    `yaml:"block,omitempty"`
+	Merge     bool      `yaml:"merge,omitempty"`
+	Arrays    string    `yaml:"arrays,omitempty"`
+	Local     bool      `yaml:"local,omitempty"`
+	RemovedAt time.Time `yaml:"removed_at"`
+}
+
+func (item Item) Entry() config.FileEntry {
+	return config.FileEntry{
+		Source:    item.Source,
+		Target:    item.Target,
+		Encrypted: item.Encrypted,
+		Filter:    item.Filter,
+		Template:  item.Template,
+		Block:     item.Block,
+		Merge:     item.Merge,
+		Arrays:    item.Arrays,
+		Local:     item.Local,
+	}
+}
+
+func Dir(home string) string {
+	return filepath.Join(config.DotsDir(home), config.TrashDirName)
+}
+
+func (item Item) StoredPath(home string) string {
+	return filepath.Join(Dir(home), item.ID, filepath.Base(item.Source))
+}
+
+func Move(home string, entry config.FileEntry) (Item, error) {
+	now := time.Now().UTC()
+	base := filepath.Base(entry.Source)
+	id := fmt.Sprintf("%s-%s", now.Format("20060102T150405"), base)
+	itemDir := filepath.Join(Dir(home), id)
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(itemDir); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		id = fmt.Sprintf("%s-%s-%d", now.Format("20060102T150405"), base, n)
+		itemDir = filepath.Join(Dir(home), id)
+	}
+	if err := os.MkdirAll(itemDir, 0o755); err != nil {
+		return Item{}, fmt.Errorf("create trash entry: %w", err)
+	}
+
+	item := Item{
+		ID:        id,
+		Source:    entry.Source,
+		Target:    entry.Target,
+		Encrypted: entry.Encrypted,
+		Filter:    entry.Filter,
+		Template:  entry.Template,
+		Block:     entry.Block,
+		Merge:     entry.Merge,
+		Arrays:    entry.Arrays,
+		Local:     entry.Local,
+		RemovedAt: now,
+	}
+	if err := writeMeta(itemDir, item); err != nil {
+		return Item{}, err
+	}
+	if err := os.Rename(entry.Source, item.StoredPath(home)); err != nil {
+		_ = os.RemoveAll(itemDir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return Item{}, fmt.Errorf("stored file missing: %s", entry.Source)
+		}
+		return Item{}, fmt.Errorf("move stored file to trash: %w", err)
+	}
+	return item, nil
+}
+
+func List(home string) ([]Item, error) {
+	dirEntries, err := os.ReadDir(Dir(home))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []Item{}, nil
+		}
+		return nil, fmt.Errorf("read trash: %w", err)
+	}
+	items := make([]Item, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		item, err := readMeta(filepath.Join(Dir(home), dirEntry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].RemovedAt.Before(items[j].RemovedAt)
+	})
+	return items, nil
+}
+
+func Find(home, id string) (Item, error) {
+	item, err := readMeta(filepath.Join(Dir(home), id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Item{}, fmt.Errorf("trash entry not found: %s", id)
+		}
+		return Item{}, err
+	}
+	return item, nil
+}
+
+func Restore(home string, item Item) error {
+	if _, err := os.Lstat(item.Source); err == nil {
+		return fmt.Errorf("stored file already exists: %s", item.Source)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("stat stored file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(item.Source), 0o755); err != nil {
+		return fmt.Errorf("ensure stored dir: %w", err)
+	}
+	if err := os.Rename(item.StoredPath(home), item.Source); err != nil {
+		return fmt.Errorf("restore stored file: %w", err)
+	}
+	if err := os.RemoveAll(filepath.Join(Dir(home), item.ID)); err != nil {
+		return fmt.Errorf("remove trash entry: %w", err)
+	}
+	return nil
+}
+
+func writeMeta(itemDir string, item Item) error {
+	data, err := yaml.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("encode trash metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(itemDir, metaName), data, 0o644); err != nil {
+		return fmt.Errorf("write trash metadata: %w", err)
+	}
+	return nil
+}
+
+func readMeta(itemDir string) (Item, error) {
+	data, err := os.ReadFile(filepath.Join(itemDir, metaName))
+	if err != nil {
+		return Item{}, fmt.Errorf("read trash metadata: %w", err)
+	}
+	var item Item
+	if err := yaml.Unmarshal(data, &item); err != nil {
+		return Item{}, fmt.Errorf("parse trash metadata: %w", err)
+	}
+	return item, nil
+}
@@ -0,0 +1,162 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/subcode-labs/dots/internal/config"
+)
+
+func setupStored(t *testing.T, home, name, content string) config.FileEntry {
+	t.Helper()
+	if _, err := config.EnsureDotsDir(home); err != nil {
+		t.Fatalf("EnsureDotsDir failed: %v", err)
+	}
+	source := filepath.Join(config.DotsDir(home), name)
+	if err := os.WriteFile(source, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to create stored file: %v", err)
+	}
+	return config.FileEntry{Source: source, Target: filepath.Join(home, name)}
+}
+
+func TestMoveAndList(t *testing.T) {
+	home := t.TempDir()
+	entry := setupStored(t, home, ".bashrc", "export A=1")
+
+	item, err := Move(home, entry)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if _, err := os.Stat(entry.Source); !os.IsNotExist(err) {
+		t.Error("stored file should be moved out of the dots directory")
+	}
+	got, err := os.ReadFile(item.StoredPath(home))
+	if err != nil {
+		t.Fatalf("trashed file missing: %v", err)
+	}
+	if string(got) != "export A=1" {
+		t.Errorf("trashed content = %q, want %q", got, "export A=1")
+	}
+
+	items, err := List(home)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("List returned %d items, want 1", len(items))
+	}
+	if items[0].ID != item.ID || items[0].Target != entry.Target || items[0].Source != entry.Source {
+		t.Errorf("List returned %+v, want %+v", items[0], item)
+	}
+}
+
+func TestMoveSameNameTwice(t *testing.T) {
+	home := t.TempDir()
+	entry := setupStored(t, home, ".vimrc", "one")
+	first, err := Move(home, entry)
+	if err != nil {
+		t.Fatalf("first Move failed: %v", err)
+	}
+	entry = setupStored(t, home, ".vimrc", "two")
+	second, err := Move(home, entry)
+	if err != nil {
+		t.Fatalf("second Move failed: %v", err)
+	}
+	if first.ID == second.ID {
+		t.Errorf("trash ids should be unique, both %q", first.ID)
+	}
+}
+
+func TestMoveMissingSource(t *testing.T) {
+	home := t.TempDir()
+	entry := config.FileEntry{Source: filepath.Join(config.DotsDir(home), ".zshrc"), Target: filepath.Join(home, ".zshrc")}
+	if _, err := Move(home, entry); err == nil {
+		t.Error("Move should fail when the stored file is missing")
+	}
+	items, err := List(home)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(items) != 0 {
+		t.Errorf("failed Move should not leave trash entries, got %d", len(items))
+	}
+}
+
+func TestListEmpty(t *testing.T) {
+	items, err := List(t.TempDir())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(items) != 0 {
+		t.Errorf("List returned %d items, want 0", len(items))
+	}
+}
+
+func TestFindAndRestore(t *testing.T) {
+	home := t.TempDir()
+	entry := setupStored(t, home, ".gitconfig", "[user]")
+	item, err := Move(home, entry)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	found, err := Find(home, item.ID)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if err := Restore(home, found); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	got, err := os.ReadFile(entry.Source)
+	if err != nil {
+		t.Fatalf("stored file not restored: %v", err)
+	}
+	if string(got) != "[user]" {
+		t.Errorf("restored content = %q, want %q", got, "[user]")
+	}
+	if _, err := Find(home, item.ID); err == nil {
+		t.Error("trash entry should be gone after Restore")
+	}
+}
+
+func TestRestoreRefusesOverwrite(t *testing.T) {
+	home := t.TempDir()
+	entry := setupStored(t, home, ".tmux.conf", "old")
+	item, err := Move(home, entry)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	setupStored(t, home, ".tmux.conf", "new")
+
+	if err := Restore(home, item); err == nil {
+		t.Error("Restore should refuse to overwrite an existing stored file")
+	}
+	got, _ := os.ReadFile(entry.Source)
+	if string(got) != "new" {
+		t.Errorf("stored file was overwritten: %q", got)
+	}
+}
+
+func TestMoveKeepsEntryFlags(t *testing.T) {
+	home := t.TempDir()
+	entry := setupStored(t, home, ".netrc", "secret")
+	entry.Encrypted = true
+	entry.Block = "company"
+	entry.Merge = true
+	entry.Arrays = "union"
+	entry.Local = true
+	if _, err := Move(home, entry); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	items, err := List(home)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("List returned %d items, want 1", len(items))
+	}
+	if got := items[0].Entry(); got != entry {
+		t.Errorf("Entry() = %+v, want %+v", got, entry)
+	}
+}